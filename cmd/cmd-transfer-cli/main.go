@@ -0,0 +1,278 @@
+/*
+ * @Descripttion: 命令行工具，连接运行中的服务发送消息、等待响应、查看消息与执行脚本
+ * @Author: chenjun
+ * @Date: 2026-10-19 17:10:26
+ */
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"go-cmd-transfer/core/client"
+	"go-cmd-transfer/core/socket"
+	"go-cmd-transfer/core/websocket"
+	"go-cmd-transfer/global"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	logger "github.com/sirupsen/logrus"
+)
+
+const usage = `cmd-transfer-cli 连接运行中的服务
+
+用法：
+  cmd-transfer-cli <命令> [参数]
+
+命令：
+  send     发送一条业务数据，并输出等待期间收到的消息
+  request  发送请求并等待响应
+  tail     持续输出收到的消息，可同时订阅主题
+  script   按脚本文件执行一组收发操作
+
+地址为 host:port 时使用socket连接，为 ws:// 或 wss:// 开头时使用websocket连接。
+执行 cmd-transfer-cli <命令> -h 查看命令的参数。
+`
+
+//connectFlags 连接参数
+type connectFlags struct {
+	addr     string
+	user     string
+	source   string
+	token    string
+	password string
+	tls      bool
+	insecure bool
+	verbose  bool
+}
+
+//messageFlags 业务数据参数
+type messageFlags struct {
+	file     string
+	op       string
+	mode     string
+	targets  string
+	protocol string
+	data     string
+	ack      bool
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	var err error
+	switch command, args := os.Args[1], os.Args[2:]; command {
+	case "send":
+		err = runSend(args)
+	case "request":
+		err = runRequest(args)
+	case "tail":
+		err = runTail(args)
+	case "script":
+		err = runScript(args)
+	case "-h", "-help", "--help", "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "未知命令：%s\n\n%s", command, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "错误：", err)
+		os.Exit(1)
+	}
+}
+
+//runSend 发送业务数据，输出等待期间收到的消息
+func runSend(args []string) error {
+	fs := flag.NewFlagSet("send", flag.ExitOnError)
+	cf := bindConnectFlags(fs)
+	mf := bindMessageFlags(fs)
+	wait := fs.Duration("wait", 500*time.Millisecond, "发送后等待并输出收到的消息的时长")
+	fs.Parse(args)
+	busData, err := mf.businessData()
+	if err != nil {
+		return err
+	}
+	c, err := cf.dial()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if err := c.Send(busData); err != nil {
+		return err
+	}
+	printSent(busData)
+	timer := time.NewTimer(*wait)
+	defer timer.Stop()
+	for {
+		select {
+		case msg := <-c.Messages():
+			printMessage(msg)
+		case <-timer.C:
+			return nil
+		}
+	}
+}
+
+//runRequest 发送请求并输出响应
+func runRequest(args []string) error {
+	fs := flag.NewFlagSet("request", flag.ExitOnError)
+	cf := bindConnectFlags(fs)
+	mf := bindMessageFlags(fs)
+	timeout := fs.Duration("timeout", 10*time.Second, "等待响应的时长")
+	fs.Parse(args)
+	busData, err := mf.businessData()
+	if err != nil {
+		return err
+	}
+	c, err := cf.dial()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	// 丢弃请求之外的消息，避免阻塞读协程
+	go func() {
+		for range c.Messages() {
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	printSent(busData)
+	resp, err := c.Request(ctx, busData)
+	if err != nil {
+		return err
+	}
+	printData(resp)
+	return nil
+}
+
+//runTail 持续输出收到的消息，直到 Ctrl+C
+func runTail(args []string) error {
+	fs := flag.NewFlagSet("tail", flag.ExitOnError)
+	cf := bindConnectFlags(fs)
+	topics := fs.String("topics", "", "订阅的主题，逗号分隔")
+	fs.Parse(args)
+	c, err := cf.dial()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if *topics != "" {
+		if err := c.Subscribe(split(*topics)...); err != nil {
+			return err
+		}
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	for {
+		select {
+		case msg := <-c.Messages():
+			printMessage(msg)
+		case <-signals:
+			return nil
+		}
+	}
+}
+
+//bindConnectFlags 注册连接参数
+func bindConnectFlags(fs *flag.FlagSet) *connectFlags {
+	cf := &connectFlags{}
+	fs.StringVar(&cf.addr, "addr", "127.0.0.1:8866", "服务地址，host:port 为socket，ws:// 或 wss:// 开头为websocket")
+	fs.StringVar(&cf.user, "user", "", "用户账号")
+	fs.StringVar(&cf.source, "source", "", "接入端标识")
+	fs.StringVar(&cf.token, "token", "", "登录令牌")
+	fs.StringVar(&cf.password, "password", "", "登录密码，与 -user 一起使用")
+	fs.BoolVar(&cf.tls, "tls", false, "socket连接使用TLS，websocket按地址的 wss:// 决定")
+	fs.BoolVar(&cf.insecure, "insecure", false, "不校验服务端证书")
+	fs.BoolVar(&cf.verbose, "v", false, "输出客户端日志")
+	return cf
+}
+
+//bindMessageFlags 注册业务数据参数
+func bindMessageFlags(fs *flag.FlagSet) *messageFlags {
+	mf := &messageFlags{}
+	fs.StringVar(&mf.file, "file", "", "业务数据的JSON文件，- 为标准输入，设置后忽略其他业务数据参数")
+	fs.StringVar(&mf.op, "op", "", "操作类型")
+	fs.StringVar(&mf.mode, "mode", "", "投递模式 broadcast/user/source/conn/topic")
+	fs.StringVar(&mf.targets, "targets", "", "投递目标，逗号分隔")
+	fs.StringVar(&mf.protocol, "protocol", "", "目标传输层 socket/websocket，为空时投递到所有传输层")
+	fs.StringVar(&mf.data, "data", "", "数据，合法的JSON按JSON发送，否则按字符串发送")
+	fs.BoolVar(&mf.ack, "ack", false, "需要接收方确认")
+	return mf
+}
+
+//dial 按参数连接服务
+func (cf *connectFlags) dial() (*client.Client, error) {
+	logger.SetOutput(os.Stderr)
+	if cf.verbose {
+		logger.SetLevel(logger.InfoLevel)
+	} else {
+		logger.SetLevel(logger.WarnLevel)
+	}
+	var opts []client.Option
+	if cf.user != "" || cf.source != "" {
+		opts = append(opts, client.WithIdentity(cf.user, cf.source))
+	}
+	if cf.token != "" {
+		opts = append(opts, client.WithToken(cf.token))
+	}
+	if cf.password != "" {
+		opts = append(opts, client.WithPassword(cf.user, cf.password))
+	}
+	var tlsConfig *tls.Config
+	if cf.tls || cf.insecure {
+		tlsConfig = &tls.Config{InsecureSkipVerify: cf.insecure}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	if strings.HasPrefix(cf.addr, "ws://") || strings.HasPrefix(cf.addr, "wss://") {
+		return websocket.Dial(ctx, cf.addr, tlsConfig, opts...)
+	}
+	return socket.Dial(ctx, cf.addr, tlsConfig, opts...)
+}
+
+//businessData 按参数或文件生成业务数据
+func (mf *messageFlags) businessData() (global.BusinessData, error) {
+	if mf.file != "" {
+		var (
+			raw []byte
+			err error
+		)
+		if mf.file == "-" {
+			raw, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			raw, err = ioutil.ReadFile(mf.file)
+		}
+		if err != nil {
+			return global.BusinessData{}, err
+		}
+		return parseBusinessData(raw)
+	}
+	return global.BusinessData{
+		OpType:     mf.op,
+		Mode:       mf.mode,
+		Targets:    split(mf.targets),
+		Protocol:   mf.protocol,
+		RequireAck: mf.ack,
+		Data:       parseData(mf.data),
+	}, nil
+}
+
+//split 按逗号拆分，忽略空白
+func split(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,79 @@
+/*
+ * @Descripttion: 业务数据的解析与输出
+ * @Author: chenjun
+ * @Date: 2026-10-19 17:18:40
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go-cmd-transfer/core/client"
+	"go-cmd-transfer/global"
+	"time"
+)
+
+//fileData 文件中的业务数据，数据保留原始JSON按原样发送
+type fileData struct {
+	global.BusinessData
+	Data json.RawMessage `json:"data"`
+}
+
+//parseBusinessData 解析JSON格式的业务数据
+func parseBusinessData(raw []byte) (global.BusinessData, error) {
+	fd := fileData{}
+	if err := json.Unmarshal(raw, &fd); err != nil {
+		return global.BusinessData{}, fmt.Errorf("业务数据格式错误：%w", err)
+	}
+	busData := fd.BusinessData
+	if len(fd.Data) > 0 {
+		busData.Data = fd.Data
+	}
+	return busData, nil
+}
+
+//parseData 合法的JSON按原样发送，否则按字符串发送
+func parseData(data string) interface{} {
+	if data == "" {
+		return nil
+	}
+	if json.Valid([]byte(data)) {
+		return json.RawMessage(data)
+	}
+	return data
+}
+
+//printSent 输出发送的业务数据
+func printSent(busData global.BusinessData) {
+	raw, err := json.Marshal(busData)
+	if err != nil {
+		raw = []byte(err.Error())
+	}
+	printRaw(">", raw)
+}
+
+//printMessage 输出收到的消息
+func printMessage(msg client.Message) {
+	printRaw("<", msg.Raw)
+}
+
+//printData 输出请求的响应
+func printData(busData global.BusinessData) {
+	raw, err := json.Marshal(busData)
+	if err != nil {
+		raw = []byte(err.Error())
+	}
+	printRaw("<", raw)
+}
+
+//printRaw 带时间与方向输出，合法的JSON缩进后输出
+func printRaw(direction string, raw []byte) {
+	var buf bytes.Buffer
+	if json.Indent(&buf, raw, "", "  ") != nil {
+		buf.Reset()
+		buf.Write(raw)
+	}
+	fmt.Printf("%s %s %s\n", time.Now().Format("15:04:05.000"), direction, buf.String())
+}
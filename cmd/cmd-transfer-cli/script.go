@@ -0,0 +1,258 @@
+/*
+ * @Descripttion: 脚本会话，按文件逐行执行收发操作，用于复现设备的交互过程
+ * @Author: chenjun
+ * @Date: 2026-10-19 17:26:13
+ */
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"go-cmd-transfer/core/client"
+	"go-cmd-transfer/core/hub"
+	"go-cmd-transfer/global"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const scriptUsage = `脚本每行一条指令，空行与 # 开头的行忽略：
+  send <业务数据JSON>                发送业务数据
+  request <等待时长> <业务数据JSON>  发送请求并等待响应
+  reply <数据>                       响应最近匹配或收到的请求，数据为合法JSON时按JSON发送
+  subscribe <主题,主题>              订阅主题
+  unsubscribe <主题,主题>            取消订阅
+  expect <等待时长> <文本>           等待包含文本的消息，超时失败
+  sleep <时长>                       等待并输出收到的消息
+`
+
+//runScript 连接服务并执行脚本，任一指令失败时停止
+func runScript(args []string) error {
+	fs := flag.NewFlagSet("script", flag.ExitOnError)
+	cf := bindConnectFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "用法：cmd-transfer-cli script [参数] <脚本文件，- 为标准输入>")
+		fs.PrintDefaults()
+		fmt.Fprint(fs.Output(), "\n"+scriptUsage)
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	var input io.Reader = os.Stdin
+	if path := fs.Arg(0); path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		input = file
+	}
+	c, err := cf.dial()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	s := &session{client: c}
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := s.exec(line); err != nil {
+			return fmt.Errorf("第%d行 %s：%w", lineNo, line, err)
+		}
+	}
+	return scanner.Err()
+}
+
+//session 脚本会话
+type session struct {
+	// 客户端
+	client *client.Client
+	// 已输出但尚未被 expect 匹配的消息
+	pending []client.Message
+	// 最近匹配或收到的请求，reply 指令响应该请求
+	lastRequest *global.BusinessData
+}
+
+//exec 执行一条指令
+func (s *session) exec(line string) error {
+	command, rest := cut(line)
+	switch command {
+	case "send":
+		busData, err := parseBusinessData([]byte(rest))
+		if err != nil {
+			return err
+		}
+		printSent(busData)
+		return s.client.Send(busData)
+	case "request":
+		timeout, rest, err := cutDuration(rest)
+		if err != nil {
+			return err
+		}
+		busData, err := parseBusinessData([]byte(rest))
+		if err != nil {
+			return err
+		}
+		return s.request(timeout, busData)
+	case "reply":
+		return s.reply(rest)
+	case "subscribe":
+		return s.client.Subscribe(split(rest)...)
+	case "unsubscribe":
+		return s.client.Unsubscribe(split(rest)...)
+	case "expect":
+		timeout, text, err := cutDuration(rest)
+		if err != nil {
+			return err
+		}
+		if text == "" {
+			return errors.New("缺少等待的文本")
+		}
+		return s.expect(timeout, text)
+	case "sleep":
+		duration, err := time.ParseDuration(rest)
+		if err != nil {
+			return err
+		}
+		return s.collect(duration, nil)
+	default:
+		return fmt.Errorf("未知指令：%s", command)
+	}
+}
+
+//request 发送请求，等待期间收到的其他消息照常输出
+func (s *session) request(timeout time.Duration, busData global.BusinessData) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	done := make(chan error, 1)
+	printSent(busData)
+	go func() {
+		resp, err := s.client.Request(ctx, busData)
+		if err == nil {
+			printData(resp)
+		}
+		done <- err
+	}()
+	for {
+		select {
+		case err := <-done:
+			return err
+		case msg, ok := <-s.client.Messages():
+			if !ok {
+				return <-done
+			}
+			s.received(msg)
+			s.pending = append(s.pending, msg)
+		}
+	}
+}
+
+//reply 以服务端下发的关联标识响应最近匹配或收到的请求
+func (s *session) reply(data string) error {
+	if s.lastRequest == nil {
+		return errors.New("尚未收到请求")
+	}
+	request, value := *s.lastRequest, parseData(data)
+	s.lastRequest = nil
+	printSent(global.BusinessData{OpType: request.OpType, Mode: hub.ModeReply, CorrelationID: request.CorrelationID, Data: value})
+	return s.client.Reply(request, value)
+}
+
+//received 输出收到的消息，携带关联标识的业务数据记为最近收到的请求
+func (s *session) received(msg client.Message) {
+	printMessage(msg)
+	s.remember(msg)
+}
+
+//remember 携带关联标识的业务数据记为最近的请求
+func (s *session) remember(msg client.Message) {
+	if msg.Data != nil && msg.Data.CorrelationID != "" && msg.Data.Mode != hub.ModeReply {
+		request := *msg.Data
+		s.lastRequest = &request
+	}
+}
+
+//expect 按顺序匹配消息，匹配的消息及之前的消息不再参与后续匹配
+func (s *session) expect(timeout time.Duration, text string) error {
+	for i, msg := range s.pending {
+		if bytes.Contains(msg.Raw, []byte(text)) {
+			s.pending = s.pending[i+1:]
+			s.remember(msg)
+			return nil
+		}
+	}
+	s.pending = nil
+	matched := false
+	err := s.collect(timeout, func(msg client.Message) bool {
+		matched = bytes.Contains(msg.Raw, []byte(text))
+		if matched {
+			s.remember(msg)
+		}
+		return matched
+	})
+	if err != nil {
+		return err
+	}
+	if !matched {
+		return fmt.Errorf("%s内未收到包含 %s 的消息", timeout, text)
+	}
+	s.pending = nil
+	return nil
+}
+
+/*
+collect 输出收到的消息，直到超时或 stop 返回 true
+ * @param duration 等待时长
+ * @param stop 为空时等待到超时
+ * @return: 客户端关闭时返回错误
+*/
+func (s *session) collect(duration time.Duration, stop func(msg client.Message) bool) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	for {
+		select {
+		case msg, ok := <-s.client.Messages():
+			if !ok {
+				return client.ErrClosed
+			}
+			s.received(msg)
+			if stop != nil && stop(msg) {
+				return nil
+			}
+			s.pending = append(s.pending, msg)
+		case <-timer.C:
+			return nil
+		}
+	}
+}
+
+//cut 拆分出第一个单词与其余部分
+func cut(s string) (string, string) {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexAny(s, " \t"); i >= 0 {
+		return s[:i], strings.TrimSpace(s[i+1:])
+	}
+	return s, ""
+}
+
+//cutDuration 拆分出开头的时长与其余部分
+func cutDuration(s string) (time.Duration, string, error) {
+	word, rest := cut(s)
+	duration, err := time.ParseDuration(word)
+	if err != nil {
+		return 0, "", err
+	}
+	return duration, rest, nil
+}
@@ -8,25 +8,56 @@ package config
 
 //Server  服务配置
 type Server struct {
-	Redis  Redis  `mapstructure:"redis" json:"redis" yaml:"redis"`
-	System System `mapstructure:"system" json:"system" yaml:"system"`
-	Log    Log    `mapstructure:"log" json:"log" yaml:"log"`
+	Redis   Redis   `mapstructure:"redis" json:"redis" yaml:"redis"`
+	System  System  `mapstructure:"system" json:"system" yaml:"system"`
+	Log     Log     `mapstructure:"log" json:"log" yaml:"log"`
+	Offline Offline `mapstructure:"offline" json:"offline" yaml:"offline"`
+	Auth    Auth    `mapstructure:"auth" json:"auth" yaml:"auth"`
+	ACL     ACL     `mapstructure:"acl" json:"acl" yaml:"acl"`
+	Admin   Admin   `mapstructure:"admin" json:"admin" yaml:"admin"`
+	Metrics Metrics `mapstructure:"metrics" json:"metrics" yaml:"metrics"`
 }
 
 //System 信息
 type System struct {
-	Env           string `mapstructure:"env" json:"env" yaml:"env"`
-	SocketPort    int    `mapstructure:"socket-port" json:"socketPport" yaml:"socket-port"`
-	WebsocketPort int    `mapstructure:"websocket-port" json:"websocketPport" yaml:"websocket-port"`
+	Env                     string `mapstructure:"env" json:"env" yaml:"env"`
+	Host                    string `mapstructure:"host" json:"host" yaml:"host"`
+	SocketPort              int    `mapstructure:"socket-port" json:"socketPport" yaml:"socket-port"`
+	WebsocketPort           int    `mapstructure:"websocket-port" json:"websocketPport" yaml:"websocket-port"`
+	WebsocketMaxMessageSize int64  `mapstructure:"websocket-max-message-size" json:"websocketMaxMessageSize" yaml:"websocket-max-message-size"`
+	NodeID                  string `mapstructure:"node-id" json:"nodeId" yaml:"node-id"`
+	AckTimeout              int    `mapstructure:"ack-timeout" json:"ackTimeout" yaml:"ack-timeout"`
+	AckRetries              int    `mapstructure:"ack-retries" json:"ackRetries" yaml:"ack-retries"`
+	RequestTimeout          int    `mapstructure:"request-timeout" json:"requestTimeout" yaml:"request-timeout"`
+	ShutdownTimeout         int    `mapstructure:"shutdown-timeout" json:"shutdownTimeout" yaml:"shutdown-timeout"`
+	SocketTLS               TLS    `mapstructure:"socket-tls" json:"socketTls" yaml:"socket-tls"`
+	WebsocketTLS            TLS    `mapstructure:"websocket-tls" json:"websocketTls" yaml:"websocket-tls"`
+}
+
+//TLS 信息
+type TLS struct {
+	Enable       bool     `mapstructure:"enable" json:"enable" yaml:"enable"`
+	CertFile     string   `mapstructure:"cert-file" json:"certFile" yaml:"cert-file"`
+	KeyFile      string   `mapstructure:"key-file" json:"keyFile" yaml:"key-file"`
+	MinVersion   string   `mapstructure:"min-version" json:"minVersion" yaml:"min-version"`
+	CipherSuites []string `mapstructure:"cipher-suites" json:"cipherSuites" yaml:"cipher-suites"`
+	ClientCA     string   `mapstructure:"client-ca" json:"clientCa" yaml:"client-ca"`
+	ClientAuth   string   `mapstructure:"client-auth" json:"clientAuth" yaml:"client-auth"`
+	CRLFile      string   `mapstructure:"crl-file" json:"crlFile" yaml:"crl-file"`
+	RevokedFile  string   `mapstructure:"revoked-file" json:"revokedFile" yaml:"revoked-file"`
+	UserIDFrom   string   `mapstructure:"user-id-from" json:"userIdFrom" yaml:"user-id-from"`
+	SourceIDFrom string   `mapstructure:"source-id-from" json:"sourceIdFrom" yaml:"source-id-from"`
 }
 
 //Redis 信息
 type Redis struct {
-	Host     string `mapstructure:"host" json:"host" yaml:"host"`
-	Port     int    `mapstructure:"port" json:"port" yaml:"port"`
-	Password string `mapstructure:"password" json:"password" yaml:"password"`
-	Database int    `mapstructure:"database" json:"database" yaml:"database"`
-	Timeout  int    `mapstructure:"timeout" json:"timeout" yaml:"timeout"`
+	Enable      bool   `mapstructure:"enable" json:"enable" yaml:"enable"`
+	Host        string `mapstructure:"host" json:"host" yaml:"host"`
+	Port        int    `mapstructure:"port" json:"port" yaml:"port"`
+	Password    string `mapstructure:"password" json:"password" yaml:"password"`
+	Database    int    `mapstructure:"database" json:"database" yaml:"database"`
+	Timeout     int    `mapstructure:"timeout" json:"timeout" yaml:"timeout"`
+	PresenceTTL int    `mapstructure:"presence-ttl" json:"presenceTtl" yaml:"presence-ttl"`
 }
 
 //Log 信息
@@ -35,3 +66,70 @@ type Log struct {
 	LogFile string `mapstructure:"log-file" json:"logFile" yaml:"log-file"`
 	Level   string `mapstructure:"level" json:"level" yaml:"level"`
 }
+
+//Offline 离线消息信息
+type Offline struct {
+	Enable  bool   `mapstructure:"enable" json:"enable" yaml:"enable"`
+	Backend string `mapstructure:"backend" json:"backend" yaml:"backend"`
+	Path    string `mapstructure:"path" json:"path" yaml:"path"`
+	MaxSize int    `mapstructure:"max-size" json:"maxSize" yaml:"max-size"`
+	TTL     int    `mapstructure:"ttl" json:"ttl" yaml:"ttl"`
+}
+
+//Auth 认证信息
+type Auth struct {
+	Enable         bool     `mapstructure:"enable" json:"enable" yaml:"enable"`
+	Methods        []string `mapstructure:"methods" json:"methods" yaml:"methods"`
+	Tokens         []Token  `mapstructure:"tokens" json:"tokens" yaml:"tokens"`
+	HMACSecret     string   `mapstructure:"hmac-secret" json:"hmacSecret" yaml:"hmac-secret"`
+	JWTSecret      string   `mapstructure:"jwt-secret" json:"jwtSecret" yaml:"jwt-secret"`
+	JWTPublicKey   string   `mapstructure:"jwt-public-key" json:"jwtPublicKey" yaml:"jwt-public-key"`
+	JWTIssuer      string   `mapstructure:"jwt-issuer" json:"jwtIssuer" yaml:"jwt-issuer"`
+	AllowedOrigins []string `mapstructure:"allowed-origins" json:"allowedOrigins" yaml:"allowed-origins"`
+	LoginTimeout   int      `mapstructure:"login-timeout" json:"loginTimeout" yaml:"login-timeout"`
+}
+
+//Token 静态令牌信息
+type Token struct {
+	Token    string `mapstructure:"token" json:"token" yaml:"token"`
+	UserID   string `mapstructure:"user-id" json:"userId" yaml:"user-id"`
+	SourceID string `mapstructure:"source-id" json:"sourceId" yaml:"source-id"`
+}
+
+//ACL 授权信息
+type ACL struct {
+	Enable      bool      `mapstructure:"enable" json:"enable" yaml:"enable"`
+	DefaultRole string    `mapstructure:"default-role" json:"defaultRole" yaml:"default-role"`
+	Users       []ACLUser `mapstructure:"users" json:"users" yaml:"users"`
+	Send        []ACLRule `mapstructure:"send" json:"send" yaml:"send"`
+	Receive     []ACLRule `mapstructure:"receive" json:"receive" yaml:"receive"`
+	AuditAllow  bool      `mapstructure:"audit-allow" json:"auditAllow" yaml:"audit-allow"`
+}
+
+//ACLUser 用户角色信息
+type ACLUser struct {
+	UserID string   `mapstructure:"user-id" json:"userId" yaml:"user-id"`
+	Roles  []string `mapstructure:"roles" json:"roles" yaml:"roles"`
+}
+
+//ACLRule 授权规则信息
+type ACLRule struct {
+	Roles   []string `mapstructure:"roles" json:"roles" yaml:"roles"`
+	OpTypes []string `mapstructure:"op-types" json:"opTypes" yaml:"op-types"`
+	Targets []string `mapstructure:"targets" json:"targets" yaml:"targets"`
+}
+
+//Admin 管理接口信息
+type Admin struct {
+	Enable bool   `mapstructure:"enable" json:"enable" yaml:"enable"`
+	Host   string `mapstructure:"host" json:"host" yaml:"host"`
+	Port   int    `mapstructure:"port" json:"port" yaml:"port"`
+	Token  string `mapstructure:"token" json:"token" yaml:"token"`
+}
+
+//Metrics 监控指标信息
+type Metrics struct {
+	Enable bool   `mapstructure:"enable" json:"enable" yaml:"enable"`
+	Host   string `mapstructure:"host" json:"host" yaml:"host"`
+	Port   int    `mapstructure:"port" json:"port" yaml:"port"`
+}
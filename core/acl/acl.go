@@ -0,0 +1,155 @@
+/*
+ * @Descripttion: 授权策略，按角色限制可发送、可接收的操作类型与投递目标
+ * @Author: chenjun
+ * @Date: 2026-10-18 22:14:09
+ */
+
+package acl
+
+import (
+	"fmt"
+	"go-cmd-transfer/config"
+	"path"
+)
+
+// 匹配所有角色的角色名
+const anyRole = "*"
+
+//Policy 授权策略，创建后不再修改，重新加载时整体替换，可并发使用
+type Policy struct {
+	// 未配置角色的用户账号使用的角色
+	defaultRole string
+	// 用户账号 ===> 角色列表
+	roles map[string][]string
+	// 发送规则
+	send []config.ACLRule
+	// 接收规则
+	receive []config.ACLRule
+}
+
+/*
+New 按配置创建授权策略
+ * @param c 授权配置
+ * @return: 未启用授权时返回 nil；规则中的通配符不合法时返回错误
+*/
+func New(c config.ACL) (*Policy, error) {
+	if !c.Enable {
+		return nil, nil
+	}
+	policy := &Policy{
+		defaultRole: c.DefaultRole,
+		roles:       make(map[string][]string),
+		send:        c.Send,
+		receive:     c.Receive,
+	}
+	for _, user := range c.Users {
+		policy.roles[user.UserID] = append(policy.roles[user.UserID], user.Roles...)
+	}
+	// 提前校验通配符，避免运行时按不匹配处理
+	for _, rules := range [][]config.ACLRule{c.Send, c.Receive} {
+		for _, rule := range rules {
+			for _, patterns := range [][]string{rule.OpTypes, rule.Targets} {
+				for _, pattern := range patterns {
+					if _, err := path.Match(pattern, ""); err != nil {
+						return nil, fmt.Errorf("invalid acl pattern %q: %w", pattern, err)
+					}
+				}
+			}
+		}
+	}
+	return policy, nil
+}
+
+//Roles 用户账号的角色，未配置时为默认角色
+func (p *Policy) Roles(userID string) []string {
+	if roles, ok := p.roles[userID]; ok && userID != "" {
+		return roles
+	}
+	if p.defaultRole == "" {
+		return nil
+	}
+	return []string{p.defaultRole}
+}
+
+/*
+AllowSend 判断用户能否发送操作类型到所有目标
+ * @param userID 发送方用户账号
+ * @param opType 操作类型
+ * @param targets 投递目标，形如 broadcast、user:xxx、source:xxx、conn:xxx、topic:xxx、reply，为空时只校验操作类型
+ * @return: 不允许时返回第一个不允许的目标
+*/
+func (p *Policy) AllowSend(userID string, opType string, targets []string) (bool, string) {
+	roles := p.Roles(userID)
+	if len(targets) == 0 {
+		return p.allow(p.send, roles, opType, ""), ""
+	}
+	for _, target := range targets {
+		if !p.allow(p.send, roles, opType, target) {
+			return false, target
+		}
+	}
+	return true, ""
+}
+
+/*
+AllowReceive 判断用户能否经任一目标接收操作类型
+ * @param userID 接收方用户账号
+ * @param opType 操作类型
+ * @param targets 接收方匹配的投递目标，形如 user:xxx、topic:xxx，为空时只校验操作类型
+ * @return: 接收规则未配置目标时不限制目标
+*/
+func (p *Policy) AllowReceive(userID string, opType string, targets []string) bool {
+	roles := p.Roles(userID)
+	for _, rule := range p.receive {
+		if !hasRole(rule.Roles, roles) || !matchAny(rule.OpTypes, opType) {
+			continue
+		}
+		if len(rule.Targets) == 0 || len(targets) == 0 {
+			return true
+		}
+		for _, target := range targets {
+			if matchAny(rule.Targets, target) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//allow 判断是否有规则允许，target 为空时不校验规则的目标
+func (p *Policy) allow(rules []config.ACLRule, roles []string, opType string, target string) bool {
+	for _, rule := range rules {
+		if !hasRole(rule.Roles, roles) || !matchAny(rule.OpTypes, opType) {
+			continue
+		}
+		if target == "" || matchAny(rule.Targets, target) {
+			return true
+		}
+	}
+	return false
+}
+
+//hasRole 判断规则的角色是否包含用户的任一角色
+func hasRole(ruleRoles []string, roles []string) bool {
+	for _, ruleRole := range ruleRoles {
+		if ruleRole == anyRole {
+			return true
+		}
+		for _, role := range roles {
+			if ruleRole == role {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//matchAny 判断是否匹配任一通配符，* 匹配除 / 外的任意字符
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package acl
+
+import (
+	"go-cmd-transfer/config"
+	"testing"
+)
+
+//testPolicy 测试用的授权策略
+func testPolicy(t *testing.T) *Policy {
+	t.Helper()
+	policy, err := New(config.ACL{
+		Enable:      true,
+		DefaultRole: "guest",
+		Users: []config.ACLUser{
+			{UserID: "console", Roles: []string{"operator"}},
+			{UserID: "dev-1", Roles: []string{"device"}},
+			{UserID: "screen", Roles: []string{"viewer"}},
+		},
+		Send: []config.ACLRule{
+			{Roles: []string{"operator"}, OpTypes: []string{"*"}, Targets: []string{"*"}},
+			{Roles: []string{"device"}, OpTypes: []string{"cmd.exec"}, Targets: []string{"reply", "user:console"}},
+			{Roles: []string{"*"}, OpTypes: []string{"subscribe"}, Targets: []string{"topic:public.*"}},
+		},
+		Receive: []config.ACLRule{
+			{Roles: []string{"operator", "device"}, OpTypes: []string{"*"}},
+			{Roles: []string{"viewer"}, OpTypes: []string{"publish"}, Targets: []string{"topic:public.*"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return policy
+}
+
+func TestAllowSend(t *testing.T) {
+	policy := testPolicy(t)
+	tests := []struct {
+		userID  string
+		opType  string
+		targets []string
+		allow   bool
+		denied  string
+	}{
+		{"console", "cmd.exec", []string{"user:dev-1", "broadcast"}, true, ""},
+		{"console", "anything", nil, true, ""},
+		{"dev-1", "cmd.exec", []string{"reply"}, true, ""},
+		{"dev-1", "cmd.exec", []string{"user:console"}, true, ""},
+		{"dev-1", "cmd.exec", []string{"user:console", "user:dev-2"}, false, "user:dev-2"},
+		{"dev-1", "cmd.exec", []string{"broadcast"}, false, "broadcast"},
+		{"dev-1", "publish", []string{"topic:public.news"}, false, "topic:public.news"},
+		{"dev-1", "subscribe", []string{"topic:public.news"}, true, ""},
+		{"stranger", "subscribe", []string{"topic:public.news"}, true, ""},
+		{"stranger", "subscribe", []string{"topic:private.news"}, false, "topic:private.news"},
+		{"stranger", "cmd.exec", nil, false, ""},
+		{"", "subscribe", []string{"topic:public.a"}, true, ""},
+	}
+	for _, tt := range tests {
+		allow, denied := policy.AllowSend(tt.userID, tt.opType, tt.targets)
+		if allow != tt.allow || denied != tt.denied {
+			t.Errorf("AllowSend(%q, %q, %v) = %v, %q, want %v, %q", tt.userID, tt.opType, tt.targets, allow, denied, tt.allow, tt.denied)
+		}
+	}
+}
+
+func TestAllowReceive(t *testing.T) {
+	policy := testPolicy(t)
+	tests := []struct {
+		userID  string
+		opType  string
+		targets []string
+		allow   bool
+	}{
+		{"console", "cmd.exec", []string{"user:console"}, true},
+		{"dev-1", "cmd.exec", []string{"broadcast"}, true},
+		{"screen", "publish", []string{"topic:public.news"}, true},
+		{"screen", "publish", []string{"topic:private.news", "topic:public.news"}, true},
+		{"screen", "publish", []string{"topic:private.news"}, false},
+		{"screen", "cmd.exec", []string{"user:screen"}, false},
+		{"screen", "publish", nil, true},
+		{"stranger", "cmd.exec", []string{"user:stranger"}, false},
+	}
+	for _, tt := range tests {
+		if allow := policy.AllowReceive(tt.userID, tt.opType, tt.targets); allow != tt.allow {
+			t.Errorf("AllowReceive(%q, %q, %v) = %v, want %v", tt.userID, tt.opType, tt.targets, allow, tt.allow)
+		}
+	}
+}
+
+func TestRoles(t *testing.T) {
+	policy := testPolicy(t)
+	if roles := policy.Roles("console"); len(roles) != 1 || roles[0] != "operator" {
+		t.Errorf("Roles(console) = %v", roles)
+	}
+	if roles := policy.Roles("stranger"); len(roles) != 1 || roles[0] != "guest" {
+		t.Errorf("Roles(stranger) = %v", roles)
+	}
+}
+
+func TestNewRejectsBadPattern(t *testing.T) {
+	_, err := New(config.ACL{Enable: true, Send: []config.ACLRule{{Roles: []string{"*"}, OpTypes: []string{"["}}}})
+	if err == nil {
+		t.Error("expected error for malformed pattern")
+	}
+	if policy, err := New(config.ACL{}); policy != nil || err != nil {
+		t.Errorf("disabled acl: got %v, %v", policy, err)
+	}
+}
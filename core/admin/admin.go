@@ -0,0 +1,203 @@
+/*
+ * @Descripttion: 管理接口，查询、关闭连接与下发消息
+ * @Author: chenjun
+ * @Date: 2026-10-19 09:12:30
+ */
+
+package admin
+
+import (
+	"crypto/subtle"
+	"go-cmd-transfer/core/auth"
+	"go-cmd-transfer/core/hub"
+	"go-cmd-transfer/core/presence"
+	"go-cmd-transfer/global"
+	"go-cmd-transfer/utils"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+//实例化工具类
+var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+const (
+	// 认证失败的响应编码
+	unauthorizedCode = "4010"
+	// 连接不存在的响应编码
+	notFoundCode = "4040"
+	// 请求方法不支持的响应编码
+	methodCode = "4050"
+	// 请求数据不合法的响应编码
+	badRequestCode = "4000"
+	// 下发消息的请求体长度上限
+	maxBodySize = 1 << 20
+	// 连接接口路径
+	connectionsPath = "/connections"
+)
+
+//ConnInfo 连接信息
+type ConnInfo struct {
+	ID            string    `json:"id"`                      // 连接标识
+	Protocol      string    `json:"protocol"`                // 协议 socket/websocket
+	Addr          string    `json:"addr"`                    // 网络地址
+	UserID        string    `json:"userId"`                  // 用户账号
+	SourceID      string    `json:"sourceId"`                // 接入端标识
+	ConnectedAt   time.Time `json:"connectedAt"`             // 连接时间
+	BytesIn       uint64    `json:"bytesIn"`                 // 读取的字节数
+	BytesOut      uint64    `json:"bytesOut"`                // 写入的字节数
+	Subscriptions []string  `json:"subscriptions,omitempty"` // 订阅的主题，只在连接详情中返回
+}
+
+//Server 管理接口服务
+type Server struct {
+	// 连接中心
+	hub *hub.Hub
+	// 管理令牌
+	token string
+}
+
+//New 创建管理接口服务，令牌为空时所有请求都认证失败
+func New(h *hub.Hub, token string) *Server {
+	return &Server{hub: h, token: token}
+}
+
+//Handler 管理接口的路由
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(connectionsPath, s.authorized(s.connections))
+	mux.HandleFunc(connectionsPath+"/", s.authorized(s.connection))
+	mux.HandleFunc("/messages", s.authorized(s.messages))
+	mux.HandleFunc("/presence", s.authorized(s.presence))
+	return mux
+}
+
+//authorized 校验管理令牌，令牌放在 Authorization: Bearer 请求头或 token 查询参数中
+func (s *Server) authorized(handler http.HandlerFunc) http.HandlerFunc {
+	return func(resp http.ResponseWriter, req *http.Request) {
+		token := auth.TokenFrom(req)
+		if s.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			s.hub.Logger().Warnf("[审计] 管理接口认证失败，请求地址：%s，请求：%s %s", req.RemoteAddr, req.Method, req.URL.Path)
+			write(resp, http.StatusUnauthorized, utils.FailCodeMessage(unauthorizedCode, "invalid admin token"))
+			return
+		}
+		handler(resp, req)
+	}
+}
+
+//connections GET 查询连接列表，可按 protocol、userId、sourceId 过滤
+func (s *Server) connections(resp http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		write(resp, http.StatusMethodNotAllowed, utils.FailCodeMessage(methodCode, "method not allowed"))
+		return
+	}
+	params := req.URL.Query()
+	userID, sourceID := params.Get("userId"), params.Get("sourceId")
+	infos := make([]ConnInfo, 0)
+	for _, conn := range s.hub.Conns(params.Get("protocol")) {
+		info := infoOf(conn)
+		if (userID != "" && info.UserID != userID) || (sourceID != "" && info.SourceID != sourceID) {
+			continue
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ConnectedAt.Before(infos[j].ConnectedAt)
+	})
+	write(resp, http.StatusOK, utils.SuccessWithData(infos))
+}
+
+//connection GET 查询连接详情，DELETE 关闭连接
+func (s *Server) connection(resp http.ResponseWriter, req *http.Request) {
+	connID := strings.TrimPrefix(req.URL.Path, connectionsPath+"/")
+	conn, ok := s.hub.Lookup(connID)
+	if !ok {
+		write(resp, http.StatusNotFound, utils.FailCodeMessage(notFoundCode, "connection not found"))
+		return
+	}
+	switch req.Method {
+	case http.MethodGet:
+		info := infoOf(conn)
+		info.Subscriptions = s.hub.Subscriptions(conn)
+		write(resp, http.StatusOK, utils.SuccessWithData(info))
+	case http.MethodDelete:
+		s.hub.Logger().Warnf("[审计] 管理接口关闭连接，请求地址：%s，连接标识：%s，连接地址：%s", req.RemoteAddr, conn.ID(), conn.Addr())
+		conn.Close()
+		write(resp, http.StatusOK, utils.SuccessWithMessage("closed"))
+	default:
+		write(resp, http.StatusMethodNotAllowed, utils.FailCodeMessage(methodCode, "method not allowed"))
+	}
+}
+
+//messages POST 按业务数据的投递目标下发消息，返回消息标识
+func (s *Server) messages(resp http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		write(resp, http.StatusMethodNotAllowed, utils.FailCodeMessage(methodCode, "method not allowed"))
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(resp, req.Body, maxBodySize))
+	if err != nil {
+		write(resp, http.StatusBadRequest, utils.FailCodeMessage(badRequestCode, err.Error()))
+		return
+	}
+	busData := global.BusinessData{}
+	if err := json.Unmarshal(body, &busData); err != nil {
+		write(resp, http.StatusBadRequest, utils.FailCodeMessage(badRequestCode, err.Error()))
+		return
+	}
+	busData.MsgID = utils.Get32UUID()
+	if err := s.hub.Dispatch(busData); err != nil {
+		write(resp, http.StatusBadRequest, utils.FailCodeMessage(badRequestCode, err.Error()))
+		return
+	}
+	s.hub.Logger().Infof("[审计] 管理接口下发消息，请求地址：%s，消息标识：%s，投递模式：%s，投递目标：%v", req.RemoteAddr, busData.MsgID, busData.Mode, busData.Targets)
+	write(resp, http.StatusOK, utils.SuccessWithData(map[string]string{"msgId": busData.MsgID}))
+}
+
+//presence GET 查询在线连接，启用集群时查询整个集群，可按 userId、sourceId、protocol、node 过滤
+func (s *Server) presence(resp http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		write(resp, http.StatusMethodNotAllowed, utils.FailCodeMessage(methodCode, "method not allowed"))
+		return
+	}
+	params := req.URL.Query()
+	entries, err := s.hub.Presence(presence.Query{
+		UserID:   params.Get("userId"),
+		SourceID: params.Get("sourceId"),
+		Protocol: params.Get("protocol"),
+		Node:     params.Get("node"),
+	})
+	if err != nil {
+		s.hub.Logger().Error("查询在线连接失败", err.Error())
+		write(resp, http.StatusInternalServerError, utils.FailWithMessage(err.Error()))
+		return
+	}
+	write(resp, http.StatusOK, utils.SuccessWithData(entries))
+}
+
+//infoOf 连接信息
+func infoOf(conn hub.Conn) ConnInfo {
+	userID, sourceID := conn.Identity()
+	bytesIn, bytesOut := conn.Stats()
+	return ConnInfo{
+		ID:          conn.ID(),
+		Protocol:    conn.Protocol(),
+		Addr:        conn.Addr(),
+		UserID:      userID,
+		SourceID:    sourceID,
+		ConnectedAt: conn.ConnectedAt(),
+		BytesIn:     bytesIn,
+		BytesOut:    bytesOut,
+	}
+}
+
+//write 写入json响应
+func write(resp http.ResponseWriter, status int, body string) {
+	resp.Header().Set("Content-Type", "application/json; charset=utf-8")
+	resp.WriteHeader(status)
+	resp.Write([]byte(body))
+}
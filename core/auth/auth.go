@@ -0,0 +1,148 @@
+/*
+ * @Descripttion: 连接认证，校验客户端令牌并得到连接身份
+ * @Author: chenjun
+ * @Date: 2026-10-18 20:41:05
+ */
+
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"go-cmd-transfer/config"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	//MethodToken 配置文件中的静态令牌
+	MethodToken = "token"
+	//MethodHMAC HMAC-SHA256签名的带过期时间的令牌
+	MethodHMAC = "hmac"
+	//MethodJWT HS256/RS256签名的JWT
+	MethodJWT = "jwt"
+
+	// 查询参数中的令牌参数名
+	tokenParam = "token"
+	// 请求头中的令牌前缀
+	bearerPrefix = "Bearer "
+)
+
+var (
+	//ErrMissingToken 请求未携带令牌
+	ErrMissingToken = errors.New("missing token")
+	//ErrInvalidToken 令牌不合法或签名不一致
+	ErrInvalidToken = errors.New("invalid token")
+	//ErrExpiredToken 令牌已过期
+	ErrExpiredToken = errors.New("token expired")
+	//ErrInvalidCredentials 账号密码不一致
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	//ErrMissingUserID 认证得到的身份没有用户账号
+	ErrMissingUserID = errors.New("identity without user id")
+)
+
+//Identity 认证得到的连接身份
+type Identity struct {
+	// 用户账号
+	UserID string `json:"userId"`
+	// 接入端标识
+	SourceID string `json:"sourceId"`
+}
+
+//Authenticator 认证器，校验令牌并返回连接身份，可并发使用
+type Authenticator interface {
+	Authenticate(token string) (Identity, error)
+}
+
+//PasswordAuthenticator 支持账号密码认证的认证器
+type PasswordAuthenticator interface {
+	AuthenticatePassword(userID string, password string) (Identity, error)
+}
+
+//Chain 按顺序尝试多个认证器，任一认证通过即通过
+type Chain []Authenticator
+
+//Authenticate 按顺序尝试认证，都不通过时返回最后一个错误
+func (chain Chain) Authenticate(token string) (Identity, error) {
+	if token == "" {
+		return Identity{}, ErrMissingToken
+	}
+	err := ErrInvalidToken
+	for _, authenticator := range chain {
+		var identity Identity
+		if identity, err = authenticator.Authenticate(token); err == nil {
+			return identity, nil
+		}
+	}
+	return Identity{}, err
+}
+
+//AuthenticatePassword 按顺序尝试支持账号密码认证的认证器
+func (chain Chain) AuthenticatePassword(userID string, password string) (Identity, error) {
+	if userID == "" || password == "" {
+		return Identity{}, ErrInvalidCredentials
+	}
+	for _, authenticator := range chain {
+		if passwordAuthenticator, ok := authenticator.(PasswordAuthenticator); ok {
+			if identity, err := passwordAuthenticator.AuthenticatePassword(userID, password); err == nil {
+				return identity, nil
+			}
+		}
+	}
+	return Identity{}, ErrInvalidCredentials
+}
+
+/*
+New 按配置创建认证器
+ * @param c 认证配置
+ * @return: 未启用认证时返回 nil；认证方式不支持或密钥加载失败时返回错误
+*/
+func New(c config.Auth) (Authenticator, error) {
+	if !c.Enable {
+		return nil, nil
+	}
+	var chain Chain
+	for _, method := range c.Methods {
+		switch method {
+		case MethodToken:
+			chain = append(chain, NewStaticTokens(c.Tokens))
+		case MethodHMAC:
+			if c.HMACSecret == "" {
+				return nil, errors.New("auth method hmac requires hmac-secret")
+			}
+			chain = append(chain, NewHMAC([]byte(c.HMACSecret)))
+		case MethodJWT:
+			authenticator, err := NewJWTFromConfig(c)
+			if err != nil {
+				return nil, err
+			}
+			chain = append(chain, authenticator)
+		default:
+			return nil, fmt.Errorf("unsupported auth method: %s", method)
+		}
+	}
+	if len(chain) == 0 {
+		return nil, errors.New("auth enabled without methods")
+	}
+	return chain, nil
+}
+
+//RequireUser 认证得到的身份必须包含用户账号，否则连接会按首个报文中的用户账号绑定身份，可以冒用其他用户
+func RequireUser(identity Identity, err error) (Identity, error) {
+	if err == nil && identity.UserID == "" {
+		return Identity{}, ErrMissingUserID
+	}
+	return identity, err
+}
+
+//TokenFrom 从请求中获取令牌，优先使用 Authorization: Bearer 请求头，其次使用 token 查询参数
+func TokenFrom(req *http.Request) string {
+	if header := req.Header.Get("Authorization"); strings.HasPrefix(header, bearerPrefix) {
+		return strings.TrimSpace(header[len(bearerPrefix):])
+	}
+	return req.URL.Query().Get(tokenParam)
+}
+
+//now 当前时间，用于校验过期时间
+var now = time.Now
@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"errors"
+	"go-cmd-transfer/config"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStaticTokens(t *testing.T) {
+	s := NewStaticTokens([]config.Token{
+		{Token: "console-token", UserID: "console", SourceID: "web"},
+		{Token: "", UserID: "empty"},
+	})
+	tests := []struct {
+		name     string
+		token    string
+		identity Identity
+		err      error
+	}{
+		{"known token", "console-token", Identity{UserID: "console", SourceID: "web"}, nil},
+		{"unknown token", "other", Identity{}, ErrInvalidToken},
+		{"prefix of a token", "console", Identity{}, ErrInvalidToken},
+		{"empty token never matches", "", Identity{}, ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		identity, err := s.Authenticate(tt.token)
+		if identity != tt.identity || !errors.Is(err, tt.err) {
+			t.Errorf("%s: got %+v, %v, want %+v, %v", tt.name, identity, err, tt.identity, tt.err)
+		}
+	}
+	passwords := []struct {
+		name     string
+		userID   string
+		password string
+		err      error
+	}{
+		{"token as password", "console", "console-token", nil},
+		{"wrong password", "console", "other", ErrInvalidCredentials},
+		{"token of another user", "empty", "console-token", ErrInvalidCredentials},
+		{"empty password", "empty", "", ErrInvalidCredentials},
+	}
+	for _, tt := range passwords {
+		if _, err := s.AuthenticatePassword(tt.userID, tt.password); !errors.Is(err, tt.err) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestChain(t *testing.T) {
+	chain, err := New(config.Auth{
+		Enable:     true,
+		Methods:    []string{MethodToken, MethodHMAC},
+		Tokens:     []config.Token{{Token: "console-token", UserID: "console"}},
+		HMACSecret: "secret",
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	signed, _ := NewHMAC([]byte("secret")).Sign(Identity{UserID: "device"}, time.Minute)
+	tests := []struct {
+		name   string
+		token  string
+		userID string
+		err    error
+	}{
+		{"static token", "console-token", "console", nil},
+		{"hmac token", signed, "device", nil},
+		{"missing token", "", "", ErrMissingToken},
+		{"unknown token", "other", "", ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		identity, err := chain.Authenticate(tt.token)
+		if identity.UserID != tt.userID || !errors.Is(err, tt.err) {
+			t.Errorf("%s: got %+v, %v, want user %q, %v", tt.name, identity, err, tt.userID, tt.err)
+		}
+	}
+	if _, err := chain.(PasswordAuthenticator).AuthenticatePassword("console", "console-token"); err != nil {
+		t.Errorf("AuthenticatePassword: %v", err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		c       config.Auth
+		enabled bool
+		wantErr bool
+	}{
+		{"disabled", config.Auth{Methods: []string{MethodToken}}, false, false},
+		{"token", config.Auth{Enable: true, Methods: []string{MethodToken}}, true, false},
+		{"hmac without secret", config.Auth{Enable: true, Methods: []string{MethodHMAC}}, false, true},
+		{"jwt without key", config.Auth{Enable: true, Methods: []string{MethodJWT}}, false, true},
+		{"unsupported method", config.Auth{Enable: true, Methods: []string{"basic"}}, false, true},
+		{"no methods", config.Auth{Enable: true}, false, true},
+	}
+	for _, tt := range tests {
+		authenticator, err := New(tt.c)
+		if (err != nil) != tt.wantErr || (authenticator != nil) != tt.enabled {
+			t.Errorf("%s: got %v, %v", tt.name, authenticator, err)
+		}
+	}
+}
+
+func TestRequireUser(t *testing.T) {
+	if _, err := RequireUser(Identity{SourceID: "kiosk"}, nil); !errors.Is(err, ErrMissingUserID) {
+		t.Errorf("source only: got %v, want %v", err, ErrMissingUserID)
+	}
+	if _, err := RequireUser(Identity{}, ErrInvalidToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("failed authentication: got %v, want %v", err, ErrInvalidToken)
+	}
+	if identity, err := RequireUser(Identity{UserID: "console"}, nil); err != nil || identity.UserID != "console" {
+		t.Errorf("user: got %+v, %v", identity, err)
+	}
+}
+
+func TestTokenFrom(t *testing.T) {
+	tests := []struct {
+		name   string
+		url    string
+		header string
+		token  string
+	}{
+		{"bearer header", "/ws", "Bearer abc", "abc"},
+		{"bearer header with spaces", "/ws", "Bearer  abc ", "abc"},
+		{"query parameter", "/ws?token=abc", "", "abc"},
+		{"header before query", "/ws?token=query", "Bearer header", "header"},
+		{"other scheme falls back to query", "/ws?token=query", "Basic abc", "query"},
+		{"missing", "/ws", "", ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.url, nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		if got := TokenFrom(req); got != tt.token {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.token)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+/*
+ * @Descripttion: HMAC-SHA256签名的带过期时间的令牌
+ * @Author: chenjun
+ * @Date: 2026-10-18 20:52:19
+ */
+
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+//实例化工具类
+var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+//hmacClaims HMAC令牌中的身份与过期时间
+type hmacClaims struct {
+	Identity
+	// 过期时间，unix秒
+	ExpiresAt int64 `json:"exp"`
+}
+
+//HMAC 校验 base64url(身份与过期时间JSON).base64url(HMAC-SHA256签名) 格式的令牌
+type HMAC struct {
+	secret []byte
+}
+
+//NewHMAC 创建HMAC令牌认证
+func NewHMAC(secret []byte) *HMAC {
+	return &HMAC{secret: secret}
+}
+
+/*
+Sign 签发令牌，供业务系统或客户端SDK使用
+ * @param identity 连接身份
+ * @param ttl 有效时长
+ * @return: 令牌
+*/
+func (a *HMAC) Sign(identity Identity, ttl time.Duration) (string, error) {
+	payload, err := json.Marshal(hmacClaims{identity, now().Add(ttl).Unix()})
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(a.sign(encoded)), nil
+}
+
+//Authenticate 校验签名与过期时间
+func (a *HMAC) Authenticate(token string) (Identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return Identity{}, ErrInvalidToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(signature, a.sign(parts[0])) {
+		return Identity{}, ErrInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return Identity{}, ErrInvalidToken
+	}
+	claims := hmacClaims{}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.UserID == "" {
+		return Identity{}, ErrInvalidToken
+	}
+	if now().Unix() >= claims.ExpiresAt {
+		return Identity{}, ErrExpiredToken
+	}
+	return claims.Identity, nil
+}
+
+//sign 计算签名
+func (a *HMAC) sign(payload string) []byte {
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
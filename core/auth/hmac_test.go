@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+//fixNow 固定当前时间，测试结束时恢复
+func fixNow(t *testing.T, at time.Time) {
+	t.Helper()
+	now = func() time.Time { return at }
+	t.Cleanup(func() { now = time.Now })
+}
+
+func TestHMAC(t *testing.T) {
+	issued := time.Unix(1700000000, 0)
+	fixNow(t, issued)
+	a := NewHMAC([]byte("secret"))
+	token, err := a.Sign(Identity{UserID: "device", SourceID: "d-1"}, time.Minute)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	other, _ := NewHMAC([]byte("other")).Sign(Identity{UserID: "device"}, time.Minute)
+	anonymous, _ := a.Sign(Identity{SourceID: "d-1"}, time.Minute)
+	parts := strings.Split(token, ".")
+	tampered := base64.RawURLEncoding.EncodeToString([]byte(`{"userId":"admin","exp":9999999999}`)) + "." + parts[1]
+	tests := []struct {
+		name  string
+		token string
+		at    time.Time
+		err   error
+	}{
+		{"valid", token, issued, nil},
+		{"just before expiry", token, issued.Add(time.Minute - time.Second), nil},
+		{"expired", token, issued.Add(time.Minute), ErrExpiredToken},
+		{"signed with another secret", other, issued, ErrInvalidToken},
+		{"tampered payload", tampered, issued, ErrInvalidToken},
+		{"without user id", anonymous, issued, ErrInvalidToken},
+		{"bad signature encoding", parts[0] + ".!!", issued, ErrInvalidToken},
+		{"missing signature", parts[0], issued, ErrInvalidToken},
+		{"too many parts", token + ".x", issued, ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		fixNow(t, tt.at)
+		identity, err := a.Authenticate(tt.token)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.err)
+			continue
+		}
+		if err == nil && (identity != Identity{UserID: "device", SourceID: "d-1"}) {
+			t.Errorf("%s: got identity %+v", tt.name, identity)
+		}
+	}
+}
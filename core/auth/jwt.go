@@ -0,0 +1,171 @@
+/*
+ * @Descripttion: HS256/RS256签名的JWT
+ * @Author: chenjun
+ * @Date: 2026-10-18 21:03:40
+ */
+
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"go-cmd-transfer/config"
+	"io/ioutil"
+	"strings"
+)
+
+const (
+	//AlgHS256 HMAC-SHA256签名
+	AlgHS256 = "HS256"
+	//AlgRS256 RSA-SHA256签名
+	AlgRS256 = "RS256"
+)
+
+//jwtHeader JWT头部
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+}
+
+//jwtClaims JWT中使用的声明，用户账号优先使用 userId，其次使用 sub
+type jwtClaims struct {
+	Subject   string `json:"sub"`
+	UserID    string `json:"userId"`
+	SourceID  string `json:"sourceId"`
+	Issuer    string `json:"iss"`
+	ExpiresAt int64  `json:"exp"`
+	NotBefore int64  `json:"nbf"`
+}
+
+//JWT 校验JWT，只接受配置了密钥的签名算法，必须带过期时间
+type JWT struct {
+	// HS256密钥
+	secret []byte
+	// RS256公钥
+	publicKey *rsa.PublicKey
+	// 签发者，为空时不校验
+	issuer string
+}
+
+//NewJWT 创建JWT认证，secret 与 publicKey 至少设置一个
+func NewJWT(secret []byte, publicKey *rsa.PublicKey, issuer string) *JWT {
+	return &JWT{secret: secret, publicKey: publicKey, issuer: issuer}
+}
+
+//NewJWTFromConfig 按配置创建JWT认证，RS256公钥从PEM文件加载
+func NewJWTFromConfig(c config.Auth) (*JWT, error) {
+	var publicKey *rsa.PublicKey
+	if c.JWTPublicKey != "" {
+		data, err := ioutil.ReadFile(c.JWTPublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("read jwt public key: %w", err)
+		}
+		if publicKey, err = ParseRSAPublicKey(data); err != nil {
+			return nil, err
+		}
+	}
+	if c.JWTSecret == "" && publicKey == nil {
+		return nil, errors.New("auth method jwt requires jwt-secret or jwt-public-key")
+	}
+	return NewJWT([]byte(c.JWTSecret), publicKey, c.JWTIssuer), nil
+}
+
+//ParseRSAPublicKey 解析PEM格式的RSA公钥，支持PKIX、PKCS1公钥与证书
+func ParseRSAPublicKey(data []byte) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("jwt public key is not PEM encoded")
+	}
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		var cert *x509.Certificate
+		if cert, err = x509.ParseCertificate(block.Bytes); err == nil {
+			key = cert.PublicKey
+		}
+	default:
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse jwt public key: %w", err)
+	}
+	publicKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("jwt public key is not an RSA key")
+	}
+	return publicKey, nil
+}
+
+//Authenticate 校验签名、过期时间、生效时间与签发者
+func (a *JWT) Authenticate(token string) (Identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Identity{}, ErrInvalidToken
+	}
+	header := jwtHeader{}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return Identity{}, ErrInvalidToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Identity{}, ErrInvalidToken
+	}
+	signed := parts[0] + "." + parts[1]
+	digest := sha256.Sum256([]byte(signed))
+	// 按头部声明的算法校验，算法未配置密钥时拒绝，避免算法替换
+	switch {
+	case header.Alg == AlgHS256 && len(a.secret) > 0:
+		mac := hmac.New(sha256.New, a.secret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return Identity{}, ErrInvalidToken
+		}
+	case header.Alg == AlgRS256 && a.publicKey != nil:
+		if rsa.VerifyPKCS1v15(a.publicKey, crypto.SHA256, digest[:], signature) != nil {
+			return Identity{}, ErrInvalidToken
+		}
+	default:
+		return Identity{}, fmt.Errorf("%w: unsupported alg %q", ErrInvalidToken, header.Alg)
+	}
+	claims := jwtClaims{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return Identity{}, ErrInvalidToken
+	}
+	current := now().Unix()
+	if claims.ExpiresAt == 0 || current >= claims.ExpiresAt {
+		return Identity{}, ErrExpiredToken
+	}
+	if claims.NotBefore != 0 && current < claims.NotBefore {
+		return Identity{}, fmt.Errorf("%w: not valid yet", ErrInvalidToken)
+	}
+	if a.issuer != "" && claims.Issuer != a.issuer {
+		return Identity{}, fmt.Errorf("%w: unexpected issuer", ErrInvalidToken)
+	}
+	identity := Identity{UserID: claims.UserID, SourceID: claims.SourceID}
+	if identity.UserID == "" {
+		identity.UserID = claims.Subject
+	}
+	if identity.UserID == "" {
+		return Identity{}, fmt.Errorf("%w: missing subject", ErrInvalidToken)
+	}
+	return identity, nil
+}
+
+//decodeSegment 解码base64url编码的JSON片段
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	stdjson "encoding/json"
+	"encoding/pem"
+	"errors"
+	"go-cmd-transfer/config"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// claims JWT声明
+type claims map[string]interface{}
+
+// signJWT 按算法签发JWT，key 为HS256密钥或RS256私钥，alg 为 none 时不签名
+func signJWT(t *testing.T, alg string, key interface{}, c claims) string {
+	t.Helper()
+	header, _ := stdjson.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	payload, err := stdjson.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	var signature []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		digest := sha256.Sum256([]byte(signed))
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestJWT(t *testing.T) {
+	issued := time.Unix(1700000000, 0)
+	fixNow(t, issued)
+	secret := []byte("secret")
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&privateKey.PublicKey)})
+	exp, past, future := issued.Add(time.Minute).Unix(), issued.Add(-time.Second).Unix(), issued.Add(time.Second).Unix()
+	both := NewJWT(secret, &privateKey.PublicKey, "")
+	tests := []struct {
+		name   string
+		a      *JWT
+		token  string
+		userID string
+		err    error
+	}{
+		{"HS256", both, signJWT(t, AlgHS256, secret, claims{"userId": "device", "sourceId": "d-1", "exp": exp}), "device", nil},
+		{"RS256", both, signJWT(t, AlgRS256, privateKey, claims{"userId": "device", "exp": exp}), "device", nil},
+		{"sub as user id", both, signJWT(t, AlgHS256, secret, claims{"sub": "console", "exp": exp}), "console", nil},
+		{"userId before sub", both, signJWT(t, AlgHS256, secret, claims{"sub": "console", "userId": "device", "exp": exp}), "device", nil},
+		{"HS256 with another secret", both, signJWT(t, AlgHS256, []byte("other"), claims{"userId": "device", "exp": exp}), "", ErrInvalidToken},
+		{"alg none", both, signJWT(t, "none", nil, claims{"userId": "device", "exp": exp}), "", ErrInvalidToken},
+		{"unexpected alg", both, signJWT(t, "HS512", secret, claims{"userId": "device", "exp": exp}), "", ErrInvalidToken},
+		{"HS256 signed with the public key", NewJWT(nil, &privateKey.PublicKey, ""), signJWT(t, AlgHS256, publicPEM, claims{"userId": "device", "exp": exp}), "", ErrInvalidToken},
+		{"RS256 without public key configured", NewJWT(secret, nil, ""), signJWT(t, AlgRS256, privateKey, claims{"userId": "device", "exp": exp}), "", ErrInvalidToken},
+		{"missing exp", both, signJWT(t, AlgHS256, secret, claims{"userId": "device"}), "", ErrExpiredToken},
+		{"expired", both, signJWT(t, AlgHS256, secret, claims{"userId": "device", "exp": issued.Unix()}), "", ErrExpiredToken},
+		{"nbf in the past", both, signJWT(t, AlgHS256, secret, claims{"userId": "device", "exp": exp, "nbf": past}), "device", nil},
+		{"nbf in the future", both, signJWT(t, AlgHS256, secret, claims{"userId": "device", "exp": exp, "nbf": future}), "", ErrInvalidToken},
+		{"expected issuer", NewJWT(secret, nil, "sso"), signJWT(t, AlgHS256, secret, claims{"userId": "device", "exp": exp, "iss": "sso"}), "device", nil},
+		{"unexpected issuer", NewJWT(secret, nil, "sso"), signJWT(t, AlgHS256, secret, claims{"userId": "device", "exp": exp, "iss": "other"}), "", ErrInvalidToken},
+		{"missing issuer", NewJWT(secret, nil, "sso"), signJWT(t, AlgHS256, secret, claims{"userId": "device", "exp": exp}), "", ErrInvalidToken},
+		{"missing subject", both, signJWT(t, AlgHS256, secret, claims{"sourceId": "d-1", "exp": exp}), "", ErrInvalidToken},
+		{"malformed", both, "a.b", "", ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		identity, err := tt.a.Authenticate(tt.token)
+		if identity.UserID != tt.userID || !errors.Is(err, tt.err) {
+			t.Errorf("%s: got %+v, %v, want user %q, %v", tt.name, identity, err, tt.userID, tt.err)
+		}
+	}
+}
+
+func TestNewJWTFromConfig(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkix, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "jwt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	keyFile := filepath.Join(dir, "public.pem")
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pkix}), 0600)
+	a, err := NewJWTFromConfig(config.Auth{JWTPublicKey: keyFile})
+	if err != nil {
+		t.Fatalf("NewJWTFromConfig: %v", err)
+	}
+	token := signJWT(t, AlgRS256, privateKey, claims{"userId": "device", "exp": time.Now().Add(time.Minute).Unix()})
+	if identity, err := a.Authenticate(token); err != nil || identity.UserID != "device" {
+		t.Errorf("Authenticate: got %+v, %v", identity, err)
+	}
+	if _, err := NewJWTFromConfig(config.Auth{JWTPublicKey: filepath.Join(dir, "missing.pem")}); err == nil {
+		t.Error("missing public key file: expected an error")
+	}
+	if _, err := ParseRSAPublicKey([]byte("not pem")); err == nil {
+		t.Error("ParseRSAPublicKey: expected an error for non-PEM data")
+	}
+}
@@ -0,0 +1,42 @@
+/*
+ * @Descripttion: 配置文件中的静态令牌
+ * @Author: chenjun
+ * @Date: 2026-10-18 20:46:52
+ */
+
+package auth
+
+import (
+	"crypto/subtle"
+	"go-cmd-transfer/config"
+)
+
+//StaticTokens 静态令牌认证，令牌与身份一一对应，令牌也可以作为用户账号的密码
+type StaticTokens struct {
+	tokens []config.Token
+}
+
+//NewStaticTokens 创建静态令牌认证
+func NewStaticTokens(tokens []config.Token) *StaticTokens {
+	return &StaticTokens{tokens: tokens}
+}
+
+//Authenticate 查找令牌对应的身份，逐个比较令牌避免按耗时猜测
+func (s *StaticTokens) Authenticate(token string) (Identity, error) {
+	for _, t := range s.tokens {
+		if t.Token != "" && subtle.ConstantTimeCompare([]byte(t.Token), []byte(token)) == 1 {
+			return Identity{UserID: t.UserID, SourceID: t.SourceID}, nil
+		}
+	}
+	return Identity{}, ErrInvalidToken
+}
+
+//AuthenticatePassword 以用户账号的令牌作为密码认证
+func (s *StaticTokens) AuthenticatePassword(userID string, password string) (Identity, error) {
+	for _, t := range s.tokens {
+		if t.Token != "" && t.UserID == userID && subtle.ConstantTimeCompare([]byte(t.Token), []byte(password)) == 1 {
+			return Identity{UserID: t.UserID, SourceID: t.SourceID}, nil
+		}
+	}
+	return Identity{}, ErrInvalidCredentials
+}
@@ -0,0 +1,74 @@
+/*
+ * @Descripttion: TLS配置，证书文件变化时自动重新加载
+ * @Author: chenjun
+ * @Date: 2026-10-18 23:02:47
+ */
+
+package certificate
+
+import (
+	"crypto/tls"
+	"fmt"
+	"go-cmd-transfer/config"
+	"strings"
+)
+
+// TLS版本名称
+var versions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+/*
+New 按配置创建服务端TLS配置，证书由重新加载器提供
+ * @param c TLS配置
+ * @return: 未启用TLS时返回 nil；证书加载失败、版本或加密套件不支持时返回错误
+*/
+func New(c config.TLS) (*tls.Config, *Reloader, error) {
+	if !c.Enable {
+		return nil, nil, nil
+	}
+	minVersion := uint16(tls.VersionTLS12)
+	if c.MinVersion != "" {
+		version, ok := versions[c.MinVersion]
+		if !ok {
+			return nil, nil, fmt.Errorf("unsupported tls min-version: %s", c.MinVersion)
+		}
+		minVersion = version
+	}
+	cipherSuites, err := parseCipherSuites(c.CipherSuites)
+	if err != nil {
+		return nil, nil, err
+	}
+	reloader, err := NewReloader(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &tls.Config{
+		MinVersion:     minVersion,
+		CipherSuites:   cipherSuites,
+		GetCertificate: reloader.GetCertificate,
+	}, reloader, nil
+}
+
+//parseCipherSuites 按名称解析加密套件，只允许标准库认为安全的套件，TLS1.3的套件不可配置
+func parseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	known := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := known[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("unsupported tls cipher suite: %s", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
@@ -0,0 +1,232 @@
+/*
+ * @Descripttion: 客户端证书认证，按证书得到连接身份
+ * @Author: chenjun
+ * @Date: 2026-10-18 23:52:06
+ */
+
+package certificate
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"go-cmd-transfer/config"
+	"go-cmd-transfer/core/auth"
+	"io/ioutil"
+	"sync"
+
+	logger "github.com/sirupsen/logrus"
+)
+
+const (
+	//ClientAuthRequest 客户端提供证书时校验，不提供时按普通连接处理
+	ClientAuthRequest = "request"
+	//ClientAuthRequire 客户端必须提供可信的证书
+	ClientAuthRequire = "require"
+
+	//FieldCN 证书主题的CN
+	FieldCN = "cn"
+	//FieldDNS 证书的第一个DNS类型SAN
+	FieldDNS = "dns"
+	//FieldURI 证书的第一个URI类型SAN
+	FieldURI = "uri"
+	//FieldEmail 证书的第一个邮箱类型SAN
+	FieldEmail = "email"
+)
+
+//errRevoked 客户端证书已吊销
+var errRevoked = errors.New("client certificate revoked")
+
+//ClientAuth 客户端证书认证
+type ClientAuth struct {
+	// 用户账号取自证书的字段
+	userField string
+	// 接入端标识取自证书的字段
+	sourceField string
+	// 吊销列表
+	revocation *Revocation
+	// 已认证连接锁
+	mutex sync.Mutex
+	// 提供了证书的连接，吊销列表重新加载后检查
+	conns map[*trackedConn]bool
+}
+
+//trackedConn 提供了证书的连接
+type trackedConn struct {
+	// 客户端证书
+	cert *x509.Certificate
+	// 网络地址
+	addr string
+	// 关闭连接
+	close func()
+}
+
+/*
+NewClientAuth 按配置在服务端TLS配置上启用客户端证书认证
+ * @param c TLS配置
+ * @param tlsConfig 服务端TLS配置，设置可信CA、认证方式与吊销检查
+ * @return: 未配置客户端CA时返回 nil；CA、吊销列表加载失败或配置不支持时返回错误
+*/
+func NewClientAuth(c config.TLS, tlsConfig *tls.Config) (*ClientAuth, error) {
+	if c.ClientCA == "" || tlsConfig == nil {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(c.ClientCA)
+	if err != nil {
+		return nil, fmt.Errorf("read client ca: %w", err)
+	}
+	cas, err := parseCertificates(data)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	for _, ca := range cas {
+		pool.AddCert(ca)
+	}
+	switch c.ClientAuth {
+	case "", ClientAuthRequire:
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	case ClientAuthRequest:
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	default:
+		return nil, fmt.Errorf("unsupported tls client-auth: %s", c.ClientAuth)
+	}
+	for _, field := range []string{c.UserIDFrom, c.SourceIDFrom} {
+		switch field {
+		case "", FieldCN, FieldDNS, FieldURI, FieldEmail:
+		default:
+			return nil, fmt.Errorf("unsupported certificate identity field: %s", field)
+		}
+	}
+	revocation, err := NewRevocation(c.CRLFile, c.RevokedFile, cas)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig.ClientCAs = pool
+	// 证书链校验通过后检查客户端证书是否已吊销
+	tlsConfig.VerifyPeerCertificate = func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		for _, chain := range verifiedChains {
+			if len(chain) > 0 && revocation.Revoked(chain[0]) {
+				return fmt.Errorf("%w: serial %s", errRevoked, chain[0].SerialNumber.Text(16))
+			}
+		}
+		return nil
+	}
+	a := &ClientAuth{userField: c.UserIDFrom, sourceField: c.SourceIDFrom, revocation: revocation, conns: make(map[*trackedConn]bool)}
+	revocation.OnReload(a.recheck)
+	return a, nil
+}
+
+/*
+Identity 按已校验的客户端证书得到连接身份
+ * @param state 握手完成后的连接状态
+ * @return: 身份；未提供证书或证书中没有配置的字段时返回 false
+*/
+func (a *ClientAuth) Identity(state tls.ConnectionState) (auth.Identity, bool) {
+	cert := leafOf(state)
+	if cert == nil {
+		return auth.Identity{}, false
+	}
+	identity := auth.Identity{UserID: fieldOf(cert, a.userField), SourceID: fieldOf(cert, a.sourceField)}
+	return identity, identity.UserID != "" || identity.SourceID != ""
+}
+
+/*
+Track 记录提供了证书的连接，吊销列表重新加载后证书已吊销时关闭该连接
+ * @param state 握手完成后的连接状态
+ * @param addr 网络地址，用于日志
+ * @param close 关闭连接
+ * @return: 连接关闭后调用以停止记录；未提供证书时不记录
+*/
+func (a *ClientAuth) Track(state tls.ConnectionState, addr string, close func()) (untrack func()) {
+	cert := leafOf(state)
+	if cert == nil {
+		return func() {}
+	}
+	conn := &trackedConn{cert: cert, addr: addr, close: close}
+	a.mutex.Lock()
+	a.conns[conn] = true
+	a.mutex.Unlock()
+	return func() {
+		a.mutex.Lock()
+		delete(a.conns, conn)
+		a.mutex.Unlock()
+	}
+}
+
+//recheck 关闭证书已吊销的连接
+func (a *ClientAuth) recheck() {
+	var revoked []*trackedConn
+	a.mutex.Lock()
+	for conn := range a.conns {
+		if a.revocation.Revoked(conn.cert) {
+			revoked = append(revoked, conn)
+			delete(a.conns, conn)
+		}
+	}
+	a.mutex.Unlock()
+	for _, conn := range revoked {
+		logger.Warnf("客户端证书已吊销，关闭连接，连接地址：%s，证书序列号：%s", conn.addr, conn.cert.SerialNumber.Text(16))
+		conn.close()
+	}
+}
+
+//Close 停止监听吊销列表文件
+func (a *ClientAuth) Close() error {
+	return a.revocation.Close()
+}
+
+//leafOf 已校验的客户端证书，未提供证书时返回空
+func leafOf(state tls.ConnectionState) *x509.Certificate {
+	if len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return state.VerifiedChains[0][0]
+}
+
+//fieldOf 证书字段的值
+func fieldOf(cert *x509.Certificate, field string) string {
+	switch field {
+	case FieldCN:
+		return cert.Subject.CommonName
+	case FieldDNS:
+		if len(cert.DNSNames) > 0 {
+			return cert.DNSNames[0]
+		}
+	case FieldURI:
+		if len(cert.URIs) > 0 {
+			return cert.URIs[0].String()
+		}
+	case FieldEmail:
+		if len(cert.EmailAddresses) > 0 {
+			return cert.EmailAddresses[0]
+		}
+	}
+	return ""
+}
+
+//parseCertificates 解析PEM格式的证书列表
+func parseCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse client ca: %w", err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("client ca contains no certificates")
+	}
+	return certs, nil
+}
@@ -0,0 +1,98 @@
+package certificate
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"go-cmd-transfer/config"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+//issue 签发证书，parent 为空时自签名
+func issue(t *testing.T, serial int64, cn string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		template.IsCA, template.BasicConstraintsValid = true, true
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func TestClientAuthClosesRevokedConnections(t *testing.T) {
+	dir, err := ioutil.TempDir("", "client-auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	ca, caKey := issue(t, 1, "ca", nil, nil)
+	caFile, revokedFile := filepath.Join(dir, "ca.crt"), filepath.Join(dir, "revoked.txt")
+	ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw}), 0600)
+	ioutil.WriteFile(revokedFile, []byte("# 吊销列表\n"), 0600)
+	a, err := NewClientAuth(config.TLS{ClientCA: caFile, ClientAuth: ClientAuthRequest, RevokedFile: revokedFile, SourceIDFrom: FieldCN}, &tls.Config{})
+	if err != nil {
+		t.Fatalf("NewClientAuth: %v", err)
+	}
+	defer a.Close()
+
+	device, _ := issue(t, 0x2a, "device-1", ca, caKey)
+	other, _ := issue(t, 0x2b, "device-2", ca, caKey)
+	state := func(cert *x509.Certificate) tls.ConnectionState {
+		return tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert, ca}}}
+	}
+	if identity, ok := a.Identity(state(device)); !ok || identity.SourceID != "device-1" {
+		t.Fatalf("Identity: got %+v, %t", identity, ok)
+	}
+	if _, ok := a.Identity(tls.ConnectionState{}); ok {
+		t.Fatal("Identity without certificate: expected false")
+	}
+	closed := make(chan string, 2)
+	a.Track(state(device), "device-1", func() { closed <- "device-1" })
+	a.Track(state(other), "device-2", func() { closed <- "device-2" })
+	untracked := a.Track(state(device), "device-1-old", func() { closed <- "device-1-old" })
+	untracked()
+
+	// 吊销列表文件变化后关闭证书已吊销的连接
+	ioutil.WriteFile(revokedFile, []byte("2a\n"), 0600)
+	select {
+	case addr := <-closed:
+		if addr != "device-1" {
+			t.Fatalf("closed %s, want device-1", addr)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("revoked connection was not closed")
+	}
+	select {
+	case addr := <-closed:
+		t.Fatalf("closed %s, want only device-1", addr)
+	case <-time.After(2 * reloadDelay):
+	}
+}
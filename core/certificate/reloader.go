@@ -0,0 +1,76 @@
+/*
+ * @Descripttion: 证书重新加载
+ * @Author: chenjun
+ * @Date: 2026-10-18 23:10:15
+ */
+
+package certificate
+
+import (
+	"crypto/tls"
+	"fmt"
+	"sync"
+
+	logger "github.com/sirupsen/logrus"
+)
+
+//Reloader 证书重新加载器，证书或私钥所在目录的文件变化时重新加载，加载失败时保持原有证书
+type Reloader struct {
+	// 证书文件路径
+	certFile string
+	// 私钥文件路径
+	keyFile string
+	// 证书读写锁
+	mutex sync.RWMutex
+	// 当前证书
+	cert *tls.Certificate
+	// 文件监听
+	watcher *watcher
+}
+
+//NewReloader 加载证书并开始监听文件变化
+func NewReloader(certFile string, keyFile string) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	watcher, err := watchFiles([]string{certFile, keyFile}, r.reloadLogged)
+	if err != nil {
+		return nil, fmt.Errorf("watch tls certificate: %w", err)
+	}
+	r.watcher = watcher
+	return r, nil
+}
+
+//GetCertificate 返回当前证书，用于 tls.Config.GetCertificate
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.cert, nil
+}
+
+//Close 停止监听文件变化
+func (r *Reloader) Close() error {
+	return r.watcher.Close()
+}
+
+//reloadLogged 重新加载证书并记录结果
+func (r *Reloader) reloadLogged() {
+	if err := r.reload(); err != nil {
+		logger.Errorf("重新加载证书失败，保持原有证书，证书文件：%s，错误信息：%s", r.certFile, err.Error())
+		return
+	}
+	logger.Infof("已重新加载证书，证书文件：%s", r.certFile)
+}
+
+//reload 加载证书与私钥
+func (r *Reloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("load tls certificate: %w", err)
+	}
+	r.mutex.Lock()
+	r.cert = &cert
+	r.mutex.Unlock()
+	return nil
+}
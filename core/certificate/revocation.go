@@ -0,0 +1,182 @@
+/*
+ * @Descripttion: 客户端证书吊销列表
+ * @Author: chenjun
+ * @Date: 2026-10-19 00:08:44
+ */
+
+package certificate
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	logger "github.com/sirupsen/logrus"
+)
+
+//Revocation 吊销列表，由CRL文件与序列号列表文件合并得到，文件变化时重新加载，加载失败时保持原有列表
+type Revocation struct {
+	// CRL文件路径，PEM或DER格式
+	crlFile string
+	// 序列号列表文件路径，每行一个十六进制序列号，# 开头为注释
+	revokedFile string
+	// 校验CRL签名的CA
+	cas []*x509.Certificate
+	// 吊销列表读写锁
+	mutex sync.RWMutex
+	// 已吊销的序列号，十六进制小写
+	serials map[string]bool
+	// 文件监听
+	watcher *watcher
+	// 重新加载成功后的回调
+	onReload func()
+}
+
+//NewRevocation 加载吊销列表并开始监听文件变化，两个文件都为空时不吊销任何证书
+func NewRevocation(crlFile string, revokedFile string, cas []*x509.Certificate) (*Revocation, error) {
+	r := &Revocation{crlFile: crlFile, revokedFile: revokedFile, cas: cas, serials: make(map[string]bool)}
+	if crlFile == "" && revokedFile == "" {
+		return r, nil
+	}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	watcher, err := watchFiles([]string{crlFile, revokedFile}, r.reloadLogged)
+	if err != nil {
+		return nil, fmt.Errorf("watch revocation list: %w", err)
+	}
+	r.watcher = watcher
+	return r, nil
+}
+
+//Revoked 判断证书是否已吊销
+func (r *Revocation) Revoked(cert *x509.Certificate) bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.serials[cert.SerialNumber.Text(16)]
+}
+
+//OnReload 设置重新加载成功后的回调，用于检查已建立的连接
+func (r *Revocation) OnReload(callback func()) {
+	r.mutex.Lock()
+	r.onReload = callback
+	r.mutex.Unlock()
+}
+
+//Close 停止监听文件变化
+func (r *Revocation) Close() error {
+	if r.watcher == nil {
+		return nil
+	}
+	return r.watcher.Close()
+}
+
+//reloadLogged 重新加载吊销列表并记录结果
+func (r *Revocation) reloadLogged() {
+	if err := r.reload(); err != nil {
+		logger.Errorf("重新加载吊销列表失败，保持原有列表，错误信息：%s", err.Error())
+		return
+	}
+	r.mutex.RLock()
+	count, onReload := len(r.serials), r.onReload
+	r.mutex.RUnlock()
+	logger.Infof("已重新加载吊销列表，吊销证书数：%d", count)
+	if onReload != nil {
+		onReload()
+	}
+}
+
+//reload 加载CRL文件与序列号列表文件
+func (r *Revocation) reload() error {
+	serials := make(map[string]bool)
+	if r.crlFile != "" {
+		data, err := ioutil.ReadFile(r.crlFile)
+		if err != nil {
+			return fmt.Errorf("read crl: %w", err)
+		}
+		crls, err := parseCRLs(data)
+		if err != nil {
+			return err
+		}
+		for _, crl := range crls {
+			if err := r.verify(crl); err != nil {
+				return err
+			}
+			for _, revoked := range crl.TBSCertList.RevokedCertificates {
+				serials[revoked.SerialNumber.Text(16)] = true
+			}
+		}
+	}
+	if r.revokedFile != "" {
+		data, err := ioutil.ReadFile(r.revokedFile)
+		if err != nil {
+			return fmt.Errorf("read revoked serials: %w", err)
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			serial, ok := new(big.Int).SetString(strings.ReplaceAll(line, ":", ""), 16)
+			if !ok {
+				return fmt.Errorf("invalid revoked serial: %s", line)
+			}
+			serials[serial.Text(16)] = true
+		}
+	}
+	r.mutex.Lock()
+	r.serials = serials
+	r.mutex.Unlock()
+	return nil
+}
+
+//verify 使用签发的CA校验CRL签名，CRL已过期时仍然使用并记录警告
+func (r *Revocation) verify(crl *pkix.CertificateList) error {
+	for _, ca := range r.cas {
+		if ca.CheckCRLSignature(crl) == nil {
+			if crl.HasExpired(time.Now()) {
+				logger.Warnf("吊销列表已过期，签发者：%s，下次更新时间：%s", ca.Subject.CommonName, crl.TBSCertList.NextUpdate)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("crl is not signed by client ca: %s", r.crlFile)
+}
+
+//parseCRLs 解析PEM格式的CRL列表，不是PEM格式时按单个DER格式解析
+func parseCRLs(data []byte) ([]*pkix.CertificateList, error) {
+	var crls []*pkix.CertificateList
+	rest := data
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "X509 CRL" {
+			continue
+		}
+		crl, err := x509.ParseDERCRL(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse crl: %w", err)
+		}
+		crls = append(crls, crl)
+	}
+	if len(crls) > 0 {
+		return crls, nil
+	}
+	crl, err := x509.ParseDERCRL(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse crl: %w", err)
+	}
+	return []*pkix.CertificateList{crl}, nil
+}
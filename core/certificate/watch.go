@@ -0,0 +1,87 @@
+/*
+ * @Descripttion: 监听证书相关文件的变化
+ * @Author: chenjun
+ * @Date: 2026-10-18 23:40:32
+ */
+
+package certificate
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	logger "github.com/sirupsen/logrus"
+)
+
+// 文件变化后等待的时长，证书与私钥通常先后写入，合并为一次加载
+const reloadDelay = 200 * time.Millisecond
+
+//watcher 监听文件所在目录，目录中的文件变化时延迟调用 reload
+type watcher struct {
+	// 文件监听
+	fsWatcher *fsnotify.Watcher
+	// 重新加载
+	reload func()
+	// 定时器锁
+	mutex sync.Mutex
+	// 延迟加载定时器
+	timer *time.Timer
+}
+
+//watchFiles 开始监听文件变化，监听目录而不是文件，文件被替换（重命名、符号链接切换）后仍能收到事件
+func watchFiles(files []string, reload func()) (*watcher, error) {
+	fsWatcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	added := make(map[string]bool)
+	for _, file := range files {
+		dir := filepath.Dir(file)
+		if file == "" || added[dir] {
+			continue
+		}
+		if err := fsWatcher.Add(dir); err != nil {
+			fsWatcher.Close()
+			return nil, fmt.Errorf("watch %s: %w", file, err)
+		}
+		added[dir] = true
+	}
+	w := &watcher{fsWatcher: fsWatcher, reload: reload}
+	go w.loop()
+	return w, nil
+}
+
+//Close 停止监听
+func (w *watcher) Close() error {
+	return w.fsWatcher.Close()
+}
+
+//loop 文件变化时延迟加载
+func (w *watcher) loop() {
+	for {
+		select {
+		case event, ok := <-w.fsWatcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+			w.mutex.Lock()
+			if w.timer == nil {
+				w.timer = time.AfterFunc(reloadDelay, w.reload)
+			} else {
+				w.timer.Reset(reloadDelay)
+			}
+			w.mutex.Unlock()
+		case err, ok := <-w.fsWatcher.Errors:
+			if !ok {
+				return
+			}
+			logger.Errorf("监听证书文件失败，错误信息：%s", err.Error())
+		}
+	}
+}
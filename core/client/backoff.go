@@ -0,0 +1,47 @@
+/*
+ * @Descripttion: 重连的指数退避
+ * @Author: chenjun
+ * @Date: 2026-10-19 15:02:44
+ */
+
+package client
+
+import (
+	"math/rand"
+	"time"
+)
+
+//backoff 指数退避，每次失败后等待时长翻倍直到上限，实际等待时长在一半到全部之间随机，避免大量客户端同时重连
+type backoff struct {
+	// 首次等待时长
+	min time.Duration
+	// 等待时长上限
+	max time.Duration
+	// 连续失败次数
+	attempts uint
+	// 随机数，每个客户端单独的种子，只在重连协程中使用
+	random *rand.Rand
+}
+
+//newBackoff 创建指数退避
+func newBackoff(min time.Duration, max time.Duration) *backoff {
+	return &backoff{min: min, max: max, random: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+//next 下一次重连前的等待时长
+func (b *backoff) next() time.Duration {
+	d := b.min << b.attempts
+	// 超过上限或溢出时不再翻倍
+	if d > b.max || d < b.min {
+		d = b.max
+	} else {
+		b.attempts++
+	}
+	half := d / 2
+	return half + time.Duration(b.random.Int63n(int64(half)+1))
+}
+
+//reset 连接成功后重置
+func (b *backoff) reset() {
+	b.attempts = 0
+}
@@ -0,0 +1,549 @@
+/*
+ * @Descripttion: 自动重连的客户端，传输层由 socket 与 websocket 包提供
+ * @Author: chenjun
+ * @Date: 2026-10-19 14:20:37
+ */
+
+package client
+
+import (
+	"context"
+	stdjson "encoding/json"
+	"errors"
+	"fmt"
+	"go-cmd-transfer/core/hub"
+	"go-cmd-transfer/global"
+	"go-cmd-transfer/utils"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+//实例化工具类
+var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+const (
+	// 认证失败的响应编码
+	unauthorizedCode = "4010"
+)
+
+var (
+	//ErrNotConnected 未连接，正在重连
+	ErrNotConnected = errors.New("client: not connected")
+	//ErrClosed 客户端已关闭
+	ErrClosed = errors.New("client: closed")
+	//ErrDisconnected 等待响应时连接断开，服务端已丢弃请求
+	ErrDisconnected = errors.New("client: disconnected while waiting for reply")
+	//ErrGoingAway 服务端正在关闭，由传输层在收到关闭通知时返回
+	ErrGoingAway = errors.New("client: server going away")
+	//ErrLoginTimeout 未在期限内收到登录结果
+	ErrLoginTimeout = errors.New("client: login timeout")
+)
+
+//Transport 传输层，由 socket 与 websocket 包实现
+type Transport interface {
+	// 建立连接，ctx 取消时放弃；token 为 WithToken 配置的令牌，握手时需要认证的传输层携带
+	Dial(ctx context.Context, token string) (Conn, error)
+}
+
+//Conn 传输层连接，Write、Ping 可以与 Read 并发调用
+type Conn interface {
+	// 读取一条业务报文，收到任何数据都将读取期限延长 timeout（为0时不限），心跳等非业务报文返回空数据
+	Read(timeout time.Duration) ([]byte, error)
+	// 写入一条业务报文
+	Write(data []byte) error
+	// 发送心跳
+	Ping() error
+	// 关闭连接
+	Close() error
+}
+
+//AuthenticatedConn 握手时已携带令牌完成认证的传输层连接，登录报文不再重复携带令牌
+type AuthenticatedConn interface {
+	Conn
+	// 握手时是否已携带令牌
+	Authenticated() bool
+}
+
+//Result 服务端的响应
+type Result struct {
+	Status  bool               `json:"status"`
+	Code    string             `json:"code"`
+	Message string             `json:"message"`
+	Data    stdjson.RawMessage `json:"data"`
+}
+
+//Err 失败的响应转换为错误，成功时为空
+func (r *Result) Err() error {
+	if r.Status {
+		return nil
+	}
+	return &ResultError{Code: r.Code, Message: r.Message}
+}
+
+//ResultError 服务端返回的失败响应
+type ResultError struct {
+	Code    string
+	Message string
+}
+
+//Error 错误信息
+func (e *ResultError) Error() string {
+	return fmt.Sprintf("client: %s %s", e.Code, e.Message)
+}
+
+//Message 收到的消息，转发的业务数据与服务端的响应二选一
+type Message struct {
+	// 转发的业务数据
+	Data *global.BusinessData
+	// 服务端的响应
+	Result *Result
+	// 原始报文
+	Raw []byte
+}
+
+//response 请求的响应
+type response struct {
+	data global.BusinessData
+	err  error
+}
+
+//Client 自动重连的客户端，可并发使用
+type Client struct {
+	// 传输层
+	transport Transport
+	// 配置
+	opts options
+	// 连接与订阅锁
+	mutex sync.Mutex
+	// 当前连接，重连期间为空
+	conn Conn
+	// 订阅的主题，重连后重新订阅
+	topics map[string]bool
+	// 是否已关闭
+	closed bool
+	// 关闭通知
+	closeChan chan struct{}
+	// 重连协程退出通知
+	done chan struct{}
+	// 等待响应的请求锁
+	requestMutex sync.Mutex
+	// 等待响应的请求 correlationID ===> response
+	requests map[string]chan response
+	// 未设置回调时收到的消息
+	messages chan Message
+}
+
+/*
+Dial 建立连接并在断开后自动重连
+ * @param ctx 首次连接的期限，之后的重连不受影响
+ * @param transport 传输层
+ * @param opts 配置项
+ * @return: 首次连接或登录失败时返回错误
+*/
+func Dial(ctx context.Context, transport Transport, opts ...Option) (*Client, error) {
+	c := &Client{
+		transport: transport,
+		opts:      defaultOptions(),
+		topics:    make(map[string]bool),
+		closeChan: make(chan struct{}),
+		done:      make(chan struct{}),
+		requests:  make(map[string]chan response),
+		messages:  make(chan Message, messageQueueSize),
+	}
+	for _, opt := range opts {
+		opt(&c.opts)
+	}
+	conn, err := c.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.conn = conn
+	go c.run(conn)
+	return c, nil
+}
+
+//Messages 未设置回调时收到的消息，需要持续读取，否则读协程阻塞；关闭客户端后关闭
+func (c *Client) Messages() <-chan Message {
+	return c.messages
+}
+
+//Connected 当前是否已连接
+func (c *Client) Connected() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.conn != nil
+}
+
+/*
+Send 发送业务数据
+ * @param busData 业务数据，身份以连接登录时绑定的为准
+ * @return: 未连接时返回 ErrNotConnected
+*/
+func (c *Client) Send(busData global.BusinessData) error {
+	data, err := json.Marshal(busData)
+	if err != nil {
+		return err
+	}
+	return c.write(data)
+}
+
+//Subscribe 订阅主题，重连后自动重新订阅；未连接时只记录，连接后订阅
+func (c *Client) Subscribe(topics ...string) error {
+	c.mutex.Lock()
+	for _, topic := range topics {
+		c.topics[topic] = true
+	}
+	c.mutex.Unlock()
+	err := c.Send(global.BusinessData{OpType: hub.OpSubscribe, Targets: topics})
+	if err == ErrNotConnected {
+		return nil
+	}
+	return err
+}
+
+//Unsubscribe 取消订阅主题，为空时取消所有订阅
+func (c *Client) Unsubscribe(topics ...string) error {
+	c.mutex.Lock()
+	if len(topics) == 0 {
+		c.topics = make(map[string]bool)
+	}
+	for _, topic := range topics {
+		delete(c.topics, topic)
+	}
+	c.mutex.Unlock()
+	err := c.Send(global.BusinessData{OpType: hub.OpUnsubscribe, Targets: topics})
+	if err == ErrNotConnected {
+		return nil
+	}
+	return err
+}
+
+/*
+Request 发送请求并等待响应
+ * @param ctx 等待响应的期限，请求未设置超时时长时按 ctx 的期限设置
+ * @param busData 请求，关联标识为空时自动生成
+ * @return: 响应；服务端返回失败消息（超时、拒绝、处理失败等）时返回 *ResultError，连接断开或 ctx 取消时返回错误
+*/
+func (c *Client) Request(ctx context.Context, busData global.BusinessData) (global.BusinessData, error) {
+	if busData.CorrelationID == "" {
+		busData.CorrelationID = utils.Get32UUID()
+	}
+	if deadline, ok := ctx.Deadline(); ok && busData.Timeout == 0 {
+		busData.Timeout = int(time.Until(deadline) / time.Millisecond)
+	}
+	ch := make(chan response, 1)
+	c.requestMutex.Lock()
+	c.requests[busData.CorrelationID] = ch
+	c.requestMutex.Unlock()
+	defer func() {
+		c.requestMutex.Lock()
+		delete(c.requests, busData.CorrelationID)
+		c.requestMutex.Unlock()
+	}()
+	if err := c.Send(busData); err != nil {
+		return global.BusinessData{}, err
+	}
+	select {
+	case resp := <-ch:
+		return resp.data, resp.err
+	case <-ctx.Done():
+		return global.BusinessData{}, ctx.Err()
+	case <-c.closeChan:
+		return global.BusinessData{}, ErrClosed
+	}
+}
+
+//Reply 响应收到的请求
+func (c *Client) Reply(request global.BusinessData, data interface{}) error {
+	return c.Send(global.BusinessData{
+		OpType:        request.OpType,
+		Mode:          hub.ModeReply,
+		CorrelationID: request.CorrelationID,
+		Data:          data,
+	})
+}
+
+//Close 关闭客户端，不再重连，等待中的请求返回 ErrClosed
+func (c *Client) Close() error {
+	c.mutex.Lock()
+	if c.closed {
+		c.mutex.Unlock()
+		return nil
+	}
+	c.closed = true
+	close(c.closeChan)
+	conn := c.conn
+	c.mutex.Unlock()
+	if conn != nil {
+		conn.Close()
+	}
+	<-c.done
+	return nil
+}
+
+//write 写入当前连接
+func (c *Client) write(data []byte) error {
+	c.mutex.Lock()
+	conn, closed := c.conn, c.closed
+	c.mutex.Unlock()
+	if closed {
+		return ErrClosed
+	}
+	if conn == nil {
+		return ErrNotConnected
+	}
+	return conn.Write(data)
+}
+
+//run 读取当前连接，断开后重连，直到客户端关闭
+func (c *Client) run(conn Conn) {
+	defer close(c.done)
+	// 回调与 Messages 只在本协程中使用，退出后关闭
+	defer close(c.messages)
+	retry := newBackoff(c.opts.minBackoff, c.opts.maxBackoff)
+	for conn != nil {
+		err := c.serve(conn)
+		c.disconnect(conn, err)
+		conn = c.reconnect(retry)
+	}
+}
+
+//serve 发送心跳并读取连接，直到连接出错
+func (c *Client) serve(conn Conn) error {
+	stop := make(chan struct{})
+	defer close(stop)
+	if c.opts.heartbeat > 0 {
+		go c.heartbeat(conn, stop)
+	}
+	for {
+		data, err := conn.Read(3 * c.opts.heartbeat)
+		if err != nil {
+			return err
+		}
+		if len(data) > 0 {
+			c.dispatch(data)
+		}
+	}
+}
+
+//heartbeat 按间隔发送心跳，发送失败时关闭连接由读协程重连
+func (c *Client) heartbeat(conn Conn, stop chan struct{}) {
+	ticker := time.NewTicker(c.opts.heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := conn.Ping(); err != nil {
+				c.opts.log.Warnf("客户端发送心跳失败：%s", err.Error())
+				conn.Close()
+				return
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+//disconnect 连接断开，等待中的请求返回 ErrDisconnected
+func (c *Client) disconnect(conn Conn, err error) {
+	c.mutex.Lock()
+	c.conn = nil
+	closed := c.closed
+	c.mutex.Unlock()
+	conn.Close()
+	if !closed {
+		c.opts.log.Warnf("客户端连接断开：%s", err.Error())
+	}
+	c.requestMutex.Lock()
+	for correlationID, ch := range c.requests {
+		ch <- response{err: ErrDisconnected}
+		delete(c.requests, correlationID)
+	}
+	c.requestMutex.Unlock()
+}
+
+//reconnect 按指数退避重连，客户端关闭时返回空
+func (c *Client) reconnect(retry *backoff) Conn {
+	for {
+		wait := retry.next()
+		c.opts.log.Infof("客户端%s后重连", wait)
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-c.closeChan:
+			timer.Stop()
+			return nil
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			select {
+			case <-c.closeChan:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		conn, err := c.connect(ctx)
+		cancel()
+		if err != nil {
+			c.opts.log.Warnf("客户端重连失败：%s", err.Error())
+			continue
+		}
+		c.mutex.Lock()
+		if c.closed {
+			c.mutex.Unlock()
+			conn.Close()
+			return nil
+		}
+		c.conn = conn
+		c.mutex.Unlock()
+		retry.reset()
+		c.opts.log.Info("客户端重连成功")
+		return conn
+	}
+}
+
+//connect 建立连接，登录并重新订阅主题
+func (c *Client) connect(ctx context.Context) (Conn, error) {
+	conn, err := c.transport.Dial(ctx, c.opts.token)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.login(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	c.mutex.Lock()
+	topics := make([]string, 0, len(c.topics))
+	for topic := range c.topics {
+		topics = append(topics, topic)
+	}
+	c.mutex.Unlock()
+	if len(topics) > 0 {
+		data, err := json.Marshal(global.BusinessData{OpType: hub.OpSubscribe, Targets: topics})
+		if err == nil {
+			err = conn.Write(data)
+		}
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+//loginData 登录报文的数据
+type loginData struct {
+	Token    string `json:"token,omitempty"`
+	UserID   string `json:"userId,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+//login 配置了身份或凭据时发送登录报文并等待登录结果，期间收到的其他消息照常处理；握手时已携带令牌时登录报文不携带令牌
+func (c *Client) login(conn Conn) error {
+	o := c.opts
+	if authenticated, ok := conn.(AuthenticatedConn); ok && authenticated.Authenticated() {
+		o.token = ""
+	}
+	if o.userID == "" && o.sourceID == "" && o.token == "" {
+		return nil
+	}
+	data, err := json.Marshal(struct {
+		global.BusinessData
+		Data loginData `json:"data"`
+	}{
+		BusinessData: global.BusinessData{OpType: hub.OpLogin, UserID: o.userID, SourceID: o.sourceID},
+		Data:         loginData{Token: o.token, UserID: o.userID, Password: o.password},
+	})
+	if err != nil {
+		return err
+	}
+	if err := conn.Write(data); err != nil {
+		return err
+	}
+	deadline := time.Now().Add(o.loginTimeout)
+	for {
+		timeout := time.Until(deadline)
+		if timeout <= 0 {
+			return ErrLoginTimeout
+		}
+		data, err := conn.Read(timeout)
+		if err != nil {
+			return err
+		}
+		if len(data) == 0 {
+			continue
+		}
+		msg := parse(data)
+		if result := msg.Result; result != nil && (result.Message == hub.OpLogin || result.Code == unauthorizedCode) {
+			return result.Err()
+		}
+		c.deliver(msg)
+	}
+}
+
+//dispatch 解析收到的报文，响应交给等待中的请求，其他消息交给回调或 Messages
+func (c *Client) dispatch(data []byte) {
+	msg := parse(data)
+	if msg.Data != nil && msg.Data.Mode == hub.ModeReply && c.resolve(msg.Data.CorrelationID, response{data: *msg.Data}) {
+		return
+	}
+	// 请求的失败消息（超时、拒绝、处理失败等）携带请求的关联标识，结束等待中的请求
+	if msg.Result != nil && !msg.Result.Status {
+		request := struct {
+			CorrelationID string `json:"correlationId"`
+		}{}
+		if json.Unmarshal(msg.Result.Data, &request) == nil && request.CorrelationID != "" && c.resolve(request.CorrelationID, response{err: msg.Result.Err()}) {
+			return
+		}
+	}
+	c.deliver(msg)
+}
+
+//resolve 将响应交给等待中的请求，请求不存在时返回 false
+func (c *Client) resolve(correlationID string, resp response) bool {
+	c.requestMutex.Lock()
+	defer c.requestMutex.Unlock()
+	ch, ok := c.requests[correlationID]
+	if ok {
+		ch <- resp
+		delete(c.requests, correlationID)
+	}
+	return ok
+}
+
+//deliver 交给回调或 Messages
+func (c *Client) deliver(msg Message) {
+	if c.opts.handler != nil {
+		c.opts.handler(msg)
+		return
+	}
+	select {
+	case c.messages <- msg:
+	case <-c.closeChan:
+	}
+}
+
+//parse 按是否有 status 字段区分服务端的响应与转发的业务数据
+func parse(data []byte) Message {
+	msg := Message{Raw: data}
+	probe := struct {
+		Status *bool `json:"status"`
+	}{}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return msg
+	}
+	if probe.Status != nil {
+		result := &Result{}
+		if json.Unmarshal(data, result) == nil {
+			msg.Result = result
+		}
+		return msg
+	}
+	busData := &global.BusinessData{}
+	if json.Unmarshal(data, busData) == nil {
+		msg.Data = busData
+	}
+	return msg
+}
@@ -0,0 +1,208 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"go-cmd-transfer/core/client"
+	"go-cmd-transfer/core/hub"
+	"go-cmd-transfer/core/server"
+	"go-cmd-transfer/core/socket"
+	"go-cmd-transfer/global"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	logger "github.com/sirupsen/logrus"
+)
+
+//quiet 丢弃输出的日志
+func quiet() *logger.Logger {
+	log := logger.New()
+	log.SetOutput(ioutil.Discard)
+	return log
+}
+
+//startServer 在本机随机端口启动socket服务，测试结束时关闭
+func startServer(t *testing.T) *server.Server {
+	t.Helper()
+	s := server.New(server.WithSocketAddr("127.0.0.1:0"), server.WithLogger(quiet()))
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		s.Shutdown(ctx)
+	})
+	return s
+}
+
+//dial 以指定身份连接，测试结束时关闭
+func dial(t *testing.T, s *server.Server, userID string, opts ...client.Option) *client.Client {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	opts = append([]client.Option{client.WithIdentity(userID, ""), client.WithLogger(quiet())}, opts...)
+	c, err := socket.Dial(ctx, s.SocketAddr().String(), nil, opts...)
+	if err != nil {
+		t.Fatalf("%s: Dial: %v", userID, err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+//serve 回复收到的每个请求
+func serve(c *client.Client, reply string) {
+	go func() {
+		for msg := range c.Messages() {
+			if msg.Data != nil && msg.Data.CorrelationID != "" {
+				c.Reply(*msg.Data, reply)
+			}
+		}
+	}()
+}
+
+//request 在期限内发送请求
+func request(c *client.Client, busData global.BusinessData) (global.BusinessData, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return c.Request(ctx, busData)
+}
+
+func TestRequestReply(t *testing.T) {
+	s := startServer(t)
+	console, device := dial(t, s, "console"), dial(t, s, "device")
+	serve(device, "pong")
+	reply, err := request(console, global.BusinessData{Mode: hub.ModeUser, Targets: []string{"device"}, CorrelationID: "r1", Data: "ping"})
+	if err != nil {
+		t.Fatalf("Request: %v", err)
+	}
+	if reply.Data != "pong" || reply.CorrelationID != "r1" || reply.UserID != "device" {
+		t.Errorf("got reply %+v", reply)
+	}
+}
+
+func TestRequestFailsOnServerError(t *testing.T) {
+	s := startServer(t)
+	console, device := dial(t, s, "console"), dial(t, s, "device")
+	tests := []struct {
+		name    string
+		busData global.BusinessData
+		code    string
+	}{
+		{"unknown op type", global.BusinessData{OpType: "nope", Mode: hub.ModeUser, Targets: []string{"device"}}, "4040"},
+		{"invalid target", global.BusinessData{Mode: "nope", Targets: []string{"device"}}, "9999"},
+		{"request timeout", global.BusinessData{Mode: hub.ModeUser, Targets: []string{"device"}, Timeout: 50}, "4080"},
+	}
+	for _, tt := range tests {
+		start := time.Now()
+		_, err := request(console, tt.busData)
+		var resultErr *client.ResultError
+		if !errors.As(err, &resultErr) || resultErr.Code != tt.code {
+			t.Errorf("%s: got error %v, want code %s", tt.name, err, tt.code)
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("%s: returned after %s, want the server error to end the wait", tt.name, elapsed)
+		}
+	}
+	// 超时的请求投递到了目标，目标未响应
+	select {
+	case msg := <-device.Messages():
+		if msg.Data == nil || msg.Data.CorrelationID == "" {
+			t.Errorf("device: got %s", msg.Raw)
+		}
+	case <-time.After(time.Second):
+		t.Error("device: request not delivered")
+	}
+}
+
+func TestResubscribeAfterReconnect(t *testing.T) {
+	s := startServer(t)
+	c := dial(t, s, "device", client.WithBackoff(10*time.Millisecond, 50*time.Millisecond))
+	if err := c.Subscribe("alarms"); err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	// 服务端关闭连接，客户端重连后重新订阅
+	for _, conn := range s.Hub().Conns(hub.ProtocolSocket) {
+		conn.Close()
+	}
+	deadline := time.After(5 * time.Second)
+	tick := time.NewTicker(50 * time.Millisecond)
+	defer tick.Stop()
+	for {
+		select {
+		case msg := <-c.Messages():
+			if msg.Data != nil && msg.Data.Data == "alarm" {
+				return
+			}
+		case <-tick.C:
+			s.Hub().Dispatch(global.BusinessData{Mode: hub.ModeTopic, Targets: []string{"alarms"}, Data: "alarm"})
+		case <-deadline:
+			t.Fatal("no topic message after reconnect")
+		}
+	}
+}
+
+//fakeConn 记录写入报文的传输层连接，登录后返回登录成功
+type fakeConn struct {
+	authenticated bool
+	written       chan []byte
+	replies       chan []byte
+	closed        chan struct{}
+}
+
+func (f *fakeConn) Read(timeout time.Duration) ([]byte, error) {
+	select {
+	case data := <-f.replies:
+		return data, nil
+	case <-f.closed:
+		return nil, client.ErrClosed
+	}
+}
+
+func (f *fakeConn) Write(data []byte) error {
+	f.written <- data
+	f.replies <- []byte(`{"status":true,"code":"0000","message":"login","data":{}}`)
+	return nil
+}
+
+func (f *fakeConn) Ping() error { return nil }
+
+func (f *fakeConn) Close() error {
+	select {
+	case <-f.closed:
+	default:
+		close(f.closed)
+	}
+	return nil
+}
+
+func (f *fakeConn) Authenticated() bool { return f.authenticated }
+
+//fakeTransport 返回同一个 fakeConn
+type fakeTransport struct{ conn *fakeConn }
+
+func (f fakeTransport) Dial(ctx context.Context, token string) (client.Conn, error) {
+	return f.conn, nil
+}
+
+func TestLoginTokenSkippedAfterHandshake(t *testing.T) {
+	for _, authenticated := range []bool{false, true} {
+		conn := &fakeConn{authenticated: authenticated, written: make(chan []byte, 1), replies: make(chan []byte, 1), closed: make(chan struct{})}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		c, err := client.Dial(ctx, fakeTransport{conn}, client.WithIdentity("device", ""), client.WithToken("secret"), client.WithLogger(quiet()))
+		cancel()
+		if err != nil {
+			t.Fatalf("authenticated=%t: Dial: %v", authenticated, err)
+		}
+		login := string(<-conn.written)
+		c.Close()
+		if got := strings.Contains(login, `"token":"secret"`); got == authenticated {
+			t.Errorf("authenticated=%t: login frame %s", authenticated, login)
+		}
+		if !strings.Contains(login, `"userId":"device"`) {
+			t.Errorf("authenticated=%t: login frame without identity %s", authenticated, login)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+/*
+ * @Descripttion: 客户端的配置项
+ * @Author: chenjun
+ * @Date: 2026-10-19 14:48:19
+ */
+
+package client
+
+import (
+	"time"
+
+	logger "github.com/sirupsen/logrus"
+)
+
+const (
+	// 默认心跳间隔
+	defaultHeartbeat = 30 * time.Second
+	// 默认首次重连等待时长
+	defaultMinBackoff = 500 * time.Millisecond
+	// 默认重连等待时长上限
+	defaultMaxBackoff = 30 * time.Second
+	// 默认登录期限
+	defaultLoginTimeout = 10 * time.Second
+	// 未设置回调时收到的消息的缓冲长度
+	messageQueueSize = 256
+)
+
+//options 客户端的配置
+type options struct {
+	// 用户账号
+	userID string
+	// 接入端标识
+	sourceID string
+	// 登录令牌
+	token string
+	// 登录密码，与用户账号一起认证
+	password string
+	// 心跳间隔，为0时不发送心跳
+	heartbeat time.Duration
+	// 首次重连等待时长
+	minBackoff time.Duration
+	// 重连等待时长上限
+	maxBackoff time.Duration
+	// 登录期限
+	loginTimeout time.Duration
+	// 收到消息的回调
+	handler func(msg Message)
+	// 日志
+	log logger.FieldLogger
+}
+
+//Option 客户端的配置项
+type Option func(*options)
+
+//defaultOptions 默认配置
+func defaultOptions() options {
+	return options{
+		heartbeat:    defaultHeartbeat,
+		minBackoff:   defaultMinBackoff,
+		maxBackoff:   defaultMaxBackoff,
+		loginTimeout: defaultLoginTimeout,
+		log:          logger.StandardLogger(),
+	}
+}
+
+//WithIdentity 连接身份，未启用认证的服务端以此绑定连接
+func WithIdentity(userID string, sourceID string) Option {
+	return func(o *options) {
+		o.userID = userID
+		o.sourceID = sourceID
+	}
+}
+
+//WithToken 以令牌登录
+func WithToken(token string) Option {
+	return func(o *options) {
+		o.token = token
+	}
+}
+
+//WithPassword 以账号密码登录
+func WithPassword(userID string, password string) Option {
+	return func(o *options) {
+		o.userID = userID
+		o.password = password
+	}
+}
+
+//WithHeartbeat 心跳间隔，默认30秒，为0时不发送心跳；超过3个间隔未收到任何数据时重连
+func WithHeartbeat(interval time.Duration) Option {
+	return func(o *options) {
+		o.heartbeat = interval
+	}
+}
+
+//WithBackoff 重连等待时长，每次失败后翻倍直到上限，默认500毫秒到30秒
+func WithBackoff(min time.Duration, max time.Duration) Option {
+	return func(o *options) {
+		o.minBackoff = min
+		o.maxBackoff = max
+	}
+}
+
+//WithLoginTimeout 每次连接后等待登录结果的期限，默认10秒
+func WithLoginTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.loginTimeout = timeout
+	}
+}
+
+//WithHandler 收到消息的回调，在读协程中调用，不应阻塞；设置后 Messages 不再有消息
+func WithHandler(handler func(msg Message)) Option {
+	return func(o *options) {
+		o.handler = handler
+	}
+}
+
+//WithLogger 客户端使用的日志，默认使用 logrus 的标准日志
+func WithLogger(log logger.FieldLogger) Option {
+	return func(o *options) {
+		o.log = log
+	}
+}
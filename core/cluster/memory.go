@@ -0,0 +1,62 @@
+/*
+ * @Descripttion: 进程内集群消息总线，用于单机调试与测试
+ * @Author: chenjun
+ * @Date: 2026-10-18 14:48:33
+ */
+
+package cluster
+
+import (
+	"sync"
+)
+
+//MemoryBus 进程内消息总线，同一个总线上的 MemoryBackplane 互相可见
+type MemoryBus struct {
+	// 订阅者读写锁
+	mutex sync.RWMutex
+	// 订阅者
+	subscribers map[*MemoryBackplane]func(data []byte)
+}
+
+//NewMemoryBus 创建进程内消息总线
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{subscribers: make(map[*MemoryBackplane]func(data []byte))}
+}
+
+//Backplane 创建接入该总线的集群消息总线，每个节点一个
+func (bus *MemoryBus) Backplane() *MemoryBackplane {
+	return &MemoryBackplane{bus: bus}
+}
+
+//MemoryBackplane 进程内集群消息总线，与redis实现行为一致
+type MemoryBackplane struct {
+	// 所属消息总线
+	bus *MemoryBus
+}
+
+//Publish 发布消息到总线上的所有订阅者
+func (b *MemoryBackplane) Publish(data []byte) error {
+	b.bus.mutex.RLock()
+	defer b.bus.mutex.RUnlock()
+	for _, handler := range b.bus.subscribers {
+		// 复制数据，避免订阅者之间互相影响
+		handler(append([]byte(nil), data...))
+	}
+	return nil
+}
+
+//Subscribe 订阅总线上发布的消息
+func (b *MemoryBackplane) Subscribe(handler func(data []byte)) error {
+	b.bus.mutex.Lock()
+	b.bus.subscribers[b] = handler
+	b.bus.mutex.Unlock()
+	return nil
+}
+
+//Close 取消订阅
+func (b *MemoryBackplane) Close() error {
+	b.bus.mutex.Lock()
+	delete(b.bus.subscribers, b)
+	b.bus.mutex.Unlock()
+	return nil
+}
@@ -0,0 +1,77 @@
+package cluster
+
+import (
+	"context"
+	"go-cmd-transfer/core/hub"
+	"go-cmd-transfer/core/hub/hubtest"
+	"go-cmd-transfer/global"
+	"strings"
+	"testing"
+	"time"
+)
+
+//newNode 创建接入总线的连接中心
+func newNode(t *testing.T, bus *MemoryBus, node string) *hub.Hub {
+	t.Helper()
+	h := hub.New()
+	h.SetNode(node)
+	if err := h.UseBackplane(bus.Backplane()); err != nil {
+		t.Fatalf("UseBackplane: %v", err)
+	}
+	return h
+}
+
+func TestMemoryBusCrossNodeDelivery(t *testing.T) {
+	bus := NewMemoryBus()
+	nodeA, nodeB := newNode(t, bus, "node-a"), newNode(t, bus, "node-b")
+	alice := hubtest.NewConn("conn-alice", "alice")
+	bobOnA := hubtest.NewConn("conn-bob-a", "bob")
+	bobOnB := hubtest.NewConn("conn-bob-b", "bob")
+	carol := hubtest.NewConn("conn-carol", "carol")
+	nodeA.Register(alice)
+	nodeA.Register(bobOnA)
+	nodeB.Register(bobOnB)
+	nodeB.Register(carol)
+
+	if err := nodeA.Dispatch(global.BusinessData{Mode: hub.ModeUser, Targets: []string{"bob"}, Data: "to-bob"}); err != nil {
+		t.Fatalf("Dispatch: %v", err)
+	}
+	// 本节点的连接只投递一次，总线上回到本节点的消息被忽略
+	for _, conn := range []*hubtest.Conn{bobOnA, bobOnB} {
+		got := conn.Messages()
+		if len(got) != 1 || !strings.Contains(got[0], `"to-bob"`) {
+			t.Errorf("%s: got %q, want one message to-bob", conn.ID(), got)
+		}
+	}
+	for _, conn := range []*hubtest.Conn{alice, carol} {
+		if got := conn.Messages(); len(got) != 0 {
+			t.Errorf("%s: got %q, want nothing", conn.ID(), got)
+		}
+	}
+
+	// 按连接标识投递到其他节点的连接
+	if err := nodeB.Dispatch(global.BusinessData{Mode: hub.ModeConn, Targets: []string{"conn-alice"}, Data: "to-alice"}); err != nil {
+		t.Fatalf("Dispatch: %v", err)
+	}
+	if got := alice.Messages(); len(got) != 1 || !strings.Contains(got[0], `"to-alice"`) {
+		t.Errorf("alice: got %q, want one message to-alice", got)
+	}
+
+	// 关闭后不再收到其他节点的消息
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	nodeB.Shutdown(ctx)
+	if err := nodeA.Dispatch(global.BusinessData{Mode: hub.ModeBroadcast, Data: "after-close"}); err != nil {
+		t.Fatalf("Dispatch: %v", err)
+	}
+	for _, conn := range []*hubtest.Conn{bobOnB, carol} {
+		for _, msg := range conn.Messages() {
+			if strings.Contains(msg, "after-close") {
+				t.Errorf("%s: received message after its node closed", conn.ID())
+			}
+		}
+	}
+	if got := alice.Messages(); len(got) != 2 {
+		t.Errorf("alice: got %d messages, want 2", len(got))
+	}
+}
@@ -0,0 +1,86 @@
+/*
+ * @Descripttion: 基于redis发布订阅的集群消息总线
+ * @Author: chenjun
+ * @Date: 2026-10-18 14:32:07
+ */
+
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"go-cmd-transfer/config"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	logger "github.com/sirupsen/logrus"
+)
+
+//DispatchChannel 集群投递消息的发布订阅频道
+const DispatchChannel = "cmd-transfer:dispatch"
+
+//NewRedisClient 按配置创建redis客户端，超时时长单位为毫秒
+func NewRedisClient(c config.Redis) *redis.Client {
+	timeout := time.Duration(c.Timeout) * time.Millisecond
+	return redis.NewClient(&redis.Options{
+		Addr:         fmt.Sprintf("%s:%d", c.Host, c.Port),
+		Password:     c.Password,
+		DB:           c.Database,
+		DialTimeout:  timeout,
+		ReadTimeout:  timeout,
+		WriteTimeout: timeout,
+	})
+}
+
+//RedisBackplane 基于redis发布订阅的集群消息总线
+type RedisBackplane struct {
+	// redis客户端
+	client *redis.Client
+	// 发布订阅频道
+	channel string
+	// 订阅
+	pubsub *redis.PubSub
+}
+
+//NewRedisBackplane 创建redis集群消息总线，创建时检查redis是否可用
+func NewRedisBackplane(client *redis.Client) (*RedisBackplane, error) {
+	if err := client.Ping().Err(); err != nil {
+		return nil, err
+	}
+	return &RedisBackplane{client: client, channel: DispatchChannel}, nil
+}
+
+//Publish 发布消息到所有节点
+func (b *RedisBackplane) Publish(data []byte) error {
+	return b.client.Publish(b.channel, data).Err()
+}
+
+//Subscribe 订阅所有节点发布的消息，只能订阅一次，断线后由redis客户端自动重新订阅
+func (b *RedisBackplane) Subscribe(handler func(data []byte)) error {
+	if b.pubsub != nil {
+		return errors.New("backplane already subscribed")
+	}
+	pubsub := b.client.Subscribe(b.channel)
+	// 等待订阅确认，保证返回后不会丢失消息
+	if _, err := pubsub.Receive(); err != nil {
+		pubsub.Close()
+		return err
+	}
+	b.pubsub = pubsub
+	go func() {
+		for msg := range pubsub.Channel() {
+			handler([]byte(msg.Payload))
+		}
+		logger.Info("redis集群消息总线订阅已关闭")
+	}()
+	logger.Infof("redis集群消息总线订阅成功，频道：%s", b.channel)
+	return nil
+}
+
+//Close 关闭订阅，redis客户端由创建方关闭
+func (b *RedisBackplane) Close() error {
+	if b.pubsub == nil {
+		return nil
+	}
+	return b.pubsub.Close()
+}
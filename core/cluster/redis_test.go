@@ -0,0 +1,151 @@
+package cluster
+
+import (
+	"context"
+	"go-cmd-transfer/core/hub"
+	"go-cmd-transfer/core/hub/hubtest"
+	"go-cmd-transfer/global"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v7"
+	logger "github.com/sirupsen/logrus"
+)
+
+//newRedisNode 创建接入 miniredis 集群消息总线的连接中心，每个节点使用自己的redis客户端
+func newRedisNode(t *testing.T, server *miniredis.Miniredis, node string) *hub.Hub {
+	t.Helper()
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	backplane, err := NewRedisBackplane(client)
+	if err != nil {
+		t.Fatalf("NewRedisBackplane: %v", err)
+	}
+	h := hub.New()
+	log := logger.New()
+	log.SetOutput(ioutil.Discard)
+	h.SetLogger(log)
+	h.SetNode(node)
+	if err := h.UseBackplane(backplane); err != nil {
+		t.Fatalf("UseBackplane: %v", err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		h.Shutdown(ctx)
+	})
+	return h
+}
+
+//waitSubscribers 等待频道的订阅数达到 n
+func waitSubscribers(t *testing.T, server *miniredis.Miniredis, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for server.PubSubNumSub(DispatchChannel)[DispatchChannel] != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d subscribers, want %d", server.PubSubNumSub(DispatchChannel)[DispatchChannel], n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRedisBackplaneCrossNodeDelivery(t *testing.T) {
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	nodeA, nodeB := newRedisNode(t, server, "node-a"), newRedisNode(t, server, "node-b")
+	alice := hubtest.NewConn("conn-alice", "alice")
+	bobOnA := hubtest.NewConn("conn-bob-a", "bob")
+	bobOnB := hubtest.NewConn("conn-bob-b", "bob")
+	carol := hubtest.NewConn("conn-carol", "carol")
+	nodeA.Register(alice)
+	nodeA.Register(bobOnA)
+	nodeB.Register(bobOnB)
+	nodeB.Register(carol)
+
+	if err := nodeA.Dispatch(global.BusinessData{Mode: hub.ModeUser, Targets: []string{"bob"}, Data: "to-bob"}); err != nil {
+		t.Fatalf("Dispatch: %v", err)
+	}
+	if got := bobOnB.Wait(t, 1); !strings.Contains(got[0], `"to-bob"`) {
+		t.Errorf("bob on node-b: got %q, want to-bob", got)
+	}
+	// 同一频道的消息按发布顺序到达，alice 收到后面的消息时 node-a 已处理过自己发布的消息
+	if err := nodeB.Dispatch(global.BusinessData{Mode: hub.ModeConn, Targets: []string{"conn-alice"}, Data: "to-alice"}); err != nil {
+		t.Fatalf("Dispatch: %v", err)
+	}
+	if got := alice.Wait(t, 1); !strings.Contains(got[0], `"to-alice"`) {
+		t.Errorf("alice: got %q, want to-alice", got)
+	}
+	// 本节点的连接只投递一次，总线上回到本节点的消息被忽略
+	if got := bobOnA.Messages(); len(got) != 1 || !strings.Contains(got[0], `"to-bob"`) {
+		t.Errorf("bob on node-a: got %q, want one message to-bob", got)
+	}
+	if got := bobOnB.Messages(); len(got) != 1 {
+		t.Errorf("bob on node-b: got %q, want one message", got)
+	}
+	if got := carol.Messages(); len(got) != 0 {
+		t.Errorf("carol: got %q, want nothing", got)
+	}
+}
+
+func TestRedisBackplaneResubscribesAfterReconnect(t *testing.T) {
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	nodeA, nodeB := newRedisNode(t, server, "node-a"), newRedisNode(t, server, "node-b")
+	bob := hubtest.NewConn("conn-bob", "bob")
+	nodeB.Register(bob)
+	waitSubscribers(t, server, 2)
+
+	// redis重启后订阅丢失，由redis客户端重新连接并订阅
+	server.Close()
+	if err := server.Restart(); err != nil {
+		t.Fatalf("Restart: %v", err)
+	}
+	waitSubscribers(t, server, 2)
+	// 连接池中的旧连接已断开，发布失败时重试
+	deadline := time.Now().Add(5 * time.Second)
+	for len(bob.Messages()) == 0 && time.Now().Before(deadline) {
+		if err := nodeA.Dispatch(global.BusinessData{Mode: hub.ModeConn, Targets: []string{"conn-bob"}, Data: "after-reconnect"}); err != nil {
+			t.Fatalf("Dispatch: %v", err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if got := bob.Wait(t, 1); !strings.Contains(got[0], `"after-reconnect"`) {
+		t.Errorf("bob: got %q, want after-reconnect", got)
+	}
+}
+
+func TestRedisBackplaneSubscribeOnce(t *testing.T) {
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+	backplane, err := NewRedisBackplane(client)
+	if err != nil {
+		t.Fatalf("NewRedisBackplane: %v", err)
+	}
+	defer backplane.Close()
+	if err := backplane.Subscribe(func([]byte) {}); err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	if err := backplane.Subscribe(func([]byte) {}); err == nil {
+		t.Error("second Subscribe: expected error")
+	}
+
+	// redis不可用时创建失败
+	server.Close()
+	if _, err := NewRedisBackplane(client); err == nil {
+		t.Error("NewRedisBackplane with redis down: expected error")
+	}
+}
@@ -0,0 +1,89 @@
+/*
+ * @Descripttion: 集群消息总线，多个节点之间转发投递的消息
+ * @Author: chenjun
+ * @Date: 2026-10-18 14:10:52
+ */
+
+package hub
+
+import (
+	"go-cmd-transfer/global"
+)
+
+//Backplane 集群消息总线，由 core/cluster 实现
+type Backplane interface {
+	// 发布消息到所有节点，包括当前节点
+	Publish(data []byte) error
+	// 订阅所有节点发布的消息，handler 在总线的接收协程中调用
+	Subscribe(handler func(data []byte)) error
+	// 关闭总线
+	Close() error
+}
+
+//envelope 总线上传递的消息
+type envelope struct {
+	// 发布消息的节点
+	Node string `json:"node"`
+	// 发送方连接标识
+	From string `json:"from"`
+	// 业务数据
+	BusData global.BusinessData `json:"busData"`
+}
+
+/*
+UseBackplane 接入集群消息总线，本节点投递的消息同时发布给其他节点，接入前应先设置节点标识
+ * @param backplane 集群消息总线
+ * @return: 订阅失败时返回错误
+*/
+func (h *Hub) UseBackplane(backplane Backplane) error {
+	h.mutex.Lock()
+	h.backplane = backplane
+	h.mutex.Unlock()
+	return backplane.Subscribe(h.receiveRemote)
+}
+
+//publish 发布本节点投递的消息到集群
+func (h *Hub) publish(busData global.BusinessData, from string) {
+	h.mutex.RLock()
+	node, backplane := h.node, h.backplane
+	h.mutex.RUnlock()
+	if backplane == nil {
+		return
+	}
+	data, err := json.Marshal(envelope{node, from, busData})
+	if err != nil {
+		h.log.Error("发布集群消息时，转换json字符串错误", err.Error())
+		return
+	}
+	if err := backplane.Publish(data); err != nil {
+		h.log.Errorf("发布集群消息失败，节点：%s，错误信息：%s", node, err.Error())
+	}
+}
+
+//receiveRemote 接收其他节点发布的消息，只投递到本节点的连接
+func (h *Hub) receiveRemote(data []byte) {
+	msg := envelope{}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		h.log.Error("接收集群消息时，解析json字符串错误", err.Error())
+		return
+	}
+	h.mutex.RLock()
+	node := h.node
+	h.mutex.RUnlock()
+	// 本节点发布的消息已在本地投递
+	if msg.Node == node {
+		return
+	}
+	target, err := TargetOf(msg.BusData)
+	if err != nil {
+		h.log.Errorf("接收集群消息时，投递目标错误，来源节点：%s，错误信息：%s", msg.Node, err.Error())
+		return
+	}
+	if target.Mode == ModeReply {
+		if _, err := h.reply(msg.BusData, msg.From); err != nil {
+			h.log.Warnf("投递其他节点的响应失败，来源节点：%s，关联标识：%s，错误信息：%s", msg.Node, msg.BusData.CorrelationID, err.Error())
+		}
+		return
+	}
+	h.deliver(msg.BusData, target, msg.From)
+}
@@ -0,0 +1,204 @@
+/*
+ * @Descripttion: 至少一次投递，接收方确认、超时重发与投递状态回报
+ * @Author: chenjun
+ * @Date: 2026-10-18 18:02:33
+ */
+
+package hub
+
+import (
+	"go-cmd-transfer/core/metrics"
+	"go-cmd-transfer/global"
+	"time"
+)
+
+const (
+	//OpAck 接收方确认消息，报文为 {"opType":"ack","msgId":"..."}
+	OpAck = "ack"
+	//OpDelivery 投递状态回报，发送给需要确认的消息的发送方
+	OpDelivery = "delivery"
+
+	//StatusDelivered 接收方已确认
+	StatusDelivered = "delivered"
+	//StatusFailed 重发次数用尽或连接关闭
+	StatusFailed = "failed"
+	//StatusStored 目标用户不在线，已暂存为离线消息
+	StatusStored = "stored"
+
+	// 默认首次等待确认的时长
+	defaultAckTimeout = 2 * time.Second
+	// 默认最多重发次数
+	defaultAckRetries = 3
+)
+
+//DeliveryStatus 一条消息投递到一个连接的结果
+type DeliveryStatus struct {
+	MsgID    string `json:"msgId"`            // 消息标识
+	Status   string `json:"status"`           // 投递状态 delivered/failed/stored
+	UserID   string `json:"userId"`           // 接收方用户账号
+	SourceID string `json:"sourceId"`         // 接收方接入端标识
+	ConnID   string `json:"connId"`           // 接收方连接标识，暂存时为空
+	Attempts int    `json:"attempts"`         // 发送次数
+	Reason   string `json:"reason,omitempty"` // 失败原因
+}
+
+//pending 等待确认的投递
+type pending struct {
+	// 接收方连接
+	conn Conn
+	// 业务数据
+	busData global.BusinessData
+	// 报文数据
+	data []byte
+	// 发送方连接标识
+	from string
+	// 已发送次数
+	attempts int
+	// 重发定时器
+	timer *time.Timer
+}
+
+//SetAckPolicy 设置首次等待确认的时长与最多重发次数，之后每次重发等待时长翻倍，参数小于等于0时保持默认值
+func (h *Hub) SetAckPolicy(timeout time.Duration, retries int) {
+	h.pendingMutex.Lock()
+	if timeout > 0 {
+		h.ackTimeout = timeout
+	}
+	if retries > 0 {
+		h.ackRetries = retries
+	}
+	h.pendingMutex.Unlock()
+}
+
+//OnDelivery 设置投递状态回调，在投递结果确定时调用
+func (h *Hub) OnDelivery(callback func(status DeliveryStatus)) {
+	h.pendingMutex.Lock()
+	h.onDelivery = callback
+	h.pendingMutex.Unlock()
+}
+
+/*
+Ack 接收方确认消息，停止重发并回报投递成功
+ * @param conn 接收方连接
+ * @param msgID 消息标识
+*/
+func (h *Hub) Ack(conn Conn, msgID string) {
+	key := pendingKey(msgID, conn.ID())
+	h.pendingMutex.Lock()
+	p, ok := h.pendings[key]
+	if ok {
+		p.timer.Stop()
+		delete(h.pendings, key)
+	}
+	h.pendingMutex.Unlock()
+	if !ok {
+		h.log.Warnf("%s确认的消息不存在或已超时，连接标识：%s，消息标识：%s", conn.Protocol(), conn.ID(), msgID)
+		return
+	}
+	h.report(p.from, p.busData, h.statusOf(p, StatusDelivered, ""))
+}
+
+//send 发送报文到连接，需要确认的消息开始等待确认
+func (h *Hub) send(conn Conn, busData global.BusinessData, data []byte, from string) error {
+	if err := conn.Send(data); err != nil {
+		return err
+	}
+	metrics.MessagesOut.WithLabelValues(conn.Protocol(), h.opLabel(busData.OpType)).Inc()
+	if !busData.RequireAck {
+		return nil
+	}
+	key := pendingKey(busData.MsgID, conn.ID())
+	h.pendingMutex.Lock()
+	p := &pending{conn: conn, busData: busData, data: data, from: from, attempts: 1}
+	p.timer = time.AfterFunc(h.ackTimeout, func() {
+		h.retransmit(key)
+	})
+	h.pendings[key] = p
+	h.pendingMutex.Unlock()
+	return nil
+}
+
+//retransmit 等待确认超时，重发或回报投递失败
+func (h *Hub) retransmit(key string) {
+	h.pendingMutex.Lock()
+	p, ok := h.pendings[key]
+	if !ok {
+		h.pendingMutex.Unlock()
+		return
+	}
+	if p.attempts > h.ackRetries {
+		delete(h.pendings, key)
+		h.pendingMutex.Unlock()
+		h.report(p.from, p.busData, h.statusOf(p, StatusFailed, "ack timeout"))
+		return
+	}
+	p.attempts++
+	retries := p.attempts - 1
+	// 每次重发等待时长翻倍
+	p.timer = time.AfterFunc(h.ackTimeout<<uint(retries), func() {
+		h.retransmit(key)
+	})
+	h.pendingMutex.Unlock()
+	h.log.Infof("%s消息等待确认超时，重发第%d次，连接标识：%s，消息标识：%s", p.conn.Protocol(), retries, p.conn.ID(), p.busData.MsgID)
+	if err := p.conn.Send(p.data); err != nil {
+		h.log.Errorf("%s消息重发失败，连接标识：%s，错误信息：%s", p.conn.Protocol(), p.conn.ID(), err.Error())
+	}
+}
+
+//abandon 连接关闭时回报该连接上未确认的消息投递失败
+func (h *Hub) abandon(conn Conn) {
+	var abandoned []*pending
+	h.pendingMutex.Lock()
+	for key, p := range h.pendings {
+		if p.conn == conn {
+			p.timer.Stop()
+			delete(h.pendings, key)
+			abandoned = append(abandoned, p)
+		}
+	}
+	h.pendingMutex.Unlock()
+	for _, p := range abandoned {
+		h.report(p.from, p.busData, h.statusOf(p, StatusFailed, "connection closed"))
+	}
+}
+
+//statusOf 等待确认的投递的结果
+func (h *Hub) statusOf(p *pending, status string, reason string) DeliveryStatus {
+	userID, sourceID := p.conn.Identity()
+	return DeliveryStatus{
+		MsgID:    p.busData.MsgID,
+		Status:   status,
+		UserID:   userID,
+		SourceID: sourceID,
+		ConnID:   p.conn.ID(),
+		Attempts: p.attempts,
+		Reason:   reason,
+	}
+}
+
+//report 回报投递状态：调用回调，并通知发送方连接，发送方连接未知时通知发送方用户；发送方不在线时丢弃，不暂存为离线消息
+func (h *Hub) report(from string, busData global.BusinessData, status DeliveryStatus) {
+	h.log.Infof("消息投递状态，消息标识：%s，状态：%s，接收方用户账号：%s，接收方连接标识：%s", status.MsgID, status.Status, status.UserID, status.ConnID)
+	h.pendingMutex.Lock()
+	callback := h.onDelivery
+	h.pendingMutex.Unlock()
+	if callback != nil {
+		callback(status)
+	}
+	event := global.BusinessData{OpType: OpDelivery, Data: status}
+	if from != "" {
+		event.Mode, event.Targets = ModeConn, []string{from}
+	} else if busData.UserID != "" {
+		event.Mode, event.Targets = ModeUser, []string{busData.UserID}
+	} else {
+		return
+	}
+	if err := h.Dispatch(event); err != nil {
+		h.log.Errorf("回报投递状态失败，消息标识：%s，错误信息：%s", status.MsgID, err.Error())
+	}
+}
+
+//pendingKey 等待确认的投递的键
+func pendingKey(msgID string, connID string) string {
+	return msgID + "/" + connID
+}
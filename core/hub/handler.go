@@ -0,0 +1,110 @@
+/*
+ * @Descripttion: 操作类型处理，按 opType 调用注册的服务端处理函数
+ * @Author: chenjun
+ * @Date: 2026-10-18 19:48:10
+ */
+
+package hub
+
+import (
+	"go-cmd-transfer/global"
+	"go-cmd-transfer/utils"
+)
+
+const (
+	//OpLogin 登录，绑定连接身份并返回连接信息
+	OpLogin = "login"
+	//OpHeartbeat 应用层心跳
+	OpHeartbeat = "heartbeat"
+	//OpExec 下发命令，按投递目标转发，opType 为空时按此处理
+	OpExec = "cmd.exec"
+
+	// 未注册的操作类型的响应编码
+	unknownOpCode = "4040"
+)
+
+//Handler 操作类型处理函数，返回错误时向发送方返回失败消息；未调用 Forward 的消息不再投递
+type Handler func(ctx *Context) error
+
+//Context 一条报文的处理上下文
+type Context struct {
+	// 连接中心
+	Hub *Hub
+	// 发送方连接
+	Conn Conn
+	// 业务数据，身份与消息标识已由连接中心设置，修改后再 Forward 即可改变投递目标
+	Message *global.BusinessData
+}
+
+//Reply 向发送方连接返回数据
+func (ctx *Context) Reply(data string) error {
+	return ctx.Conn.Send([]byte(data))
+}
+
+//Forward 按业务数据的投递目标转发
+func (ctx *Context) Forward() error {
+	return ctx.Hub.dispatch(*ctx.Message, ctx.Conn.ID())
+}
+
+//Handle 注册操作类型的处理函数，重复注册时覆盖，可在运行中调用
+func (h *Hub) Handle(opType string, handler Handler) {
+	h.handlerMutex.Lock()
+	h.handlers[opType] = handler
+	h.handlerMutex.Unlock()
+}
+
+//handle 调用操作类型的处理函数，未注册时返回失败消息
+func (h *Hub) handle(from Conn, busData global.BusinessData) error {
+	opType := busData.OpType
+	if opType == "" {
+		opType = OpExec
+	}
+	h.handlerMutex.RLock()
+	handler, ok := h.handlers[opType]
+	h.handlerMutex.RUnlock()
+	if !ok {
+		return from.Send(failure(busData, unknownOpCode, "unknown opType: "+opType))
+	}
+	if !h.allowSend(from, busData, opType) {
+		return nil
+	}
+	return handler(&Context{Hub: h, Conn: from, Message: &busData})
+}
+
+//opLabel 监控指标中的操作类型，未注册的操作类型统一为 unknown，避免客户端随意填写导致指标过多
+func (h *Hub) opLabel(opType string) string {
+	if opType == "" {
+		return OpExec
+	}
+	if opType == OpAck || opType == OpDelivery {
+		return opType
+	}
+	h.handlerMutex.RLock()
+	_, ok := h.handlers[opType]
+	h.handlerMutex.RUnlock()
+	if !ok {
+		return "unknown"
+	}
+	return opType
+}
+
+//registerBuiltins 注册内置的处理函数
+func (h *Hub) registerBuiltins() {
+	// 身份在 Receive 中已绑定，返回绑定结果
+	h.Handle(OpLogin, func(ctx *Context) error {
+		userID, sourceID := ctx.Conn.Identity()
+		return ctx.Reply(utils.SuccessDataMessage("login", map[string]string{
+			"connId":   ctx.Conn.ID(),
+			"userId":   userID,
+			"sourceId": sourceID,
+			"node":     ctx.Hub.Node(),
+		}))
+	})
+	h.Handle(OpHeartbeat, func(ctx *Context) error {
+		return ctx.Reply(utils.SuccessWithMessage(OpHeartbeat))
+	})
+	h.Handle(OpExec, func(ctx *Context) error {
+		return ctx.Forward()
+	})
+	h.registerTopicHandlers()
+}
@@ -0,0 +1,510 @@
+/*
+ * @Descripttion: 连接中心，统一管理socket与websocket连接及消息投递
+ * @Author: chenjun
+ * @Date: 2026-10-18 10:05:21
+ */
+
+package hub
+
+import (
+	"context"
+	"fmt"
+	"go-cmd-transfer/core/metrics"
+	"go-cmd-transfer/core/offline"
+	"go-cmd-transfer/core/presence"
+	"go-cmd-transfer/global"
+	"go-cmd-transfer/utils"
+	"hash/fnv"
+	"runtime"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	logger "github.com/sirupsen/logrus"
+)
+
+//实例化工具类
+var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+const (
+	// 每个投递协程的队列长度
+	dispatchQueueSize = 4096
+)
+
+//job 待投递的业务数据
+type job struct {
+	// 发送方连接
+	from Conn
+	// 业务数据
+	busData global.BusinessData
+	// 收到报文的时间
+	received time.Time
+}
+
+//Conn 连接接口，由socket连接与websocket连接实现
+type Conn interface {
+	// 连接标识
+	ID() string
+	// 连接所属协议 socket/websocket
+	Protocol() string
+	// 网络地址
+	Addr() string
+	// 连接时间
+	ConnectedAt() time.Time
+	// 绑定连接身份
+	Bind(userID string, sourceID string)
+	// 获取连接绑定的身份
+	Identity() (userID string, sourceID string)
+	// 读取与写入的字节数
+	Stats() (bytesIn uint64, bytesOut uint64)
+	// 发送数据到连接的写队列，不阻塞，写队列已满时返回错误
+	Send(data []byte) error
+	// 发送关闭通知，写出写队列中的消息后关闭连接，ctx 期限到达时直接关闭
+	Drain(ctx context.Context)
+	// 关闭连接
+	Close()
+}
+
+//Hub 连接中心，负责两种传输层连接的注册、注销、查找与投递，可并发使用
+type Hub struct {
+	// 连接集合读写锁
+	mutex sync.RWMutex
+	// 所有连接 protocol ===> connID ===> Conn
+	conns map[string]map[string]Conn
+	// 用户账号索引 userID ===> connID ===> Conn
+	users map[string]map[string]Conn
+	// 接入端标识索引 sourceID ===> connID ===> Conn
+	sources map[string]map[string]Conn
+	// 等待登录的连接 connID ===> Conn，登录后注册，关闭时一并关闭
+	waiting map[string]Conn
+	// 主题订阅索引 pattern ===> connID ===> Conn
+	topics map[string]map[string]Conn
+	// 连接订阅的主题 connID ===> pattern
+	subscriptions map[string]map[string]bool
+	// 投递队列，按发送方连接分片，保证同一连接的消息按序投递
+	queues []chan job
+	// 关闭时通知投递协程退出
+	done chan struct{}
+	// 保证只通知一次
+	doneOnce sync.Once
+	// 当前节点标识
+	node string
+	// 集群消息总线，未接入集群时为空
+	backplane Backplane
+	// 授权策略，未设置时不校验
+	policy Policy
+	// 审计回调
+	onAudit func(entry AuditEntry)
+	// 在线注册表，未设置时不记录
+	presence presence.Registry
+	// 离线消息存储，未设置时不暂存
+	offline offline.Store
+	// 等待确认的投递锁
+	pendingMutex sync.Mutex
+	// 等待确认的投递 msgID/connID ===> pending
+	pendings map[string]*pending
+	// 首次等待确认的时长
+	ackTimeout time.Duration
+	// 最多重发次数
+	ackRetries int
+	// 投递状态回调
+	onDelivery func(status DeliveryStatus)
+	// 等待响应的请求锁
+	requestMutex sync.Mutex
+	// 本节点连接发起的等待响应的请求 correlationID ===> request
+	requests map[string]*request
+	// 请求未指定超时时长时的默认值
+	requestTimeout time.Duration
+	// 处理函数锁
+	handlerMutex sync.RWMutex
+	// 操作类型处理函数 opType ===> Handler
+	handlers map[string]Handler
+	// 是否正在关闭，关闭后不再处理新收到的报文
+	closing bool
+	// 已收到还未处理完的报文
+	inflight sync.WaitGroup
+	// 日志，连接中心与其中的连接共用
+	log logger.FieldLogger
+}
+
+//New 创建连接中心，并按CPU核数启动投递协程
+func New() *Hub {
+	h := &Hub{
+		conns: map[string]map[string]Conn{
+			ProtocolSocket:    make(map[string]Conn),
+			ProtocolWebsocket: make(map[string]Conn),
+		},
+		users:          make(map[string]map[string]Conn),
+		sources:        make(map[string]map[string]Conn),
+		waiting:        make(map[string]Conn),
+		topics:         make(map[string]map[string]Conn),
+		subscriptions:  make(map[string]map[string]bool),
+		queues:         make([]chan job, runtime.NumCPU()),
+		done:           make(chan struct{}),
+		pendings:       make(map[string]*pending),
+		ackTimeout:     defaultAckTimeout,
+		ackRetries:     defaultAckRetries,
+		requests:       make(map[string]*request),
+		requestTimeout: defaultRequestTimeout,
+		handlers:       make(map[string]Handler),
+		log:            logger.StandardLogger(),
+	}
+	h.registerBuiltins()
+	for i := range h.queues {
+		h.queues[i] = make(chan job, dispatchQueueSize)
+		go h.dispatchLoop(h.queues[i])
+	}
+	return h
+}
+
+//SetLogger 设置日志，需在注册连接前设置，默认使用 logrus 的标准日志
+func (h *Hub) SetLogger(log logger.FieldLogger) {
+	h.log = log
+}
+
+//Logger 连接中心的日志
+func (h *Hub) Logger() logger.FieldLogger {
+	return h.log
+}
+
+//SetNode 设置当前节点标识，集群内唯一
+func (h *Hub) SetNode(node string) {
+	h.mutex.Lock()
+	h.node = node
+	h.mutex.Unlock()
+}
+
+//Node 当前节点标识
+func (h *Hub) Node() string {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return h.node
+}
+
+//AddPending 记录等待登录的连接，登录后调用 Register 注册；连接中心正在关闭时直接关闭连接
+func (h *Hub) AddPending(conn Conn) {
+	h.mutex.Lock()
+	if h.closing {
+		h.mutex.Unlock()
+		h.log.Warnf("连接中心正在关闭，不再接受连接，连接标识：%s，连接地址：%s", conn.ID(), conn.Addr())
+		conn.Close()
+		return
+	}
+	h.waiting[conn.ID()] = conn
+	h.mutex.Unlock()
+}
+
+//Register 注册连接，连接中心正在关闭时直接关闭连接
+func (h *Hub) Register(conn Conn) {
+	h.mutex.Lock()
+	delete(h.waiting, conn.ID())
+	if h.closing {
+		h.mutex.Unlock()
+		h.log.Warnf("连接中心正在关闭，不再注册连接，连接标识：%s，连接地址：%s", conn.ID(), conn.Addr())
+		conn.Close()
+		return
+	}
+	protocolConns, ok := h.conns[conn.Protocol()]
+	if !ok {
+		protocolConns = make(map[string]Conn)
+		h.conns[conn.Protocol()] = protocolConns
+	}
+	if _, ok := protocolConns[conn.ID()]; !ok {
+		// 多个连接中心共用监控指标，按增减计数
+		metrics.Connections.WithLabelValues(conn.Protocol()).Inc()
+	}
+	protocolConns[conn.ID()] = conn
+	h.index(conn)
+	count := len(protocolConns)
+	h.mutex.Unlock()
+	h.log.Infof("%s当前在线连接数:%d", conn.Protocol(), count)
+	h.markOnline(conn)
+}
+
+//Unregister 注销连接，可重复调用
+func (h *Hub) Unregister(conn Conn) {
+	h.mutex.Lock()
+	delete(h.waiting, conn.ID())
+	if _, ok := h.conns[conn.Protocol()][conn.ID()]; ok {
+		delete(h.conns[conn.Protocol()], conn.ID())
+		metrics.Connections.WithLabelValues(conn.Protocol()).Dec()
+	}
+	userID, sourceID := conn.Identity()
+	removeIndex(h.users, userID, conn.ID())
+	removeIndex(h.sources, sourceID, conn.ID())
+	h.unsubscribe(conn.ID(), nil)
+	registry := h.presence
+	h.mutex.Unlock()
+	// 连接关闭时未确认的消息投递失败
+	h.abandon(conn)
+	h.cancelRequests(conn)
+	if registry != nil {
+		if err := registry.Remove(conn.ID()); err != nil {
+			h.log.Errorf("删除在线连接失败，连接标识：%s，错误信息：%s", conn.ID(), err.Error())
+		}
+	}
+}
+
+//Bind 绑定连接身份并建立索引，连接已绑定身份时不变
+func (h *Hub) Bind(conn Conn, userID string, sourceID string) {
+	oldUserID, oldSourceID := conn.Identity()
+	h.mutex.Lock()
+	conn.Bind(userID, sourceID)
+	// 已注销的连接不再建立索引
+	_, registered := h.conns[conn.Protocol()][conn.ID()]
+	if registered {
+		h.index(conn)
+	}
+	h.mutex.Unlock()
+	// 身份变化时更新在线注册表，首次绑定用户账号时投递离线消息
+	newUserID, newSourceID := conn.Identity()
+	if registered && (newUserID != oldUserID || newSourceID != oldSourceID) {
+		h.markOnline(conn)
+		if newUserID != oldUserID {
+			h.flushOffline(conn, newUserID)
+		}
+	}
+}
+
+//Lookup 按连接标识查找连接
+func (h *Hub) Lookup(connID string) (Conn, bool) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	for _, protocolConns := range h.conns {
+		if conn, ok := protocolConns[connID]; ok {
+			return conn, true
+		}
+	}
+	return nil, false
+}
+
+//Conns 获取协议下的所有连接，协议为空时获取所有连接
+func (h *Hub) Conns(protocol string) []Conn {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	var conns []Conn
+	for p, protocolConns := range h.conns {
+		if protocol != "" && p != protocol {
+			continue
+		}
+		for _, conn := range protocolConns {
+			conns = append(conns, conn)
+		}
+	}
+	return conns
+}
+
+//Count 获取协议下的连接数
+func (h *Hub) Count(protocol string) int {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return len(h.conns[protocol])
+}
+
+/*
+Receive 处理连接收到的一条报文：解析业务数据、绑定身份后放入投递队列，由操作类型的处理函数处理
+ * @param from 发送方连接
+ * @param data 报文数据
+*/
+func (h *Hub) Receive(from Conn, data []byte) {
+	received := time.Now()
+	if json.Valid(data) == false {
+		metrics.DecodeErrors.WithLabelValues(from.Protocol()).Inc()
+		h.log.Warnf("读取%s消息时，该消息不是一个json字符串，不做处理", from.Protocol())
+		return
+	}
+	busData := global.BusinessData{}
+	if err := json.Unmarshal(data, &busData); err != nil {
+		metrics.DecodeErrors.WithLabelValues(from.Protocol()).Inc()
+		h.log.Errorf("读取%s消息时，该消息是一个json字符串，进行解析格式化，解析错误：%s", from.Protocol(), err.Error())
+		return
+	}
+	metrics.MessagesIn.WithLabelValues(from.Protocol(), h.opLabel(busData.OpType)).Inc()
+	// 接收方确认消息，不再投递
+	if busData.OpType == OpAck {
+		h.Ack(from, busData.MsgID)
+		return
+	}
+	// 消息标识由服务端分配，需要确认的消息先告知发送方消息标识，用于对应之后的投递状态
+	busData.MsgID = utils.Get32UUID()
+	if !h.accept(from, busData) {
+		return
+	}
+	// 首条报文绑定连接身份，之后以绑定的身份为准
+	h.Bind(from, busData.UserID, busData.SourceID)
+	busData.UserID, busData.SourceID = from.Identity()
+	if busData.RequireAck {
+		from.Send([]byte(utils.SuccessDataMessage("accepted", map[string]string{"msgId": busData.MsgID})))
+	}
+	// 放入投递队列，队列满时阻塞发送方的读协程，形成背压；投递协程已退出时丢弃
+	select {
+	case h.queues[h.shard(from.ID())] <- job{from, busData, received}:
+	case <-h.done:
+		h.inflight.Done()
+	}
+}
+
+//dispatchLoop 投递协程，有消息入队时才被唤醒，连接中心关闭时退出
+func (h *Hub) dispatchLoop(queue chan job) {
+	for {
+		select {
+		case j := <-queue:
+			// 按操作类型处理，默认按报文协议投递到 socket 或 websocket 连接
+			if err := h.handle(j.from, j.busData); err != nil {
+				h.log.Errorf("转发%s消息失败：%s", j.from.Protocol(), err.Error())
+				j.from.Send(failure(j.busData, failedCode, err.Error()))
+			}
+			metrics.Since(j.from.Protocol(), j.received)
+			h.inflight.Done()
+		case <-h.done:
+			return
+		}
+	}
+}
+
+//shard 按连接标识选择投递队列
+func (h *Hub) shard(connID string) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(connID))
+	return int(hash.Sum32() % uint32(len(h.queues)))
+}
+
+/*
+Dispatch 按报文协议将业务数据投递到目标传输层中匹配目标的连接，与发送方所在的传输层无关，接入集群时同时发布给其他节点
+ * @param busData 业务数据，协议为空时投递到所有传输层
+ * @return: 目标不合法或协议不支持时返回错误
+*/
+func (h *Hub) Dispatch(busData global.BusinessData) error {
+	return h.dispatch(busData, "")
+}
+
+//dispatch 投递业务数据，from 为发送方连接标识，用于回报投递状态
+func (h *Hub) dispatch(busData global.BusinessData, from string) error {
+	if busData.MsgID == "" {
+		busData.MsgID = utils.Get32UUID()
+	}
+	target, err := TargetOf(busData)
+	if err != nil {
+		return err
+	}
+	if busData.Protocol != ProtocolSocket && busData.Protocol != ProtocolWebsocket && busData.Protocol != "" {
+		return fmt.Errorf("unsupported protocol: %s", busData.Protocol)
+	}
+	if target.Mode == ModeReply {
+		// 请求由本节点的连接发起时直接投递，否则发布给其他节点
+		found, err := h.reply(busData, from)
+		if !found {
+			h.log.Infof("响应对应的请求不在本节点或已超时，关联标识：%s", busData.CorrelationID)
+			h.publish(busData, from)
+		}
+		return err
+	}
+	// 连接发起的请求在投递前开始等待响应，目标收到的是服务端生成的关联标识
+	if busData.CorrelationID != "" && from != "" {
+		busData.CorrelationID = h.track(busData, target, from)
+	}
+	h.deliver(busData, target, from)
+	h.publish(busData, from)
+	h.storeOffline(busData, target, from)
+	return nil
+}
+
+//deliver 投递到本节点匹配目标的连接，返回投递的连接数
+func (h *Hub) deliver(busData global.BusinessData, target Target, from string) int {
+	data, err := json.Marshal(busData)
+	if err != nil {
+		h.log.Error("投递消息时，转换json字符串错误", err.Error())
+		return 0
+	}
+	var count int
+	for _, conn := range h.match(busData.Protocol, target) {
+		if !h.allowReceive(conn, busData) {
+			continue
+		}
+		if err := h.send(conn, busData, data, from); err != nil {
+			h.log.Errorf("发送%s消息失败，连接标识：%s，错误信息：%s", conn.Protocol(), conn.ID(), err.Error())
+			// 关闭当前连接，避免处理过慢的连接拖慢投递
+			conn.Close()
+			continue
+		}
+		count++
+	}
+	h.log.Infof("消息转发，目标协议：%s，投递模式：%s，投递连接数：%d，数据信息为：%s", busData.Protocol, target.Mode, count, string(data))
+	return count
+}
+
+//match 在锁内获取匹配投递目标的连接快照，投递在锁外进行
+func (h *Hub) match(protocol string, target Target) []Conn {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	var conns []Conn
+	accept := func(conn Conn) {
+		if protocol == "" || conn.Protocol() == protocol {
+			conns = append(conns, conn)
+		}
+	}
+	switch target.Mode {
+	case ModeBroadcast:
+		for _, protocolConns := range h.conns {
+			for _, conn := range protocolConns {
+				accept(conn)
+			}
+		}
+	case ModeConn:
+		for _, connID := range target.IDs {
+			for _, protocolConns := range h.conns {
+				if conn, ok := protocolConns[connID]; ok {
+					accept(conn)
+				}
+			}
+		}
+	case ModeTopic:
+		h.matchTopics(target.IDs, accept)
+	case ModeUser, ModeSource:
+		index := h.users
+		if target.Mode == ModeSource {
+			index = h.sources
+		}
+		// 目标列表可能重复，按连接标识去重
+		seen := make(map[string]bool)
+		for _, id := range target.IDs {
+			for connID, conn := range index[id] {
+				if !seen[connID] {
+					seen[connID] = true
+					accept(conn)
+				}
+			}
+		}
+	}
+	return conns
+}
+
+//index 按连接身份建立索引，调用方持有写锁
+func (h *Hub) index(conn Conn) {
+	userID, sourceID := conn.Identity()
+	addIndex(h.users, userID, conn)
+	addIndex(h.sources, sourceID, conn)
+}
+
+//addIndex 添加索引项
+func addIndex(index map[string]map[string]Conn, key string, conn Conn) {
+	if key == "" {
+		return
+	}
+	conns, ok := index[key]
+	if !ok {
+		conns = make(map[string]Conn)
+		index[key] = conns
+	}
+	conns[conn.ID()] = conn
+}
+
+//removeIndex 删除索引项
+func removeIndex(index map[string]map[string]Conn, key string, connID string) {
+	if conns, ok := index[key]; ok {
+		delete(conns, connID)
+		if len(conns) == 0 {
+			delete(index, key)
+		}
+	}
+}
@@ -0,0 +1,500 @@
+package hub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-cmd-transfer/core/hub/hubtest"
+	"go-cmd-transfer/core/offline"
+	"go-cmd-transfer/global"
+	"io/ioutil"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	logger "github.com/sirupsen/logrus"
+)
+
+//newTestHub 创建连接中心，测试结束时关闭
+func newTestHub(t *testing.T) *Hub {
+	t.Helper()
+	h := New()
+	log := logger.New()
+	log.SetOutput(ioutil.Discard)
+	h.SetLogger(log)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		h.Shutdown(ctx)
+	})
+	return h
+}
+
+func TestRequestReplyUsesServerCorrelationID(t *testing.T) {
+	h := newTestHub(t)
+	alice, bob, device := hubtest.NewConn("c-alice", "alice"), hubtest.NewConn("c-bob", "bob"), hubtest.NewConn("c-device", "device")
+	for _, conn := range []*hubtest.Conn{alice, bob, device} {
+		h.Register(conn)
+	}
+	// 两个请求方使用相同的关联标识
+	for _, from := range []*hubtest.Conn{alice, bob} {
+		request := global.BusinessData{UserID: from.UserID(), Mode: ModeUser, Targets: []string{"device"}, CorrelationID: "same", Data: from.UserID()}
+		if err := h.dispatch(request, from.ID()); err != nil {
+			t.Fatalf("%s: request: %v", from.ID(), err)
+		}
+	}
+	received := device.Messages()
+	if len(received) != 2 {
+		t.Fatalf("device: got %d requests, want 2", len(received))
+	}
+	for _, raw := range received {
+		request := global.BusinessData{}
+		json.Unmarshal([]byte(raw), &request)
+		if request.CorrelationID == "same" || request.CorrelationID == "" {
+			t.Fatalf("device: got client correlationId %q, want a server generated one", request.CorrelationID)
+		}
+		reply := global.BusinessData{UserID: "device", Mode: ModeReply, CorrelationID: request.CorrelationID, Data: "re:" + request.Data.(string)}
+		if err := h.dispatch(reply, device.ID()); err != nil {
+			t.Fatalf("reply: %v", err)
+		}
+	}
+	for _, from := range []*hubtest.Conn{alice, bob} {
+		reply := from.Last(t)
+		if reply.CorrelationID != "same" || reply.Data != "re:"+from.UserID() {
+			t.Errorf("%s: got reply %+v", from.ID(), reply)
+		}
+	}
+}
+
+func TestReplyFromNonTargetRejected(t *testing.T) {
+	h := newTestHub(t)
+	alice, device, mallory := hubtest.NewConn("c-alice", "alice"), hubtest.NewConn("c-device", "device"), hubtest.NewConn("c-mallory", "mallory")
+	for _, conn := range []*hubtest.Conn{alice, device, mallory} {
+		h.Register(conn)
+	}
+	request := global.BusinessData{UserID: "alice", Mode: ModeUser, Targets: []string{"device"}, CorrelationID: "r1"}
+	if err := h.dispatch(request, alice.ID()); err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	id := device.Last(t).CorrelationID
+	forged := global.BusinessData{UserID: "mallory", Mode: ModeReply, CorrelationID: id, Data: "forged"}
+	if err := h.dispatch(forged, mallory.ID()); !errors.Is(err, errReplyNotAllowed) {
+		t.Fatalf("forged reply: got error %v, want %v", err, errReplyNotAllowed)
+	}
+	if got := alice.Messages(); len(got) != 0 {
+		t.Fatalf("alice: received forged reply %q", got)
+	}
+	// 请求仍在等待，目标的响应正常投递
+	reply := global.BusinessData{UserID: "device", Mode: ModeReply, CorrelationID: id, Data: "ok"}
+	if err := h.dispatch(reply, device.ID()); err != nil {
+		t.Fatalf("reply: %v", err)
+	}
+	if got := alice.Last(t); got.Data != "ok" || got.CorrelationID != "r1" {
+		t.Errorf("alice: got reply %+v", got)
+	}
+}
+
+func TestReplyIgnoresProtocolAndResolvesAfterDelivery(t *testing.T) {
+	h := newTestHub(t)
+	alice, device := hubtest.NewConn("c-alice", "alice"), hubtest.NewConn("c-device", "device")
+	alice.FailSends(errors.New("queue full"))
+	h.Register(alice)
+	h.Register(device)
+	request := global.BusinessData{UserID: "alice", Mode: ModeUser, Targets: []string{"device"}, CorrelationID: "r1"}
+	if err := h.dispatch(request, alice.ID()); err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	id := device.Last(t).CorrelationID
+	// 响应指定的协议与请求方不同，投递失败时请求继续等待
+	reply := global.BusinessData{UserID: "device", Mode: ModeReply, Protocol: ProtocolWebsocket, CorrelationID: id, Data: "ok"}
+	if err := h.dispatch(reply, device.ID()); err == nil {
+		t.Fatal("reply to a failing connection: expected error")
+	}
+	alice.FailSends(nil)
+	if err := h.dispatch(reply, device.ID()); err != nil {
+		t.Fatalf("reply: %v", err)
+	}
+	if got := alice.Last(t); got.Data != "ok" {
+		t.Errorf("alice: got reply %+v", got)
+	}
+	// 已结束的请求不再接受响应
+	before := len(alice.Messages())
+	h.dispatch(reply, device.ID())
+	if got := alice.Messages(); len(got) != before {
+		t.Errorf("alice: received a second reply %q", got[len(got)-1])
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	h := newTestHub(t)
+	alice, device := hubtest.NewConn("c-alice", "alice"), hubtest.NewConn("c-device", "device")
+	h.Register(alice)
+	h.Register(device)
+	request := global.BusinessData{UserID: "alice", Mode: ModeUser, Targets: []string{"device"}, CorrelationID: "r1", Timeout: 20}
+	if err := h.dispatch(request, alice.ID()); err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for len(alice.Messages()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	got := alice.Messages()
+	if len(got) != 1 || !strings.Contains(got[0], requestTimeoutCode) || !strings.Contains(got[0], `"correlationId":"r1"`) {
+		t.Fatalf("alice: got %q, want a timeout carrying the client correlationId", got)
+	}
+}
+
+func TestShutdownClosesPendingConnections(t *testing.T) {
+	h := New()
+	log := logger.New()
+	log.SetOutput(ioutil.Discard)
+	h.SetLogger(log)
+	waiting, loggedIn := hubtest.NewConn("c-waiting", ""), hubtest.NewConn("c-logged-in", "")
+	h.AddPending(waiting)
+	h.AddPending(loggedIn)
+	// 登录后注册的连接由关闭通知关闭，不再按等待登录处理
+	h.Register(loggedIn)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	h.Shutdown(ctx)
+	if !waiting.IsClosed() {
+		t.Error("waiting connection was not closed on shutdown")
+	}
+	if loggedIn.IsClosed() {
+		t.Error("registered connection was closed as a waiting connection")
+	}
+	// 关闭后记录的连接直接关闭
+	late := hubtest.NewConn("c-late", "")
+	h.AddPending(late)
+	if !late.IsClosed() {
+		t.Error("connection added after shutdown was not closed")
+	}
+}
+
+func TestShutdownStopsDispatchLoopsAndTimers(t *testing.T) {
+	before := runtime.NumGoroutine()
+	h := New()
+	log := logger.New()
+	log.SetOutput(ioutil.Discard)
+	h.SetLogger(log)
+	alice, device := hubtest.NewConn("c-alice", "alice"), hubtest.NewConn("c-device", "device")
+	h.Register(alice)
+	h.Register(device)
+	// 等待响应的请求与等待确认的投递各留下一个定时器
+	h.Receive(alice, []byte(`{"mode":"user","targets":["device"],"correlationId":"r1","timeout":60000,"requireAck":true,"data":"ls"}`))
+	deadline := time.Now().Add(time.Second)
+	for len(device.Messages()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	h.Shutdown(ctx)
+	h.pendingMutex.Lock()
+	pendings := len(h.pendings)
+	h.pendingMutex.Unlock()
+	h.requestMutex.Lock()
+	requests := len(h.requests)
+	h.requestMutex.Unlock()
+	if pendings != 0 || requests != 0 {
+		t.Errorf("after shutdown: %d pending deliveries, %d pending requests, want none", pendings, requests)
+	}
+	// 投递协程全部退出
+	deadline = time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := runtime.NumGoroutine(); got > before {
+		t.Errorf("goroutines: %d before New, %d after Shutdown", before, got)
+	}
+	// 关闭后收到的报文不再阻塞
+	done := make(chan struct{})
+	go func() {
+		h.Receive(alice, []byte(`{"mode":"user","targets":["device"],"data":"late"}`))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Receive blocked after shutdown")
+	}
+}
+
+func TestRequestErrorsCarryCorrelationID(t *testing.T) {
+	h := newTestHub(t)
+	alice := hubtest.NewConn("c-alice", "alice")
+	h.Register(alice)
+	h.Handle("fail", func(ctx *Context) error {
+		return errors.New("handler failed")
+	})
+	tests := []struct {
+		data string
+		code string
+	}{
+		{`{"opType":"nope","mode":"user","targets":["device"],"correlationId":"r1"}`, unknownOpCode},
+		{`{"opType":"fail","mode":"user","targets":["device"],"correlationId":"r2"}`, failedCode},
+	}
+	for i, tt := range tests {
+		h.Receive(alice, []byte(tt.data))
+		deadline := time.Now().Add(time.Second)
+		for len(alice.Messages()) <= i && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+		got := alice.Messages()
+		if len(got) <= i {
+			t.Fatalf("%s: no error returned", tt.code)
+		}
+		want := fmt.Sprintf(`"correlationId":"r%d"`, i+1)
+		if !strings.Contains(got[i], `"code":"`+tt.code+`"`) || !strings.Contains(got[i], want) {
+			t.Errorf("%s: got %s, want the code and %s", tt.code, got[i], want)
+		}
+	}
+}
+
+func TestTopicFanOut(t *testing.T) {
+	h := newTestHub(t)
+	wildcard, site1, other := hubtest.NewConn("c-wildcard", "ops"), hubtest.NewConn("c-site1", "site1"), hubtest.NewConn("c-other", "other")
+	for _, conn := range []*hubtest.Conn{wildcard, site1, other} {
+		h.Register(conn)
+	}
+	if err := h.Subscribe(wildcard, []string{"site.*.alarms"}); err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	// 同一连接订阅的多个主题都匹配时只投递一次
+	if err := h.Subscribe(site1, []string{"site.1.alarms", "site.1.*", "site.1.alarms"}); err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	if got := h.Subscriptions(site1); !reflect.DeepEqual(got, []string{"site.1.*", "site.1.alarms"}) {
+		t.Errorf("site1 subscriptions: got %v", got)
+	}
+	publish := func(topic string) {
+		t.Helper()
+		if err := h.Dispatch(global.BusinessData{Mode: ModeTopic, Targets: []string{topic}, Data: topic}); err != nil {
+			t.Fatalf("publish %s: %v", topic, err)
+		}
+	}
+	tests := []struct {
+		topic string
+		want  map[*hubtest.Conn]int
+	}{
+		{"site.1.alarms", map[*hubtest.Conn]int{wildcard: 1, site1: 1}},
+		{"site.2.alarms", map[*hubtest.Conn]int{wildcard: 2, site1: 1}},
+		{"site.1.status", map[*hubtest.Conn]int{wildcard: 2, site1: 2}},
+		{"site.1.alarms.high", map[*hubtest.Conn]int{wildcard: 2, site1: 2}},
+	}
+	for _, tt := range tests {
+		publish(tt.topic)
+		for _, conn := range []*hubtest.Conn{wildcard, site1, other} {
+			if got := len(conn.Messages()); got != tt.want[conn] {
+				t.Errorf("after %s: %s got %d messages, want %d", tt.topic, conn.ID(), got, tt.want[conn])
+			}
+		}
+	}
+
+	// 取消部分订阅后其他订阅仍然有效，主题为空时取消所有订阅
+	h.Unsubscribe(site1, []string{"site.1.*"})
+	publish("site.1.status")
+	publish("site.1.alarms")
+	if got := len(site1.Messages()); got != 3 {
+		t.Errorf("site1 after partial unsubscribe: got %d messages, want 3", got)
+	}
+	h.Unsubscribe(site1, nil)
+	if got := h.Subscriptions(site1); len(got) != 0 {
+		t.Errorf("site1 after unsubscribing all: got %v", got)
+	}
+	// 注销的连接自动取消订阅
+	h.Unregister(wildcard)
+	publish("site.1.alarms")
+	if got := len(wildcard.Messages()); got != 3 {
+		t.Errorf("wildcard after unregister: got %d messages, want 3", got)
+	}
+	if got := len(site1.Messages()); got != 3 {
+		t.Errorf("site1 after unsubscribing all: got %d messages, want 3", got)
+	}
+	h.mutex.RLock()
+	topics, subscriptions := len(h.topics), len(h.subscriptions)
+	h.mutex.RUnlock()
+	if topics != 0 || subscriptions != 0 {
+		t.Errorf("index after unsubscribing all: %d topics, %d subscriptions, want none", topics, subscriptions)
+	}
+}
+
+func TestSubscribeErrors(t *testing.T) {
+	h := newTestHub(t)
+	conn := hubtest.NewConn("c-device", "device")
+	if err := h.Subscribe(conn, []string{"a"}); err == nil {
+		t.Error("unregistered connection: expected error")
+	}
+	h.Register(conn)
+	for _, pattern := range []string{"", "site..alarms", "site.1*.alarms", ".site"} {
+		if err := h.Subscribe(conn, []string{pattern}); err == nil {
+			t.Errorf("%q: expected invalid topic error", pattern)
+		}
+	}
+	patterns := make([]string, 0, maxSubscriptions+1)
+	for i := 0; i <= maxSubscriptions; i++ {
+		patterns = append(patterns, fmt.Sprintf("topic.%d", i))
+	}
+	if err := h.Subscribe(conn, patterns); err == nil {
+		t.Error("too many subscriptions: expected error")
+	}
+	// 超出限制前的主题已订阅
+	if got := len(h.Subscriptions(conn)); got != maxSubscriptions {
+		t.Errorf("got %d subscriptions, want %d", got, maxSubscriptions)
+	}
+}
+
+func TestTopicHandlers(t *testing.T) {
+	h := newTestHub(t)
+	device, console := hubtest.NewConn("c-device", "device"), hubtest.NewConn("c-console", "console")
+	h.Register(device)
+	h.Register(console)
+	h.Receive(device, []byte(`{"opType":"subscribe","targets":["site.*.alarms","site.1.cmd"]}`))
+	if got := device.Wait(t, 1)[0]; !strings.Contains(got, `"message":"subscribe"`) || !strings.Contains(got, `["site.*.alarms","site.1.cmd"]`) {
+		t.Fatalf("subscribe: got %s", got)
+	}
+	// 发布的主题不能使用通配符
+	h.Receive(console, []byte(`{"opType":"publish","targets":["site.*.alarms"],"data":"all"}`))
+	if got := console.Wait(t, 1)[0]; !strings.Contains(got, `"status":false`) {
+		t.Errorf("publish to a wildcard: got %s, want an error", got)
+	}
+	h.Receive(console, []byte(`{"opType":"publish","targets":["site.2.alarms"],"data":"alarm"}`))
+	if got := device.Wait(t, 2); !strings.Contains(got[1], `"data":"alarm"`) || !strings.Contains(got[1], `"userId":"console"`) {
+		t.Errorf("publish: device got %s", got[1])
+	}
+	h.Receive(device, []byte(`{"opType":"unsubscribe","targets":["site.*.alarms"]}`))
+	if got := device.Wait(t, 3)[2]; !strings.Contains(got, `"message":"unsubscribe"`) || !strings.Contains(got, `["site.1.cmd"]`) {
+		t.Errorf("unsubscribe: got %s", got)
+	}
+}
+
+//collectDeliveries 记录投递状态回调
+func collectDeliveries(h *Hub) chan DeliveryStatus {
+	statuses := make(chan DeliveryStatus, 16)
+	h.OnDelivery(func(status DeliveryStatus) {
+		statuses <- status
+	})
+	return statuses
+}
+
+//nextDelivery 等待下一个投递状态，超时结束测试
+func nextDelivery(t *testing.T, statuses chan DeliveryStatus) DeliveryStatus {
+	t.Helper()
+	select {
+	case status := <-statuses:
+		return status
+	case <-time.After(time.Second):
+		t.Fatal("no delivery status reported")
+		return DeliveryStatus{}
+	}
+}
+
+func TestAckStopsRetransmit(t *testing.T) {
+	h := newTestHub(t)
+	h.SetAckPolicy(20*time.Millisecond, 3)
+	statuses := collectDeliveries(h)
+	alice, device := hubtest.NewConn("c-alice", "alice"), hubtest.NewConn("c-device", "device")
+	h.Register(alice)
+	h.Register(device)
+	h.Receive(alice, []byte(`{"mode":"user","targets":["device"],"requireAck":true,"data":"ls"}`))
+	// 发送方先收到分配的消息标识
+	accepted := alice.Wait(t, 1)[0]
+	device.Wait(t, 1)
+	request := device.Last(t)
+	if !strings.Contains(accepted, `"message":"accepted"`) || !strings.Contains(accepted, request.MsgID) {
+		t.Fatalf("alice: got %s, want the accepted msgId %s", accepted, request.MsgID)
+	}
+	h.Receive(device, []byte(`{"opType":"ack","msgId":"`+request.MsgID+`"}`))
+	status := nextDelivery(t, statuses)
+	if status.Status != StatusDelivered || status.MsgID != request.MsgID || status.ConnID != device.ID() || status.Attempts != 1 {
+		t.Errorf("got status %+v", status)
+	}
+	// 发送方连接收到投递状态
+	if got := alice.Wait(t, 2)[1]; !strings.Contains(got, `"opType":"delivery"`) || !strings.Contains(got, `"status":"delivered"`) {
+		t.Errorf("alice: got %s, want a delivered report", got)
+	}
+	// 确认后不再重发
+	time.Sleep(100 * time.Millisecond)
+	if got := len(device.Messages()); got != 1 {
+		t.Errorf("device: got %d copies after ack, want 1", got)
+	}
+}
+
+func TestRetransmitUntilRetriesExhausted(t *testing.T) {
+	h := newTestHub(t)
+	h.SetAckPolicy(10*time.Millisecond, 2)
+	statuses := collectDeliveries(h)
+	alice, device := hubtest.NewConn("c-alice", "alice"), hubtest.NewConn("c-device", "device")
+	h.Register(alice)
+	h.Register(device)
+	h.Receive(alice, []byte(`{"mode":"user","targets":["device"],"requireAck":true,"data":"ls"}`))
+	start := time.Now()
+	status := nextDelivery(t, statuses)
+	// 首次发送后按10、20毫秒重发2次，再等待40毫秒后回报失败
+	if elapsed := time.Since(start); elapsed < 70*time.Millisecond {
+		t.Errorf("failed after %s, want at least 70ms of backoff", elapsed)
+	}
+	if status.Status != StatusFailed || status.Attempts != 3 || status.Reason != "ack timeout" {
+		t.Errorf("got status %+v", status)
+	}
+	copies := device.Messages()
+	if len(copies) != 3 || copies[0] != copies[1] || copies[1] != copies[2] {
+		t.Errorf("device: got %d copies %q, want the same message 3 times", len(copies), copies)
+	}
+	if got := alice.Wait(t, 2)[1]; !strings.Contains(got, `"status":"failed"`) {
+		t.Errorf("alice: got %s, want a failed report", got)
+	}
+	// 超时后的确认被忽略
+	h.Ack(device, device.Last(t).MsgID)
+	select {
+	case status := <-statuses:
+		t.Errorf("late ack reported %+v", status)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestUnregisterFailsPendingDeliveries(t *testing.T) {
+	h := newTestHub(t)
+	h.SetAckPolicy(time.Minute, 1)
+	statuses := collectDeliveries(h)
+	alice, device := hubtest.NewConn("c-alice", "alice"), hubtest.NewConn("c-device", "device")
+	h.Register(alice)
+	h.Register(device)
+	h.Receive(alice, []byte(`{"mode":"user","targets":["device"],"requireAck":true,"data":"ls"}`))
+	device.Wait(t, 1)
+	h.Unregister(device)
+	if status := nextDelivery(t, statuses); status.Status != StatusFailed || status.Reason != "connection closed" {
+		t.Errorf("got status %+v", status)
+	}
+}
+
+func TestDeliveryReportsAreNotStoredOffline(t *testing.T) {
+	h := newTestHub(t)
+	store := offline.NewMemoryStore(offline.Options{})
+	h.UseOfflineStore(store)
+	statuses := collectDeliveries(h)
+	alice := hubtest.NewConn("c-alice", "alice")
+	h.Register(alice)
+	// 目标不在线时暂存并回报 stored
+	h.Receive(alice, []byte(`{"mode":"user","targets":["device"],"requireAck":true,"data":"ls"}`))
+	if status := nextDelivery(t, statuses); status.Status != StatusStored || status.UserID != "device" {
+		t.Fatalf("got status %+v", status)
+	}
+	if got := alice.Wait(t, 2)[1]; !strings.Contains(got, `"status":"stored"`) {
+		t.Errorf("alice: got %s, want a stored report", got)
+	}
+	// 发送方离线后，上线的目标确认离线消息，回报给发送方用户时不暂存
+	h.Unregister(alice)
+	device := hubtest.NewConn("c-device", "")
+	h.Register(device)
+	h.Bind(device, "device", "")
+	device.Wait(t, 1)
+	h.Ack(device, device.Last(t).MsgID)
+	if status := nextDelivery(t, statuses); status.Status != StatusDelivered {
+		t.Fatalf("got status %+v", status)
+	}
+	if messages, _ := store.Pop("alice"); len(messages) != 0 {
+		t.Errorf("alice: %d delivery reports stored offline, want none", len(messages))
+	}
+}
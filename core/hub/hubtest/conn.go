@@ -0,0 +1,135 @@
+/*
+ * @Descripttion: 测试用的连接，记录收到的报文，供连接中心及其上层的测试共用
+ * @Author: chenjun
+ * @Date: 2026-10-18 21:12:40
+ */
+
+package hubtest
+
+import (
+	"context"
+	"go-cmd-transfer/global"
+	"sync"
+	"testing"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+//实例化工具类
+var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+// 连接中心的内部测试也使用本包，不能引用 hub 包，协议名与 hub.ProtocolSocket 保持一致
+const protocolSocket = "socket"
+
+//Conn 记录收到的报文的连接，实现 hub.Conn
+type Conn struct {
+	id       string
+	userID   string
+	sourceID string
+	mutex    sync.Mutex
+	// 发送失败时返回的错误
+	sendErr  error
+	received []string
+	closed   bool
+}
+
+//NewConn 创建socket连接，userID 为空时未绑定用户账号
+func NewConn(id string, userID string) *Conn {
+	return &Conn{id: id, userID: userID}
+}
+
+func (c *Conn) ID() string                { return c.id }
+func (c *Conn) Protocol() string          { return protocolSocket }
+func (c *Conn) Addr() string              { return "test:" + c.id }
+func (c *Conn) ConnectedAt() time.Time    { return time.Time{} }
+func (c *Conn) Stats() (uint64, uint64)   { return 0, 0 }
+func (c *Conn) Drain(ctx context.Context) {}
+
+func (c *Conn) Identity() (string, string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.userID, c.sourceID
+}
+
+func (c *Conn) Bind(userID string, sourceID string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.userID == "" {
+		c.userID = userID
+	}
+	if c.sourceID == "" {
+		c.sourceID = sourceID
+	}
+}
+
+func (c *Conn) Close() {
+	c.mutex.Lock()
+	c.closed = true
+	c.mutex.Unlock()
+}
+
+func (c *Conn) Send(data []byte) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.sendErr != nil {
+		return c.sendErr
+	}
+	c.received = append(c.received, string(data))
+	return nil
+}
+
+//UserID 绑定的用户账号
+func (c *Conn) UserID() string {
+	userID, _ := c.Identity()
+	return userID
+}
+
+//FailSends 之后的发送返回 err，err 为空时恢复发送
+func (c *Conn) FailSends(err error) {
+	c.mutex.Lock()
+	c.sendErr = err
+	c.mutex.Unlock()
+}
+
+//IsClosed 是否已关闭
+func (c *Conn) IsClosed() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.closed
+}
+
+//Messages 收到的报文
+func (c *Conn) Messages() []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return append([]string(nil), c.received...)
+}
+
+//Last 最后收到的业务数据，没有时结束测试
+func (c *Conn) Last(t *testing.T) global.BusinessData {
+	t.Helper()
+	messages := c.Messages()
+	if len(messages) == 0 {
+		t.Fatalf("%s: no message received", c.id)
+	}
+	busData := global.BusinessData{}
+	if err := json.Unmarshal([]byte(messages[len(messages)-1]), &busData); err != nil {
+		t.Fatalf("%s: %v", c.id, err)
+	}
+	return busData
+}
+
+//Wait 等待收到至少 n 条报文，超时结束测试
+func (c *Conn) Wait(t *testing.T, n int) []string {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for len(c.Messages()) < n && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	messages := c.Messages()
+	if len(messages) < n {
+		t.Fatalf("%s: got %d messages, want %d", c.id, len(messages), n)
+	}
+	return messages
+}
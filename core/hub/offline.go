@@ -0,0 +1,124 @@
+/*
+ * @Descripttion: 连接中心接入离线消息存储
+ * @Author: chenjun
+ * @Date: 2026-10-18 17:21:40
+ */
+
+package hub
+
+import (
+	"go-cmd-transfer/core/offline"
+	"go-cmd-transfer/core/presence"
+	"go-cmd-transfer/global"
+)
+
+//UseOfflineStore 设置离线消息存储，按用户账号投递时目标用户不在线的消息暂存，用户上线时按序投递
+func (h *Hub) UseOfflineStore(store offline.Store) {
+	h.mutex.Lock()
+	h.offline = store
+	h.mutex.Unlock()
+}
+
+//storeOffline 暂存目标用户中不在线用户的消息
+func (h *Hub) storeOffline(busData global.BusinessData, target Target, from string) {
+	h.mutex.RLock()
+	store := h.offline
+	h.mutex.RUnlock()
+	// 投递状态回报只通知在线的发送方，发送方上线后的状态已无意义，不暂存
+	if store == nil || target.Mode != ModeUser || busData.OpType == OpDelivery {
+		return
+	}
+	var data []byte
+	for _, userID := range target.IDs {
+		if h.online(busData.Protocol, userID) {
+			continue
+		}
+		if data == nil {
+			var err error
+			if data, err = json.Marshal(busData); err != nil {
+				h.log.Error("暂存离线消息时，转换json字符串错误", err.Error())
+				return
+			}
+		}
+		if err := store.Push(userID, data); err != nil {
+			h.log.Errorf("暂存离线消息失败，用户账号：%s，错误信息：%s", userID, err.Error())
+			continue
+		}
+		h.log.Infof("目标用户不在线，暂存离线消息，用户账号：%s", userID)
+		if busData.RequireAck {
+			h.report(from, busData, DeliveryStatus{MsgID: busData.MsgID, Status: StatusStored, UserID: userID})
+		}
+	}
+}
+
+//online 判断用户在协议下是否有在线连接，优先查本节点，再查在线注册表
+func (h *Hub) online(protocol string, userID string) bool {
+	h.mutex.RLock()
+	registry := h.presence
+	for _, conn := range h.users[userID] {
+		if protocol == "" || conn.Protocol() == protocol {
+			h.mutex.RUnlock()
+			return true
+		}
+	}
+	h.mutex.RUnlock()
+	if registry == nil {
+		return false
+	}
+	entries, err := registry.List(presence.Query{UserID: userID, Protocol: protocol})
+	if err != nil {
+		// 无法确认是否在线时按在线处理，避免重复投递
+		h.log.Errorf("查询用户是否在线失败，用户账号：%s，错误信息：%s", userID, err.Error())
+		return true
+	}
+	return len(entries) > 0
+}
+
+//flushOffline 用户上线时按入队顺序投递离线消息，指定了其他协议的消息与投递失败的消息按原有顺序放回队列头部
+func (h *Hub) flushOffline(conn Conn, userID string) {
+	h.mutex.RLock()
+	store := h.offline
+	h.mutex.RUnlock()
+	if store == nil || userID == "" {
+		return
+	}
+	messages, err := store.Pop(userID)
+	if err != nil {
+		h.log.Errorf("取出离线消息失败，用户账号：%s，错误信息：%s", userID, err.Error())
+		return
+	}
+	var kept []offline.Message
+	delivered := 0
+	for i, msg := range messages {
+		busData := global.BusinessData{}
+		if err := json.Unmarshal(msg.Data, &busData); err != nil {
+			h.log.Error("投递离线消息时，解析json字符串错误", err.Error())
+			continue
+		}
+		// 与暂存时的判断一致，只投递到消息指定的协议，等待该协议的连接上线
+		if busData.Protocol != "" && busData.Protocol != conn.Protocol() {
+			kept = append(kept, msg)
+			continue
+		}
+		// 暂存后授权策略可能已变化
+		if !h.allowReceive(conn, busData) {
+			continue
+		}
+		// 离线消息的发送方连接可能已关闭，投递状态按发送方用户账号回报
+		if err := h.send(conn, busData, msg.Data, ""); err != nil {
+			// 投递失败的消息放回队列，等待下次上线
+			h.log.Errorf("投递离线消息失败，用户账号：%s，剩余消息数：%d，错误信息：%s", userID, len(messages)-i, err.Error())
+			kept = append(kept, messages[i:]...)
+			break
+		}
+		delivered++
+	}
+	if len(kept) > 0 {
+		if err := store.Requeue(userID, kept); err != nil {
+			h.log.Errorf("放回离线消息失败，用户账号：%s，消息数：%d，错误信息：%s", userID, len(kept), err.Error())
+		}
+	}
+	if delivered > 0 {
+		h.log.Infof("用户上线，投递离线消息，用户账号：%s，消息数：%d", userID, delivered)
+	}
+}
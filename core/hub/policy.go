@@ -0,0 +1,190 @@
+/*
+ * @Descripttion: 连接中心接入授权策略，处理报文前校验发送权限，投递前校验接收权限
+ * @Author: chenjun
+ * @Date: 2026-10-18 22:31:55
+ */
+
+package hub
+
+import (
+	"go-cmd-transfer/global"
+	"strings"
+	"time"
+)
+
+const (
+	// 无权限的响应编码
+	forbiddenCode = "4030"
+
+	//AuditSend 发送
+	AuditSend = "send"
+	//AuditReceive 接收
+	AuditReceive = "receive"
+	//AuditReply 响应请求
+	AuditReply = "reply"
+
+	//DecisionAllow 允许
+	DecisionAllow = "allow"
+	//DecisionDeny 拒绝
+	DecisionDeny = "deny"
+)
+
+var (
+	// 审计动作的日志名称
+	auditActions = map[string]string{AuditSend: "发送", AuditReceive: "接收", AuditReply: "响应"}
+	// 不校验发送权限的操作类型
+	exemptSendOps = map[string]bool{OpLogin: true, OpHeartbeat: true, OpUnsubscribe: true}
+	// 不校验接收权限的操作类型
+	exemptReceiveOps = map[string]bool{OpDelivery: true}
+)
+
+//Policy 授权策略，由 core/acl 实现
+type Policy interface {
+	// 用户账号的角色，用于审计记录
+	Roles(userID string) []string
+	// 判断用户能否发送操作类型到所有目标，不允许时返回第一个不允许的目标
+	AllowSend(userID string, opType string, targets []string) (bool, string)
+	// 判断用户能否经任一目标接收操作类型，目标为空时只校验操作类型
+	AllowReceive(userID string, opType string, targets []string) bool
+}
+
+//AuditEntry 授权审计记录
+type AuditEntry struct {
+	Time     time.Time `json:"time"`             // 记录时间
+	Action   string    `json:"action"`           // 动作 send/receive/reply
+	Decision string    `json:"decision"`         // 结果 allow/deny
+	UserID   string    `json:"userId"`           // 用户账号
+	SourceID string    `json:"sourceId"`         // 接入端标识
+	Roles    []string  `json:"roles"`            // 用户账号的角色
+	ConnID   string    `json:"connId"`           // 连接标识
+	Addr     string    `json:"addr"`             // 连接地址，其他节点的连接为空
+	OpType   string    `json:"opType"`           // 操作类型
+	Target   string    `json:"target"`           // 投递目标，拒绝发送时为第一个不允许的目标，多个目标以逗号分隔
+	MsgID    string    `json:"msgId"`            // 消息标识
+	Sender   string    `json:"sender,omitempty"` // 发送方用户账号，接收与响应时记录
+}
+
+//UsePolicy 设置授权策略，为空时不校验，可在运行中替换
+func (h *Hub) UsePolicy(policy Policy) {
+	h.mutex.Lock()
+	h.policy = policy
+	h.mutex.Unlock()
+}
+
+//OnAudit 设置审计回调，启用授权策略后每次校验都会调用，包括允许与拒绝
+func (h *Hub) OnAudit(callback func(entry AuditEntry)) {
+	h.mutex.Lock()
+	h.onAudit = callback
+	h.mutex.Unlock()
+}
+
+//allowSend 校验发送权限，记录审计，不允许时向发送方返回失败消息
+func (h *Hub) allowSend(from Conn, busData global.BusinessData, opType string) bool {
+	h.mutex.RLock()
+	policy := h.policy
+	h.mutex.RUnlock()
+	if policy == nil || exemptSendOps[opType] {
+		return true
+	}
+	userID, sourceID := from.Identity()
+	targets := targetsOf(busData, opType)
+	ok, target := policy.AllowSend(userID, opType, targets)
+	entry := AuditEntry{Action: AuditSend, Decision: DecisionAllow, UserID: userID, SourceID: sourceID, ConnID: from.ID(), Addr: from.Addr(), OpType: opType, Target: strings.Join(targets, ","), MsgID: busData.MsgID}
+	if ok {
+		h.audit(policy, entry)
+		return true
+	}
+	entry.Decision, entry.Target = DecisionDeny, target
+	h.audit(policy, entry)
+	message := "permission denied: " + opType
+	if target != "" {
+		message += " to " + target
+	}
+	from.Send(failure(busData, forbiddenCode, message))
+	return false
+}
+
+//allowReceive 校验接收权限并记录审计，接收目标为连接匹配的投递目标
+func (h *Hub) allowReceive(conn Conn, busData global.BusinessData) bool {
+	h.mutex.RLock()
+	policy := h.policy
+	h.mutex.RUnlock()
+	if policy == nil || exemptReceiveOps[busData.OpType] {
+		return true
+	}
+	opType := busData.OpType
+	if opType == "" {
+		opType = OpExec
+	}
+	userID, sourceID := conn.Identity()
+	targets := receiveTargetsOf(conn, busData, opType)
+	entry := AuditEntry{Action: AuditReceive, Decision: DecisionAllow, UserID: userID, SourceID: sourceID, ConnID: conn.ID(), Addr: conn.Addr(), OpType: opType, Target: strings.Join(targets, ","), MsgID: busData.MsgID, Sender: busData.UserID}
+	if policy.AllowReceive(userID, opType, targets) {
+		h.audit(policy, entry)
+		return true
+	}
+	entry.Decision = DecisionDeny
+	h.audit(policy, entry)
+	return false
+}
+
+//audit 补全角色与时间后调用审计回调，拒绝时同时记录日志
+func (h *Hub) audit(policy Policy, entry AuditEntry) {
+	h.mutex.RLock()
+	callback := h.onAudit
+	h.mutex.RUnlock()
+	if callback == nil && entry.Decision == DecisionAllow {
+		return
+	}
+	entry.Time = time.Now()
+	if policy != nil {
+		entry.Roles = policy.Roles(entry.UserID)
+	}
+	if callback != nil {
+		callback(entry)
+	}
+	if entry.Decision == DecisionDeny {
+		h.log.Warnf("[审计] 拒绝%s，用户账号：%s，角色：%v，接入端标识：%s，连接标识：%s，连接地址：%s，操作类型：%s，投递目标：%s，消息标识：%s，发送方用户账号：%s", auditActions[entry.Action], entry.UserID, entry.Roles, entry.SourceID, entry.ConnID, entry.Addr, entry.OpType, entry.Target, entry.MsgID, entry.Sender)
+	}
+}
+
+//receiveTargetsOf 连接接收消息时匹配的投递目标，按用户账号、接入端标识、连接标识投递时只取连接自身对应的目标
+func receiveTargetsOf(conn Conn, busData global.BusinessData, opType string) []string {
+	target, err := TargetOf(busData)
+	if err != nil {
+		return targetsOf(busData, opType)
+	}
+	userID, sourceID := conn.Identity()
+	switch target.Mode {
+	case ModeUser:
+		return []string{ModeUser + ":" + userID}
+	case ModeSource:
+		return []string{ModeSource + ":" + sourceID}
+	case ModeConn:
+		return []string{ModeConn + ":" + conn.ID()}
+	}
+	return targetsOf(busData, opType)
+}
+
+//targetsOf 业务数据的投递目标，形如 broadcast、user:xxx、topic:xxx，投递目标不合法时为空，由投递时返回错误
+func targetsOf(busData global.BusinessData, opType string) []string {
+	var targets []string
+	if opType == OpSubscribe || opType == OpPublish {
+		for _, topic := range busData.Targets {
+			targets = append(targets, ModeTopic+":"+topic)
+		}
+		return targets
+	}
+	target, err := TargetOf(busData)
+	if err != nil {
+		return nil
+	}
+	switch target.Mode {
+	case ModeBroadcast, ModeReply:
+		return []string{target.Mode}
+	}
+	for _, id := range target.IDs {
+		targets = append(targets, target.Mode+":"+id)
+	}
+	return targets
+}
@@ -0,0 +1,150 @@
+package hub
+
+import (
+	"go-cmd-transfer/config"
+	"go-cmd-transfer/core/acl"
+	"go-cmd-transfer/core/hub/hubtest"
+	"go-cmd-transfer/global"
+	"strings"
+	"sync"
+	"testing"
+)
+
+//auditRecorder 记录审计回调收到的记录
+type auditRecorder struct {
+	mutex   sync.Mutex
+	entries []AuditEntry
+}
+
+func (r *auditRecorder) record(entry AuditEntry) {
+	r.mutex.Lock()
+	r.entries = append(r.entries, entry)
+	r.mutex.Unlock()
+}
+
+//find 查找动作、用户账号与结果相同的最新记录
+func (r *auditRecorder) find(action string, userID string, decision string) (AuditEntry, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for i := len(r.entries) - 1; i >= 0; i-- {
+		entry := r.entries[i]
+		if entry.Action == action && entry.UserID == userID && entry.Decision == decision {
+			return entry, true
+		}
+	}
+	return AuditEntry{}, false
+}
+
+//newPolicyHub 创建启用授权策略与审计回调的连接中心
+func newPolicyHub(t *testing.T) (*Hub, *auditRecorder) {
+	t.Helper()
+	policy, err := acl.New(config.ACL{
+		Enable:      true,
+		DefaultRole: "guest",
+		Users: []config.ACLUser{
+			{UserID: "console", Roles: []string{"operator"}},
+			{UserID: "dev-1", Roles: []string{"device"}},
+			{UserID: "screen", Roles: []string{"viewer"}},
+		},
+		Send: []config.ACLRule{
+			{Roles: []string{"operator"}, OpTypes: []string{"*"}, Targets: []string{"*"}},
+			{Roles: []string{"device"}, OpTypes: []string{"cmd.exec"}, Targets: []string{"user:console"}},
+			{Roles: []string{"*"}, OpTypes: []string{OpSubscribe}, Targets: []string{"topic:*"}},
+		},
+		Receive: []config.ACLRule{
+			{Roles: []string{"operator", "device"}, OpTypes: []string{"*"}},
+			{Roles: []string{"viewer"}, OpTypes: []string{OpPublish}, Targets: []string{"topic:public.*"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("acl.New: %v", err)
+	}
+	h := newTestHub(t)
+	h.UsePolicy(policy)
+	recorder := &auditRecorder{}
+	h.OnAudit(recorder.record)
+	return h, recorder
+}
+
+func TestPolicySendMatrix(t *testing.T) {
+	h, recorder := newPolicyHub(t)
+	console, device, stranger := hubtest.NewConn("c-console", "console"), hubtest.NewConn("c-dev-1", "dev-1"), hubtest.NewConn("c-stranger", "stranger")
+	for _, conn := range []*hubtest.Conn{console, device, stranger} {
+		h.Register(conn)
+	}
+	tests := []struct {
+		from     *hubtest.Conn
+		busData  global.BusinessData
+		allow    bool
+		receiver *hubtest.Conn
+	}{
+		{console, global.BusinessData{Mode: ModeUser, Targets: []string{"dev-1"}, Data: "1"}, true, device},
+		{device, global.BusinessData{Mode: ModeUser, Targets: []string{"console"}, Data: "2"}, true, console},
+		{device, global.BusinessData{Mode: ModeBroadcast, Data: "3"}, false, nil},
+		{device, global.BusinessData{Mode: ModeUser, Targets: []string{"stranger"}, Data: "4"}, false, nil},
+		{stranger, global.BusinessData{Mode: ModeUser, Targets: []string{"console"}, Data: "5"}, false, nil},
+	}
+	for _, tt := range tests {
+		tt.busData.UserID = tt.from.UserID()
+		before := len(tt.from.Messages())
+		if err := h.handle(tt.from, tt.busData); err != nil {
+			t.Fatalf("%s data %v: %v", tt.from.ID(), tt.busData.Data, err)
+		}
+		if tt.allow {
+			if got := tt.receiver.Last(t); got.Data != tt.busData.Data {
+				t.Errorf("%s data %v: receiver got %+v", tt.from.ID(), tt.busData.Data, got)
+			}
+			continue
+		}
+		got := tt.from.Messages()
+		if len(got) != before+1 || !strings.Contains(got[len(got)-1], forbiddenCode) {
+			t.Errorf("%s data %v: got %q, want a %s reply", tt.from.ID(), tt.busData.Data, got, forbiddenCode)
+		}
+	}
+	entry, ok := recorder.find(AuditSend, "dev-1", DecisionDeny)
+	if !ok {
+		t.Fatal("no audit entry for the denied send")
+	}
+	if entry.Target != "user:stranger" || entry.OpType != OpExec || len(entry.Roles) != 1 || entry.Roles[0] != "device" || entry.ConnID != device.ID() || entry.Time.IsZero() {
+		t.Errorf("denied send audit entry: %+v", entry)
+	}
+	if entry, ok := recorder.find(AuditSend, "console", DecisionAllow); !ok || entry.Target != "user:dev-1" {
+		t.Errorf("allowed send audit entry: %+v, %v", entry, ok)
+	}
+	if entry, ok := recorder.find(AuditSend, "stranger", DecisionDeny); !ok || entry.Roles[0] != "guest" {
+		t.Errorf("guest audit entry: %+v, %v", entry, ok)
+	}
+}
+
+func TestPolicyReceiveChecksTopic(t *testing.T) {
+	h, recorder := newPolicyHub(t)
+	console, screen := hubtest.NewConn("c-console", "console"), hubtest.NewConn("c-screen", "screen")
+	h.Register(console)
+	h.Register(screen)
+	if err := h.handle(screen, global.BusinessData{UserID: "screen", OpType: OpSubscribe, Targets: []string{"*.news"}}); err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	base := len(screen.Messages())
+	for _, topic := range []string{"public.news", "private.news"} {
+		publish := global.BusinessData{UserID: "console", OpType: OpPublish, Targets: []string{topic}, Data: topic}
+		if err := h.handle(console, publish); err != nil {
+			t.Fatalf("publish %s: %v", topic, err)
+		}
+	}
+	got := screen.Messages()[base:]
+	if len(got) != 1 || !strings.Contains(got[0], `"public.news"`) {
+		t.Fatalf("screen: got %q, want only public.news", got)
+	}
+	entry, ok := recorder.find(AuditReceive, "screen", DecisionDeny)
+	if !ok || entry.Target != "topic:private.news" || entry.Sender != "console" || entry.OpType != OpPublish {
+		t.Errorf("denied receive audit entry: %+v, %v", entry, ok)
+	}
+	// 其他用户的账号不作为接收目标
+	h.handle(console, global.BusinessData{UserID: "console", Mode: ModeUser, Targets: []string{"screen"}, Data: "direct"})
+	if entry, ok := recorder.find(AuditReceive, "screen", DecisionDeny); !ok || entry.Target != "user:screen" {
+		t.Errorf("denied direct receive audit entry: %+v, %v", entry, ok)
+	}
+	if got := screen.Messages()[base:]; len(got) != 1 {
+		t.Errorf("screen: received %q", got)
+	}
+}
@@ -0,0 +1,65 @@
+/*
+ * @Descripttion: 连接中心接入在线注册表
+ * @Author: chenjun
+ * @Date: 2026-10-18 15:58:26
+ */
+
+package hub
+
+import (
+	"go-cmd-transfer/core/presence"
+)
+
+//UsePresence 设置在线注册表，已注册的连接同时写入
+func (h *Hub) UsePresence(registry presence.Registry) {
+	h.mutex.Lock()
+	h.presence = registry
+	h.mutex.Unlock()
+	for _, conn := range h.Conns("") {
+		h.markOnline(conn)
+	}
+}
+
+//Presence 查询在线连接，未设置在线注册表时只查询本节点
+func (h *Hub) Presence(query presence.Query) ([]presence.Entry, error) {
+	h.mutex.RLock()
+	registry := h.presence
+	h.mutex.RUnlock()
+	if registry != nil {
+		return registry.List(query)
+	}
+	entries := make([]presence.Entry, 0)
+	for _, conn := range h.Conns(query.Protocol) {
+		if entry := h.entryOf(conn); query.Match(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+//markOnline 写入在线注册表
+func (h *Hub) markOnline(conn Conn) {
+	h.mutex.RLock()
+	registry := h.presence
+	h.mutex.RUnlock()
+	if registry == nil {
+		return
+	}
+	if err := registry.Add(h.entryOf(conn)); err != nil {
+		h.log.Errorf("写入在线连接失败，连接标识：%s，错误信息：%s", conn.ID(), err.Error())
+	}
+}
+
+//entryOf 连接的在线信息
+func (h *Hub) entryOf(conn Conn) presence.Entry {
+	userID, sourceID := conn.Identity()
+	return presence.Entry{
+		ConnID:      conn.ID(),
+		UserID:      userID,
+		SourceID:    sourceID,
+		Protocol:    conn.Protocol(),
+		Addr:        conn.Addr(),
+		Node:        h.Node(),
+		ConnectedAt: conn.ConnectedAt(),
+	}
+}
@@ -0,0 +1,204 @@
+/*
+ * @Descripttion: 请求响应，按关联标识将响应路由回发起请求的连接
+ * @Author: chenjun
+ * @Date: 2026-10-18 19:06:48
+ */
+
+package hub
+
+import (
+	"errors"
+	"go-cmd-transfer/global"
+	"go-cmd-transfer/utils"
+	"time"
+)
+
+const (
+	// 请求超时的响应编码
+	requestTimeoutCode = "4080"
+	// 处理失败的响应编码
+	failedCode = "9999"
+	// 默认请求等待响应的时长
+	defaultRequestTimeout = 30 * time.Second
+	// 请求等待响应的最长时长
+	maxRequestTimeout = 10 * time.Minute
+)
+
+//errReplyNotAllowed 响应方不是请求的投递目标
+var errReplyNotAllowed = errors.New("reply not allowed: not a target of the request")
+
+//request 等待响应的请求
+type request struct {
+	// 发起请求的连接标识
+	from string
+	// 请求方设置的关联标识，投递响应前换回
+	correlationID string
+	// 请求的消息标识
+	msgID string
+	// 请求的投递目标，只有目标内的连接可以响应
+	target Target
+	// 超时定时器
+	timer *time.Timer
+}
+
+//SetRequestTimeout 设置请求未指定超时时长时的默认值，参数小于等于0时保持默认值
+func (h *Hub) SetRequestTimeout(timeout time.Duration) {
+	h.requestMutex.Lock()
+	if timeout > 0 {
+		h.requestTimeout = timeout
+	}
+	h.requestMutex.Unlock()
+}
+
+/*
+track 记录本节点连接发起的请求，超时未响应时向发起请求的连接返回超时错误
+ * @param busData 带关联标识的请求
+ * @param target 请求的投递目标
+ * @param from 发起请求的连接标识
+ * @return: 服务端生成的关联标识，投递给目标时替换请求方的关联标识，不同请求方使用相同的关联标识也不会冲突
+*/
+func (h *Hub) track(busData global.BusinessData, target Target, from string) string {
+	h.requestMutex.Lock()
+	defer h.requestMutex.Unlock()
+	timeout := h.requestTimeout
+	if busData.Timeout > 0 {
+		timeout = time.Duration(busData.Timeout) * time.Millisecond
+	}
+	if timeout > maxRequestTimeout {
+		timeout = maxRequestTimeout
+	}
+	id := utils.Get32UUID()
+	h.requests[id] = &request{
+		from:          from,
+		correlationID: busData.CorrelationID,
+		msgID:         busData.MsgID,
+		target:        target,
+		timer: time.AfterFunc(timeout, func() {
+			h.expire(id)
+		}),
+	}
+	return id
+}
+
+//expire 请求超时，向发起请求的连接返回超时错误
+func (h *Hub) expire(id string) {
+	r, ok := h.resolve(id)
+	if !ok {
+		return
+	}
+	h.log.Warnf("请求等待响应超时，关联标识：%s，发起请求的连接标识：%s", r.correlationID, r.from)
+	conn, ok := h.Lookup(r.from)
+	if !ok {
+		return
+	}
+	timeout := global.BusinessData{CorrelationID: r.correlationID, MsgID: r.msgID}
+	if err := conn.Send(failure(timeout, requestTimeoutCode, "request timeout")); err != nil {
+		h.log.Errorf("返回请求超时失败，连接标识：%s，错误信息：%s", conn.ID(), err.Error())
+	}
+}
+
+//resolve 按服务端生成的关联标识取出等待响应的请求并停止超时定时器
+func (h *Hub) resolve(id string) (*request, bool) {
+	h.requestMutex.Lock()
+	defer h.requestMutex.Unlock()
+	r, ok := h.requests[id]
+	if ok {
+		r.timer.Stop()
+		delete(h.requests, id)
+	}
+	return r, ok
+}
+
+/*
+reply 将响应投递到本节点发起请求的连接，与响应指定的协议无关，投递成功后请求才结束
+ * @param busData 响应，关联标识为服务端生成的关联标识
+ * @param from 响应方连接标识
+ * @return: 请求不在本节点或已超时时返回 false；响应方不是请求的投递目标或投递失败时返回错误
+*/
+func (h *Hub) reply(busData global.BusinessData, from string) (bool, error) {
+	id := busData.CorrelationID
+	h.requestMutex.Lock()
+	r, ok := h.requests[id]
+	h.requestMutex.Unlock()
+	if !ok {
+		return false, nil
+	}
+	if !r.answerable(busData, from) {
+		h.mutex.RLock()
+		policy := h.policy
+		h.mutex.RUnlock()
+		h.audit(policy, AuditEntry{Action: AuditReply, Decision: DecisionDeny, UserID: busData.UserID, SourceID: busData.SourceID, ConnID: from, OpType: busData.OpType, Target: ModeConn + ":" + r.from, MsgID: busData.MsgID})
+		return true, errReplyNotAllowed
+	}
+	conn, ok := h.Lookup(r.from)
+	if !ok {
+		h.resolve(id)
+		return true, nil
+	}
+	busData.CorrelationID = r.correlationID
+	if !h.allowReceive(conn, busData) {
+		return true, errReplyNotAllowed
+	}
+	data, err := json.Marshal(busData)
+	if err != nil {
+		return true, err
+	}
+	// 投递失败时请求继续等待，超时后向请求方返回超时错误
+	if err := h.send(conn, busData, data, from); err != nil {
+		h.log.Errorf("投递响应失败，连接标识：%s，关联标识：%s，错误信息：%s", conn.ID(), r.correlationID, err.Error())
+		return true, err
+	}
+	h.resolve(id)
+	return true, nil
+}
+
+//answerable 判断响应方是否为请求的投递目标；广播与主题请求的关联标识由服务端生成，只有收到请求的连接知道
+func (r *request) answerable(busData global.BusinessData, from string) bool {
+	switch r.target.Mode {
+	case ModeUser:
+		return contains(r.target.IDs, busData.UserID)
+	case ModeSource:
+		return contains(r.target.IDs, busData.SourceID)
+	case ModeConn:
+		return contains(r.target.IDs, from)
+	}
+	return true
+}
+
+//contains 判断列表是否包含非空的值
+func contains(values []string, value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+//cancelRequests 连接关闭时丢弃该连接发起的请求
+func (h *Hub) cancelRequests(conn Conn) {
+	h.requestMutex.Lock()
+	for correlationID, r := range h.requests {
+		if r.from == conn.ID() {
+			r.timer.Stop()
+			delete(h.requests, correlationID)
+		}
+	}
+	h.requestMutex.Unlock()
+}
+
+/*
+failure 返回给发送方的失败消息，请求的失败消息携带请求方的关联标识与消息标识，请求方据此结束等待
+ * @param busData 发送方的业务数据
+ * @param code 响应编码
+ * @param message 响应消息
+*/
+func failure(busData global.BusinessData, code string, message string) []byte {
+	if busData.CorrelationID == "" {
+		return []byte(utils.FailCodeMessage(code, message))
+	}
+	return []byte(utils.FailCodeDataMessage(code, message, map[string]string{"correlationId": busData.CorrelationID, "msgId": busData.MsgID}))
+}
@@ -0,0 +1,120 @@
+/*
+ * @Descripttion: 连接中心优雅关闭，处理完已收到的报文并写出所有连接的写队列后再关闭
+ * @Author: chenjun
+ * @Date: 2026-10-19 11:08:36
+ */
+
+package hub
+
+import (
+	"context"
+	"go-cmd-transfer/global"
+	"sync"
+)
+
+const (
+	// 服务正在关闭的响应编码
+	unavailableCode = "5030"
+)
+
+/*
+Shutdown 关闭连接中心，调用前应先停止接受新连接
+ * 关闭等待登录的连接，不再处理新收到的报文，等待投递队列中的报文处理完；
+ * 停止投递协程，向所有连接发送关闭通知，写出写队列中的消息后关闭连接；
+ * 最后停止等待确认与等待响应的定时器，关闭集群消息总线、在线注册表与离线消息存储
+ * @param ctx 期限到达时直接关闭剩余的连接
+ * @return: 期限到达时返回 ctx 的错误
+*/
+func (h *Hub) Shutdown(ctx context.Context) error {
+	h.mutex.Lock()
+	h.closing = true
+	waiting := make([]Conn, 0, len(h.waiting))
+	for _, conn := range h.waiting {
+		waiting = append(waiting, conn)
+	}
+	h.mutex.Unlock()
+	// 等待登录的连接没有可写出的消息，直接关闭
+	for _, conn := range waiting {
+		conn.Close()
+	}
+	h.log.Infof("连接中心开始关闭，已关闭%d个等待登录的连接，等待投递队列中的报文处理完", len(waiting))
+	done := make(chan struct{})
+	go func() {
+		h.inflight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		h.log.Warn("等待投递队列超时，直接关闭连接")
+	}
+	h.doneOnce.Do(func() {
+		close(h.done)
+	})
+	conns := h.Conns("")
+	h.log.Infof("向%d个连接发送关闭通知并写出写队列", len(conns))
+	var wg sync.WaitGroup
+	for _, conn := range conns {
+		wg.Add(1)
+		go func(conn Conn) {
+			defer wg.Done()
+			conn.Drain(ctx)
+		}(conn)
+	}
+	wg.Wait()
+	h.stopTimers()
+	h.closeStores()
+	h.log.Info("连接中心已关闭")
+	return ctx.Err()
+}
+
+//accept 判断是否处理新收到的报文，接受时计入处理中的报文，处理完后需要调用 h.inflight.Done
+func (h *Hub) accept(from Conn, busData global.BusinessData) bool {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	if h.closing {
+		from.Send(failure(busData, unavailableCode, "server shutting down"))
+		return false
+	}
+	// 在锁内计数，保证关闭开始后不再增加
+	h.inflight.Add(1)
+	return true
+}
+
+//stopTimers 停止等待确认与等待响应的定时器，关闭后不再重发或返回超时
+func (h *Hub) stopTimers() {
+	h.pendingMutex.Lock()
+	for key, p := range h.pendings {
+		p.timer.Stop()
+		delete(h.pendings, key)
+	}
+	h.pendingMutex.Unlock()
+	h.requestMutex.Lock()
+	for id, r := range h.requests {
+		r.timer.Stop()
+		delete(h.requests, id)
+	}
+	h.requestMutex.Unlock()
+}
+
+//closeStores 关闭集群消息总线、在线注册表与离线消息存储
+func (h *Hub) closeStores() {
+	h.mutex.RLock()
+	backplane, registry, store := h.backplane, h.presence, h.offline
+	h.mutex.RUnlock()
+	if backplane != nil {
+		if err := backplane.Close(); err != nil {
+			h.log.Errorf("关闭集群消息总线失败：%s", err.Error())
+		}
+	}
+	if registry != nil {
+		if err := registry.Close(); err != nil {
+			h.log.Errorf("关闭在线注册表失败：%s", err.Error())
+		}
+	}
+	if store != nil {
+		if err := store.Close(); err != nil {
+			h.log.Errorf("关闭离线消息存储失败：%s", err.Error())
+		}
+	}
+}
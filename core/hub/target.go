@@ -0,0 +1,81 @@
+/*
+ * @Descripttion: 投递目标
+ * @Author: chenjun
+ * @Date: 2026-10-18 09:12:40
+ */
+
+package hub
+
+import (
+	"errors"
+	"fmt"
+	"go-cmd-transfer/global"
+)
+
+const (
+	//ProtocolSocket socket协议
+	ProtocolSocket = "socket"
+	//ProtocolWebsocket websocket协议
+	ProtocolWebsocket = "websocket"
+
+	//ModeBroadcast 广播给目标传输层的所有连接
+	ModeBroadcast = "broadcast"
+	//ModeUser 按用户账号投递
+	ModeUser = "user"
+	//ModeSource 按接入端标识投递
+	ModeSource = "source"
+	//ModeConn 按连接标识投递
+	ModeConn = "conn"
+	//ModeTopic 按主题投递到订阅了匹配主题的连接
+	ModeTopic = "topic"
+	//ModeReply 响应，按关联标识投递到发起请求的连接，无需指定目标
+	ModeReply = "reply"
+)
+
+//Target 投递目标
+type Target struct {
+	// 投递模式 broadcast/user/source/conn/topic/reply
+	Mode string
+	// 用户账号、接入端标识、连接标识或主题列表
+	IDs []string
+}
+
+/*
+TargetOf 解析业务数据的投递目标，未指定模式但指定了目标时按用户账号投递
+ * @param busData 业务数据
+ * @return: 投递目标，未指定目标时返回错误
+*/
+func TargetOf(busData global.BusinessData) (Target, error) {
+	target := Target{Mode: busData.Mode, IDs: busData.Targets}
+	if target.Mode == "" && len(target.IDs) > 0 {
+		target.Mode = ModeUser
+	}
+	switch target.Mode {
+	case ModeBroadcast:
+		return target, nil
+	case ModeReply:
+		if busData.CorrelationID == "" {
+			return target, errors.New("mode reply requires correlationId")
+		}
+		return target, nil
+	case ModeTopic:
+		if len(target.IDs) == 0 {
+			return target, errors.New("mode topic requires targets")
+		}
+		for _, topic := range target.IDs {
+			if err := validTopic(topic, false); err != nil {
+				return target, err
+			}
+		}
+		return target, nil
+	case ModeUser, ModeSource, ModeConn:
+		if len(target.IDs) == 0 {
+			return target, fmt.Errorf("mode %s requires targets", target.Mode)
+		}
+		return target, nil
+	case "":
+		return target, errors.New("missing delivery target")
+	default:
+		return target, fmt.Errorf("unsupported mode: %s", target.Mode)
+	}
+}
@@ -0,0 +1,169 @@
+/*
+ * @Descripttion: 主题发布订阅，主题按 . 分段，订阅时 * 匹配任意一段
+ * @Author: chenjun
+ * @Date: 2026-10-18 20:15:27
+ */
+
+package hub
+
+import (
+	"errors"
+	"fmt"
+	"go-cmd-transfer/utils"
+	"sort"
+	"strings"
+)
+
+const (
+	//OpSubscribe 订阅主题，targets 为主题列表，可使用通配符
+	OpSubscribe = "subscribe"
+	//OpUnsubscribe 取消订阅，targets 为订阅时的主题列表
+	OpUnsubscribe = "unsubscribe"
+	//OpPublish 发布到主题，targets 为主题列表，不能使用通配符
+	OpPublish = "publish"
+
+	// 主题分段分隔符
+	topicSeparator = "."
+	// 匹配任意一段的通配符
+	topicWildcard = "*"
+	// 每个连接最多订阅的主题数
+	maxSubscriptions = 256
+)
+
+/*
+Subscribe 连接订阅主题
+ * @param conn 订阅的连接
+ * @param patterns 主题列表，* 匹配任意一段，例如 site.*.alarms
+ * @return: 主题不合法或超出订阅数限制时返回错误，之前的主题已订阅
+*/
+func (h *Hub) Subscribe(conn Conn, patterns []string) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	// 已注销的连接不再订阅
+	if _, ok := h.conns[conn.Protocol()][conn.ID()]; !ok {
+		return errors.New("connection closed")
+	}
+	for _, pattern := range patterns {
+		if err := validTopic(pattern, true); err != nil {
+			return err
+		}
+		subscribed, ok := h.subscriptions[conn.ID()]
+		if !ok {
+			subscribed = make(map[string]bool)
+			h.subscriptions[conn.ID()] = subscribed
+		}
+		if subscribed[pattern] {
+			continue
+		}
+		if len(subscribed) >= maxSubscriptions {
+			return fmt.Errorf("too many subscriptions, limit %d", maxSubscriptions)
+		}
+		subscribed[pattern] = true
+		addIndex(h.topics, pattern, conn)
+	}
+	return nil
+}
+
+//Unsubscribe 连接取消订阅主题，主题为空时取消所有订阅
+func (h *Hub) Unsubscribe(conn Conn, patterns []string) {
+	h.mutex.Lock()
+	h.unsubscribe(conn.ID(), patterns)
+	h.mutex.Unlock()
+}
+
+//Subscriptions 连接订阅的主题，按字典序排列
+func (h *Hub) Subscriptions(conn Conn) []string {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	patterns := make([]string, 0, len(h.subscriptions[conn.ID()]))
+	for pattern := range h.subscriptions[conn.ID()] {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	return patterns
+}
+
+//unsubscribe 取消订阅，调用方持有写锁
+func (h *Hub) unsubscribe(connID string, patterns []string) {
+	subscribed := h.subscriptions[connID]
+	if len(patterns) == 0 {
+		for pattern := range subscribed {
+			patterns = append(patterns, pattern)
+		}
+	}
+	for _, pattern := range patterns {
+		delete(subscribed, pattern)
+		removeIndex(h.topics, pattern, connID)
+	}
+	if len(subscribed) == 0 {
+		delete(h.subscriptions, connID)
+	}
+}
+
+//matchTopics 获取订阅了任一主题的连接，调用方持有读锁
+func (h *Hub) matchTopics(topics []string, accept func(conn Conn)) {
+	seen := make(map[string]bool)
+	for pattern, conns := range h.topics {
+		for _, topic := range topics {
+			if !matchTopic(pattern, topic) {
+				continue
+			}
+			for connID, conn := range conns {
+				if !seen[connID] {
+					seen[connID] = true
+					accept(conn)
+				}
+			}
+			break
+		}
+	}
+}
+
+//matchTopic 判断主题是否匹配订阅的主题
+func matchTopic(pattern string, topic string) bool {
+	if !strings.Contains(pattern, topicWildcard) {
+		return pattern == topic
+	}
+	patternParts := strings.Split(pattern, topicSeparator)
+	topicParts := strings.Split(topic, topicSeparator)
+	if len(patternParts) != len(topicParts) {
+		return false
+	}
+	for i, part := range patternParts {
+		if part != topicWildcard && part != topicParts[i] {
+			return false
+		}
+	}
+	return true
+}
+
+//validTopic 校验主题，每段不能为空，wildcard 为 false 时不能使用通配符
+func validTopic(topic string, wildcard bool) error {
+	for _, part := range strings.Split(topic, topicSeparator) {
+		if part == "" {
+			return fmt.Errorf("invalid topic: %q", topic)
+		}
+		if strings.Contains(part, topicWildcard) && (!wildcard || part != topicWildcard) {
+			return fmt.Errorf("invalid topic: %q", topic)
+		}
+	}
+	return nil
+}
+
+//registerTopicHandlers 注册主题相关的处理函数
+func (h *Hub) registerTopicHandlers() {
+	h.Handle(OpSubscribe, func(ctx *Context) error {
+		if err := ctx.Hub.Subscribe(ctx.Conn, ctx.Message.Targets); err != nil {
+			return err
+		}
+		return ctx.Reply(utils.SuccessDataMessage(OpSubscribe, ctx.Hub.Subscriptions(ctx.Conn)))
+	})
+	h.Handle(OpUnsubscribe, func(ctx *Context) error {
+		ctx.Hub.Unsubscribe(ctx.Conn, ctx.Message.Targets)
+		return ctx.Reply(utils.SuccessDataMessage(OpUnsubscribe, ctx.Hub.Subscriptions(ctx.Conn)))
+	})
+	h.Handle(OpPublish, func(ctx *Context) error {
+		ctx.Message.Mode = ModeTopic
+		return ctx.Forward()
+	})
+}
@@ -47,6 +47,12 @@ func getGID() uint64 {
 	return n
 }
 
+// 当前的日志文件写入器，关闭时写入磁盘
+var fileWriter *logFileWriter
+
+// 审计日志文件写入器
+var auditWriter *logFileWriter
+
 type logFileWriter struct {
 	file     *os.File
 	logPath  string //日志文件路径
@@ -82,27 +88,35 @@ func (p *logFileWriter) Write(data []byte) (n int, err error) {
 	return n, e
 }
 
-//InitLog 初始化日志
-func InitLog(logPath string, logFile string, logLevel string) {
+//openLogFile 按日期创建目录并打开日志文件
+func openLogFile(logPath string, logFile string) (*logFileWriter, error) {
 	fileDate := time.Now().Format("20060102")
 	//创建目录
 	err := os.MkdirAll(fmt.Sprintf("%s/%s", logPath, fileDate), os.ModePerm)
 	if err != nil {
-		logrus.Error(err)
-		return
+		return nil, err
 	}
 
 	filename := fmt.Sprintf("%s/%s/%s-%s.log", logPath, fileDate, logFile, fileDate)
 	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE|os.O_SYNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &logFileWriter{file, logPath, logFile, fileDate}, nil
+}
+
+//InitLog 初始化日志
+func InitLog(logPath string, logFile string, logLevel string) {
+	writer, err := openLogFile(logPath, logFile)
 	if err != nil {
 		logrus.Error(err)
 		return
 	}
 
-	fileWriter := logFileWriter{file, logPath, logFile, fileDate}
+	fileWriter = writer
 	// 设置将日志输出到标准输出（默认的输出为stderr，标准错误）
 	// 日志消息输出可以是任意的io.writer类型
-	logrus.SetOutput(&fileWriter)
+	logrus.SetOutput(fileWriter)
 
 	logrus.SetReportCaller(true)
 	//设置输出样式，自带的只有两种样式logrus.JSONFormatter{}和logrus.TextFormatter{}
@@ -116,3 +130,37 @@ func InitLog(logPath string, logFile string, logLevel string) {
 	}
 	logrus.SetLevel(level)
 }
+
+//InitAuditLog 初始化审计日志，与普通日志同目录，文件名以 audit 开头，每行一条json便于查询
+func InitAuditLog(logPath string) *logrus.Logger {
+	auditLog := logrus.New()
+	auditLog.SetFormatter(&logrus.JSONFormatter{TimestampFormat: "2006-01-02 15:04:05.000"})
+	writer, err := openLogFile(logPath, "audit")
+	if err != nil {
+		logrus.Error(err)
+		auditLog.SetOutput(os.Stderr)
+		return auditLog
+	}
+	auditWriter = writer
+	auditLog.SetOutput(auditWriter)
+	return auditLog
+}
+
+//CloseLog 将日志写入磁盘并关闭日志文件，之后的日志输出到标准错误
+func CloseLog() {
+	if auditWriter != nil && auditWriter.file != nil {
+		auditWriter.file.Sync()
+		auditWriter.file.Close()
+		auditWriter = nil
+	}
+	if fileWriter == nil {
+		return
+	}
+	// 切换输出与写入日志使用同一把锁，切换后不再有写入日志文件的操作
+	logrus.SetOutput(os.Stderr)
+	if fileWriter.file != nil {
+		fileWriter.file.Sync()
+		fileWriter.file.Close()
+	}
+	fileWriter = nil
+}
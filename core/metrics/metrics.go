@@ -0,0 +1,126 @@
+/*
+ * @Descripttion: Prometheus 监控指标，由调用方注册到指定的注册表
+ * @Author: chenjun
+ * @Date: 2026-10-19 10:26:47
+ */
+
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	// 指标名称前缀
+	namespace = "cmd_transfer"
+	// 读队列
+	QueueIn = "in"
+	// 写队列
+	QueueOut = "out"
+	// 指标接口路径
+	Path = "/metrics"
+)
+
+var (
+	//Connections 当前在线连接数
+	Connections = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "connections",
+		Help:      "Number of active connections per transport.",
+	}, []string{"transport"})
+	//MessagesIn 收到的业务消息数
+	MessagesIn = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_in_total",
+		Help:      "Number of business messages received per transport and op type.",
+	}, []string{"transport", "op_type"})
+	//MessagesOut 投递的业务消息数
+	MessagesOut = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_out_total",
+		Help:      "Number of business messages delivered per transport and op type.",
+	}, []string{"transport", "op_type"})
+	//BytesIn 读取的字节数
+	BytesIn = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bytes_in_total",
+		Help:      "Number of bytes read per transport.",
+	}, []string{"transport"})
+	//BytesOut 写入的字节数
+	BytesOut = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bytes_out_total",
+		Help:      "Number of bytes written per transport.",
+	}, []string{"transport"})
+	//DecodeErrors 解包或解析失败数
+	DecodeErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "decode_errors_total",
+		Help:      "Number of frames or messages that failed to decode per transport.",
+	}, []string{"transport"})
+	//WriteErrors 写入连接失败数
+	WriteErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "write_errors_total",
+		Help:      "Number of failed writes in the write loop per transport.",
+	}, []string{"transport"})
+	//DispatchLatency 从收到报文到处理完成的时长，包括在投递队列中等待的时长
+	DispatchLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "dispatch_latency_seconds",
+		Help:      "Time from receiving a message to finishing its dispatch per transport.",
+		Buckets:   prometheus.ExponentialBuckets(0.0001, 4, 9),
+	}, []string{"transport"})
+	//QueueDepth 消息入队时连接读队列、写队列的长度
+	QueueDepth = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "queue_depth",
+		Help:      "Length of the connection in/out queue observed on enqueue per transport.",
+		Buckets:   []float64{0, 1, 4, 16, 64, 256, 1024, 4096},
+	}, []string{"transport", "queue"})
+)
+
+//Since 记录投递时长
+func Since(transport string, start time.Time) {
+	DispatchLatency.WithLabelValues(transport).Observe(time.Since(start).Seconds())
+}
+
+//collectors 所有指标
+func collectors() []prometheus.Collector {
+	return []prometheus.Collector{Connections, MessagesIn, MessagesOut, BytesIn, BytesOut, DecodeErrors, WriteErrors, DispatchLatency, QueueDepth}
+}
+
+/*
+Register 注册所有指标，指标在进程内共用，同一注册表重复注册时忽略
+ * @param registerer 注册表，为空时使用默认的注册表
+ * @return: 与注册表中已有的其他指标冲突时返回错误
+*/
+func Register(registerer prometheus.Registerer) error {
+	if registerer == nil {
+		registerer = prometheus.DefaultRegisterer
+	}
+	for _, collector := range collectors() {
+		err := registerer.Register(collector)
+		if registered, ok := err.(prometheus.AlreadyRegisteredError); err != nil && (!ok || registered.ExistingCollector != collector) {
+			return err
+		}
+	}
+	return nil
+}
+
+//Handler 默认注册表的指标接口
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+//HandlerFor 注册表的指标接口，注册表不支持采集时使用默认注册表
+func HandlerFor(registerer prometheus.Registerer) http.Handler {
+	if gatherer, ok := registerer.(prometheus.Gatherer); ok {
+		return promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{})
+	}
+	return Handler()
+}
@@ -0,0 +1,162 @@
+/*
+ * @Descripttion: 基于bbolt本地文件的离线消息存储
+ * @Author: chenjun
+ * @Date: 2026-10-18 16:52:37
+ */
+
+package offline
+
+import (
+	"encoding/binary"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// 离线消息根桶，每个用户一个子桶，键为递增序号
+var rootBucket = []byte("offline")
+
+//FileStore 基于bbolt本地文件的离线消息存储，进程重启后保留
+type FileStore struct {
+	// 队列限制
+	options Options
+	// 数据库
+	db *bolt.DB
+}
+
+//NewFileStore 打开或创建本地文件离线消息存储
+func NewFileStore(path string, options Options) (*FileStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(rootBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &FileStore{options: options, db: db}, nil
+}
+
+//Push 追加消息到用户队列末尾
+func (s *FileStore) Push(userID string, data []byte) error {
+	value, err := json.Marshal(Message{time.Now(), data})
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.Bucket(rootBucket).CreateBucketIfNotExists([]byte(userID))
+		if err != nil {
+			return err
+		}
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, seq)
+		if err := bucket.Put(key, value); err != nil {
+			return err
+		}
+		// 超出队列长度时按序号从小到大丢弃最早的消息
+		if s.options.MaxSize > 0 {
+			var count int
+			bucket.ForEach(func(k, v []byte) error {
+				count++
+				return nil
+			})
+			cursor := bucket.Cursor()
+			for ; count > s.options.MaxSize; count-- {
+				if k, _ := cursor.First(); k == nil {
+					break
+				}
+				if err := cursor.Delete(); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+//Pop 取出用户队列中未过期的消息并清空队列
+func (s *FileStore) Pop(userID string) ([]Message, error) {
+	var messages []Message
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		root := tx.Bucket(rootBucket)
+		bucket := root.Bucket([]byte(userID))
+		if bucket == nil {
+			return nil
+		}
+		err := bucket.ForEach(func(k, v []byte) error {
+			msg := Message{}
+			if err := json.Unmarshal(v, &msg); err != nil {
+				return err
+			}
+			messages = append(messages, msg)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return root.DeleteBucket([]byte(userID))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.options.alive(messages), nil
+}
+
+//Requeue 将消息按原有顺序放回用户队列头部，按新的序号重写用户队列
+func (s *FileStore) Requeue(userID string, messages []Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		root := tx.Bucket(rootBucket)
+		var values [][]byte
+		for _, msg := range messages {
+			value, err := json.Marshal(msg)
+			if err != nil {
+				return err
+			}
+			values = append(values, value)
+		}
+		if bucket := root.Bucket([]byte(userID)); bucket != nil {
+			err := bucket.ForEach(func(k, v []byte) error {
+				values = append(values, append([]byte(nil), v...))
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if err := root.DeleteBucket([]byte(userID)); err != nil {
+				return err
+			}
+		}
+		bucket, err := root.CreateBucket([]byte(userID))
+		if err != nil {
+			return err
+		}
+		for _, value := range values {
+			seq, err := bucket.NextSequence()
+			if err != nil {
+				return err
+			}
+			key := make([]byte, 8)
+			binary.BigEndian.PutUint64(key, seq)
+			if err := bucket.Put(key, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+//Close 关闭数据库
+func (s *FileStore) Close() error {
+	return s.db.Close()
+}
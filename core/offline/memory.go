@@ -0,0 +1,69 @@
+/*
+ * @Descripttion: 进程内离线消息存储
+ * @Author: chenjun
+ * @Date: 2026-10-18 16:44:50
+ */
+
+package offline
+
+import (
+	"sync"
+	"time"
+)
+
+//MemoryStore 进程内离线消息存储，进程退出后丢失
+type MemoryStore struct {
+	// 队列限制
+	options Options
+	// 队列读写锁
+	mutex sync.Mutex
+	// 用户队列 userID ===> 消息
+	queues map[string][]Message
+}
+
+//NewMemoryStore 创建进程内离线消息存储
+func NewMemoryStore(options Options) *MemoryStore {
+	return &MemoryStore{options: options, queues: make(map[string][]Message)}
+}
+
+//Push 追加消息到用户队列末尾
+func (s *MemoryStore) Push(userID string, data []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	queue := append(s.queues[userID], Message{time.Now(), data})
+	// 先丢弃过期的消息，再按队列长度丢弃最早的消息
+	now := time.Now()
+	for len(queue) > 0 && s.options.expired(queue[0], now) {
+		queue = queue[1:]
+	}
+	if s.options.MaxSize > 0 && len(queue) > s.options.MaxSize {
+		queue = queue[len(queue)-s.options.MaxSize:]
+	}
+	s.queues[userID] = queue
+	return nil
+}
+
+//Pop 取出用户队列中未过期的消息并清空队列
+func (s *MemoryStore) Pop(userID string) ([]Message, error) {
+	s.mutex.Lock()
+	queue := s.queues[userID]
+	delete(s.queues, userID)
+	s.mutex.Unlock()
+	return s.options.alive(queue), nil
+}
+
+//Requeue 将消息按原有顺序放回用户队列头部
+func (s *MemoryStore) Requeue(userID string, messages []Message) error {
+	s.mutex.Lock()
+	s.queues[userID] = append(append([]Message(nil), messages...), s.queues[userID]...)
+	s.mutex.Unlock()
+	return nil
+}
+
+//Close 清空所有队列
+func (s *MemoryStore) Close() error {
+	s.mutex.Lock()
+	s.queues = make(map[string][]Message)
+	s.mutex.Unlock()
+	return nil
+}
@@ -0,0 +1,97 @@
+/*
+ * @Descripttion: 离线消息存储，目标用户不在线时暂存消息，重新连接时按序投递
+ * @Author: chenjun
+ * @Date: 2026-10-18 16:35:12
+ */
+
+package offline
+
+import (
+	"errors"
+	"fmt"
+	"go-cmd-transfer/config"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	jsoniter "github.com/json-iterator/go"
+)
+
+const (
+	//BackendMemory 进程内存储
+	BackendMemory = "memory"
+	//BackendFile 本地文件存储
+	BackendFile = "file"
+	//BackendRedis redis存储
+	BackendRedis = "redis"
+)
+
+//实例化工具类
+var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+//Store 离线消息存储，每个用户一个队列
+type Store interface {
+	// 追加消息到用户队列末尾，超出队列长度时丢弃最早的消息
+	Push(userID string, data []byte) error
+	// 按入队顺序取出用户队列中未过期的消息并清空队列
+	Pop(userID string) ([]Message, error)
+	// 将取出后未投递的消息按原有顺序放回用户队列头部，不按队列长度丢弃，保留原有的入队时间
+	Requeue(userID string, messages []Message) error
+	// 关闭存储
+	Close() error
+}
+
+//Options 队列限制
+type Options struct {
+	// 每个用户最多保存的消息数，小于等于0时不限制
+	MaxSize int
+	// 消息保存时长，小于等于0时不过期
+	TTL time.Duration
+}
+
+//Message 队列中的一条消息
+type Message struct {
+	// 入队时间
+	At time.Time `json:"at"`
+	// 消息数据
+	Data []byte `json:"data"`
+}
+
+//expired 判断消息是否已过期
+func (o Options) expired(msg Message, now time.Time) bool {
+	return o.TTL > 0 && now.Sub(msg.At) > o.TTL
+}
+
+//alive 过滤出未过期的消息
+func (o Options) alive(messages []Message) []Message {
+	now := time.Now()
+	alive := make([]Message, 0, len(messages))
+	for _, msg := range messages {
+		if !o.expired(msg, now) {
+			alive = append(alive, msg)
+		}
+	}
+	return alive
+}
+
+/*
+New 按配置创建离线消息存储
+ * @param c 离线消息配置
+ * @param client redis客户端，存储方式为redis时使用
+ * @return: 存储方式不支持或打开失败时返回错误
+*/
+func New(c config.Offline, client *redis.Client) (Store, error) {
+	options := Options{MaxSize: c.MaxSize, TTL: time.Duration(c.TTL) * time.Second}
+	switch c.Backend {
+	case BackendMemory, "":
+		return NewMemoryStore(options), nil
+	case BackendFile:
+		return NewFileStore(c.Path, options)
+	case BackendRedis:
+		if client == nil {
+			return nil, errors.New("offline backend redis requires a redis client")
+		}
+		return NewRedisStore(client, options), nil
+	default:
+		return nil, fmt.Errorf("unsupported offline backend: %s", c.Backend)
+	}
+}
@@ -0,0 +1,110 @@
+package offline
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v7"
+)
+
+//testStores 进程内、本地文件与redis存储
+func testStores(t *testing.T, options Options) map[string]Store {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "offline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	file, err := NewFileStore(filepath.Join(dir, "offline.db"), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { file.Close() })
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Close)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return map[string]Store{"memory": NewMemoryStore(options), "file": file, "redis": NewRedisStore(client, options)}
+}
+
+//texts 消息数据转换为字符串，便于比较
+func texts(messages []Message) []string {
+	values := make([]string, 0, len(messages))
+	for _, msg := range messages {
+		values = append(values, string(msg.Data))
+	}
+	return values
+}
+
+func TestStoreRequeueKeepsOrder(t *testing.T) {
+	for name, store := range testStores(t, Options{MaxSize: 3}) {
+		for _, data := range []string{"1", "2", "3", "4"} {
+			if err := store.Push("u1", []byte(data)); err != nil {
+				t.Fatalf("%s: Push: %v", name, err)
+			}
+		}
+		messages, err := store.Pop("u1")
+		if err != nil {
+			t.Fatalf("%s: Pop: %v", name, err)
+		}
+		if got, want := texts(messages), []string{"2", "3", "4"}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: Pop got %v, want %v", name, got, want)
+		}
+		// 取出后收到的新消息排在放回的消息之后
+		store.Push("u1", []byte("5"))
+		if err := store.Requeue("u1", messages[1:]); err != nil {
+			t.Fatalf("%s: Requeue: %v", name, err)
+		}
+		messages, err = store.Pop("u1")
+		if err != nil {
+			t.Fatalf("%s: Pop: %v", name, err)
+		}
+		if got, want := texts(messages), []string{"3", "4", "5"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: after Requeue got %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestStoreRequeueKeepsEnqueueTime(t *testing.T) {
+	ttl := time.Hour
+	for name, store := range testStores(t, Options{TTL: ttl}) {
+		store.Push("u1", []byte("1"))
+		messages, err := store.Pop("u1")
+		if err != nil || len(messages) != 1 {
+			t.Fatalf("%s: Pop got %v, %v", name, texts(messages), err)
+		}
+		// 多次放回再取出，入队时间保持不变
+		enqueued := messages[0].At
+		for i := 0; i < 3; i++ {
+			if err := store.Requeue("u1", messages); err != nil {
+				t.Fatalf("%s: Requeue: %v", name, err)
+			}
+			if messages, err = store.Pop("u1"); err != nil || len(messages) != 1 {
+				t.Fatalf("%s: Pop after Requeue got %v, %v", name, texts(messages), err)
+			}
+			if !messages[0].At.Equal(enqueued) {
+				t.Fatalf("%s: enqueue time %v changed to %v", name, enqueued, messages[0].At)
+			}
+		}
+		// 放回的消息按原有的入队时间过期
+		expired := Message{At: time.Now().Add(-2 * ttl), Data: []byte("old")}
+		if err := store.Requeue("u1", append([]Message{expired}, messages...)); err != nil {
+			t.Fatalf("%s: Requeue: %v", name, err)
+		}
+		messages, err = store.Pop("u1")
+		if err != nil {
+			t.Fatalf("%s: Pop: %v", name, err)
+		}
+		if got, want := texts(messages), []string{"1"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: after requeueing an expired message got %v, want %v", name, got, want)
+		}
+	}
+}
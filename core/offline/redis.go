@@ -0,0 +1,104 @@
+/*
+ * @Descripttion: 基于redis的离线消息存储，集群内共享
+ * @Author: chenjun
+ * @Date: 2026-10-18 17:05:19
+ */
+
+package offline
+
+import (
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	logger "github.com/sirupsen/logrus"
+)
+
+// 离线消息队列键前缀
+const keyPrefix = "cmd-transfer:offline:"
+
+//RedisStore 基于redis列表的离线消息存储，集群内任意节点都可以取出
+type RedisStore struct {
+	// 队列限制
+	options Options
+	// redis客户端
+	client *redis.Client
+}
+
+//NewRedisStore 创建redis离线消息存储，redis客户端由创建方关闭
+func NewRedisStore(client *redis.Client, options Options) *RedisStore {
+	return &RedisStore{options: options, client: client}
+}
+
+//Push 追加消息到用户队列末尾，队列键的过期时间随最新消息延长
+func (s *RedisStore) Push(userID string, data []byte) error {
+	value, err := json.Marshal(Message{time.Now(), data})
+	if err != nil {
+		return err
+	}
+	key := keyPrefix + userID
+	_, err = s.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.RPush(key, value)
+		if s.options.MaxSize > 0 {
+			pipe.LTrim(key, int64(-s.options.MaxSize), -1)
+		}
+		if s.options.TTL > 0 {
+			pipe.Expire(key, s.options.TTL)
+		}
+		return nil
+	})
+	return err
+}
+
+//Pop 取出用户队列中未过期的消息并清空队列
+func (s *RedisStore) Pop(userID string) ([]Message, error) {
+	key := keyPrefix + userID
+	var values *redis.StringSliceCmd
+	_, err := s.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		values = pipe.LRange(key, 0, -1)
+		pipe.Del(key)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]Message, 0, len(values.Val()))
+	for _, value := range values.Val() {
+		msg := Message{}
+		if err := json.Unmarshal([]byte(value), &msg); err != nil {
+			logger.Error("取出离线消息时，解析json字符串错误", err.Error())
+			continue
+		}
+		messages = append(messages, msg)
+	}
+	return s.options.alive(messages), nil
+}
+
+//Requeue 将消息按原有顺序放回用户队列头部
+func (s *RedisStore) Requeue(userID string, messages []Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	// LPUSH 逐个插入到头部，倒序传入后保持原有顺序
+	values := make([]interface{}, len(messages))
+	for i, msg := range messages {
+		value, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		values[len(messages)-1-i] = value
+	}
+	key := keyPrefix + userID
+	_, err := s.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.LPush(key, values...)
+		if s.options.TTL > 0 {
+			pipe.Expire(key, s.options.TTL)
+		}
+		return nil
+	})
+	return err
+}
+
+//Close redis客户端由创建方关闭
+func (s *RedisStore) Close() error {
+	return nil
+}
@@ -0,0 +1,61 @@
+/*
+ * @Descripttion: 进程内在线注册表，未启用redis时使用
+ * @Author: chenjun
+ * @Date: 2026-10-18 15:31:02
+ */
+
+package presence
+
+import (
+	"sync"
+)
+
+//MemoryRegistry 进程内在线注册表，只记录本节点的连接
+type MemoryRegistry struct {
+	// 在线连接读写锁
+	mutex sync.RWMutex
+	// 在线连接 connID ===> Entry
+	entries map[string]Entry
+}
+
+//NewMemoryRegistry 创建进程内在线注册表
+func NewMemoryRegistry() *MemoryRegistry {
+	return &MemoryRegistry{entries: make(map[string]Entry)}
+}
+
+//Add 添加或更新在线连接
+func (r *MemoryRegistry) Add(entry Entry) error {
+	r.mutex.Lock()
+	r.entries[entry.ConnID] = entry
+	r.mutex.Unlock()
+	return nil
+}
+
+//Remove 删除在线连接
+func (r *MemoryRegistry) Remove(connID string) error {
+	r.mutex.Lock()
+	delete(r.entries, connID)
+	r.mutex.Unlock()
+	return nil
+}
+
+//List 查询在线连接
+func (r *MemoryRegistry) List(query Query) ([]Entry, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	entries := make([]Entry, 0)
+	for _, entry := range r.entries {
+		if query.Match(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+//Close 清空在线连接
+func (r *MemoryRegistry) Close() error {
+	r.mutex.Lock()
+	r.entries = make(map[string]Entry)
+	r.mutex.Unlock()
+	return nil
+}
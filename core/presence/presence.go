@@ -0,0 +1,50 @@
+/*
+ * @Descripttion: 在线注册表，记录集群内在线的用户与连接
+ * @Author: chenjun
+ * @Date: 2026-10-18 15:20:44
+ */
+
+package presence
+
+import (
+	"time"
+)
+
+//Entry 在线连接信息
+type Entry struct {
+	ConnID      string    `json:"connId"`      // 连接标识
+	UserID      string    `json:"userId"`      // 用户账号
+	SourceID    string    `json:"sourceId"`    // 接入端标识
+	Protocol    string    `json:"protocol"`    // 协议 socket/websocket
+	Addr        string    `json:"addr"`        // 网络地址
+	Node        string    `json:"node"`        // 所在节点
+	ConnectedAt time.Time `json:"connectedAt"` // 连接时间
+}
+
+//Query 查询条件，字段为空时不过滤
+type Query struct {
+	UserID   string `json:"userId"`   // 用户账号
+	SourceID string `json:"sourceId"` // 接入端标识
+	Protocol string `json:"protocol"` // 协议 socket/websocket
+	Node     string `json:"node"`     // 所在节点
+}
+
+//Match 判断在线连接是否满足查询条件
+func (q Query) Match(entry Entry) bool {
+	return (q.UserID == "" || q.UserID == entry.UserID) &&
+		(q.SourceID == "" || q.SourceID == entry.SourceID) &&
+		(q.Protocol == "" || q.Protocol == entry.Protocol) &&
+		(q.Node == "" || q.Node == entry.Node)
+}
+
+//Registry 在线注册表
+type Registry interface {
+	// 添加或更新在线连接
+	Add(entry Entry) error
+	// 删除在线连接
+	Remove(connID string) error
+	// 查询在线连接
+	List(query Query) ([]Entry, error)
+	// 关闭注册表，删除本节点添加的在线连接
+	Close() error
+}
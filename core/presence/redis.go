@@ -0,0 +1,255 @@
+/*
+ * @Descripttion: 基于redis的集群在线注册表
+ * @Author: chenjun
+ * @Date: 2026-10-18 15:40:18
+ */
+
+package presence
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	jsoniter "github.com/json-iterator/go"
+	logger "github.com/sirupsen/logrus"
+)
+
+const (
+	// 在线连接键前缀
+	keyPrefix = "cmd-transfer:presence:"
+	// 用户在线连接索引键前缀，集合中为该用户的连接标识
+	userKeyPrefix = "cmd-transfer:presence-user:"
+	// 每次扫描的键数量
+	scanCount = 1000
+	// 默认过期时长
+	defaultTTL = 60 * time.Second
+)
+
+//实例化工具类
+var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+//RedisRegistry 基于redis的集群在线注册表，每个在线连接一个带过期时间的键，每个用户一个连接标识集合作为索引，由添加该连接的节点定时续期
+type RedisRegistry struct {
+	// redis客户端
+	client *redis.Client
+	// 键过期时长
+	ttl time.Duration
+	// 本节点添加的在线连接读写锁
+	mutex sync.RWMutex
+	// 本节点添加的在线连接 connID ===> Entry
+	local map[string]Entry
+	// 用于停止续期
+	closeChan chan byte
+	// 保证只关闭一次
+	closeOnce sync.Once
+}
+
+//NewRedisRegistry 创建redis在线注册表，并按过期时长的三分之一定时续期，过期时长未设置时为60秒
+func NewRedisRegistry(client *redis.Client, ttl time.Duration) *RedisRegistry {
+	if ttl <= 0 {
+		ttl = defaultTTL
+	}
+	r := &RedisRegistry{
+		client:    client,
+		ttl:       ttl,
+		local:     make(map[string]Entry),
+		closeChan: make(chan byte),
+	}
+	go r.refreshLoop()
+	return r
+}
+
+//Add 添加或更新在线连接，用户账号变化时从原用户的索引中移除
+func (r *RedisRegistry) Add(entry Entry) error {
+	r.mutex.Lock()
+	old, exists := r.local[entry.ConnID]
+	r.local[entry.ConnID] = entry
+	r.mutex.Unlock()
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	_, err = r.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.Set(keyPrefix+entry.ConnID, data, r.ttl)
+		if exists && old.UserID != "" && old.UserID != entry.UserID {
+			pipe.SRem(userKeyPrefix+old.UserID, entry.ConnID)
+		}
+		r.index(pipe, entry)
+		return nil
+	})
+	return err
+}
+
+//Remove 删除在线连接
+func (r *RedisRegistry) Remove(connID string) error {
+	r.mutex.Lock()
+	entry, exists := r.local[connID]
+	delete(r.local, connID)
+	r.mutex.Unlock()
+	_, err := r.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.Del(keyPrefix + connID)
+		if exists && entry.UserID != "" {
+			pipe.SRem(userKeyPrefix+entry.UserID, connID)
+		}
+		return nil
+	})
+	return err
+}
+
+//index 将连接加入用户的索引，索引与连接键同时续期
+func (r *RedisRegistry) index(pipe redis.Pipeliner, entry Entry) {
+	if entry.UserID == "" {
+		return
+	}
+	userKey := userKeyPrefix + entry.UserID
+	pipe.SAdd(userKey, entry.ConnID)
+	pipe.Expire(userKey, r.ttl)
+}
+
+//List 查询集群内的在线连接，指定用户账号时只读取该用户的索引，否则扫描所有在线连接
+func (r *RedisRegistry) List(query Query) ([]Entry, error) {
+	if query.UserID != "" {
+		return r.listUser(query)
+	}
+	entries := make([]Entry, 0)
+	var cursor uint64
+	for {
+		keys, next, err := r.client.Scan(cursor, keyPrefix+"*", scanCount).Result()
+		if err != nil {
+			return nil, err
+		}
+		if len(keys) > 0 {
+			values, err := r.client.MGet(keys...).Result()
+			if err != nil {
+				return nil, err
+			}
+			for _, value := range values {
+				// 扫描与读取之间过期的键为空
+				str, ok := value.(string)
+				if !ok {
+					continue
+				}
+				entry := Entry{}
+				if err := json.Unmarshal([]byte(str), &entry); err != nil {
+					logger.Error("查询在线连接时，解析json字符串错误", err.Error())
+					continue
+				}
+				if query.Match(entry) {
+					entries = append(entries, entry)
+				}
+			}
+		}
+		if next == 0 {
+			break
+		}
+		cursor = next
+	}
+	return entries, nil
+}
+
+//listUser 按用户索引查询在线连接，顺带移除已过期或已换绑其他用户的连接标识
+func (r *RedisRegistry) listUser(query Query) ([]Entry, error) {
+	entries := make([]Entry, 0)
+	userKey := userKeyPrefix + query.UserID
+	connIDs, err := r.client.SMembers(userKey).Result()
+	if err != nil || len(connIDs) == 0 {
+		return entries, err
+	}
+	keys := make([]string, len(connIDs))
+	for i, connID := range connIDs {
+		keys[i] = keyPrefix + connID
+	}
+	values, err := r.client.MGet(keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	var stale []interface{}
+	for i, value := range values {
+		// 所在节点异常退出后连接键已过期
+		str, ok := value.(string)
+		if !ok {
+			stale = append(stale, connIDs[i])
+			continue
+		}
+		entry := Entry{}
+		if err := json.Unmarshal([]byte(str), &entry); err != nil {
+			logger.Error("查询在线连接时，解析json字符串错误", err.Error())
+			continue
+		}
+		if entry.UserID != query.UserID {
+			stale = append(stale, connIDs[i])
+			continue
+		}
+		if query.Match(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	if len(stale) > 0 {
+		if err := r.client.SRem(userKey, stale...).Err(); err != nil {
+			logger.Errorf("移除失效的在线连接索引失败，用户账号：%s，错误信息：%s", query.UserID, err.Error())
+		}
+	}
+	return entries, nil
+}
+
+//Close 停止续期并删除本节点添加的在线连接
+func (r *RedisRegistry) Close() error {
+	r.closeOnce.Do(func() {
+		close(r.closeChan)
+	})
+	r.mutex.Lock()
+	local := r.local
+	r.local = make(map[string]Entry)
+	r.mutex.Unlock()
+	if len(local) == 0 {
+		return nil
+	}
+	_, err := r.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		for connID, entry := range local {
+			pipe.Del(keyPrefix + connID)
+			if entry.UserID != "" {
+				pipe.SRem(userKeyPrefix+entry.UserID, connID)
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+//refreshLoop 定时续期本节点添加的在线连接，节点异常退出时键自动过期
+func (r *RedisRegistry) refreshLoop() {
+	ticker := time.NewTicker(r.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.refresh()
+		case <-r.closeChan:
+			return
+		}
+	}
+}
+
+//refresh 续期本节点添加的在线连接，键已过期时重新写入，与删除并发时键最多残留一个过期时长
+func (r *RedisRegistry) refresh() {
+	r.mutex.RLock()
+	pipe := r.client.Pipeline()
+	for connID, entry := range r.local {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			continue
+		}
+		pipe.Set(keyPrefix+connID, data, r.ttl)
+		r.index(pipe, entry)
+	}
+	count := len(r.local)
+	r.mutex.RUnlock()
+	if count == 0 {
+		pipe.Close()
+		return
+	}
+	if _, err := pipe.Exec(); err != nil {
+		logger.Errorf("在线连接续期失败，连接数：%d，错误信息：%s", count, err.Error())
+	}
+}
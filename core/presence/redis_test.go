@@ -0,0 +1,102 @@
+package presence
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v7"
+)
+
+//newTestRegistry 连接 miniredis 的在线注册表
+func newTestRegistry(t *testing.T) (*RedisRegistry, *miniredis.Miniredis) {
+	t.Helper()
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Close)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	r := NewRedisRegistry(client, time.Minute)
+	t.Cleanup(func() { r.Close() })
+	return r, server
+}
+
+//connIDs 在线连接的连接标识，按字典序排列
+func connIDs(t *testing.T, r *RedisRegistry, query Query) []string {
+	t.Helper()
+	entries, err := r.List(query)
+	if err != nil {
+		t.Fatalf("List(%+v): %v", query, err)
+	}
+	ids := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		ids = append(ids, entry.ConnID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestRedisRegistryUserIndex(t *testing.T) {
+	r, server := newTestRegistry(t)
+	r.Add(Entry{ConnID: "c1", UserID: "alice", Protocol: "socket"})
+	r.Add(Entry{ConnID: "c2", UserID: "alice", Protocol: "websocket"})
+	r.Add(Entry{ConnID: "c3", UserID: "bob", Protocol: "socket"})
+	r.Add(Entry{ConnID: "c4", Protocol: "socket"})
+
+	if got := connIDs(t, r, Query{UserID: "alice"}); len(got) != 2 || got[0] != "c1" || got[1] != "c2" {
+		t.Errorf("alice: got %v, want [c1 c2]", got)
+	}
+	if got := connIDs(t, r, Query{UserID: "alice", Protocol: "websocket"}); len(got) != 1 || got[0] != "c2" {
+		t.Errorf("alice websocket: got %v, want [c2]", got)
+	}
+	if got := connIDs(t, r, Query{}); len(got) != 4 {
+		t.Errorf("all: got %v, want 4 connections", got)
+	}
+
+	// 换绑用户账号后从原用户的索引中移除
+	r.Add(Entry{ConnID: "c2", UserID: "carol", Protocol: "websocket"})
+	if got := connIDs(t, r, Query{UserID: "alice"}); len(got) != 1 || got[0] != "c1" {
+		t.Errorf("alice after rebind: got %v, want [c1]", got)
+	}
+	if got := connIDs(t, r, Query{UserID: "carol"}); len(got) != 1 || got[0] != "c2" {
+		t.Errorf("carol: got %v, want [c2]", got)
+	}
+
+	// 删除的连接不再出现在索引中
+	r.Remove("c1")
+	if members, _ := server.Members(userKeyPrefix + "alice"); len(members) != 0 {
+		t.Errorf("alice index after Remove: got %v, want empty", members)
+	}
+
+	// 其他节点异常退出，连接键过期后查询时移除索引中的连接标识
+	server.Del(keyPrefix + "c3")
+	if got := connIDs(t, r, Query{UserID: "bob"}); len(got) != 0 {
+		t.Errorf("bob after expiry: got %v, want none", got)
+	}
+	if members, _ := server.Members(userKeyPrefix + "bob"); len(members) != 0 {
+		t.Errorf("bob index after expiry: got %v, want empty", members)
+	}
+}
+
+func TestRedisRegistryIndexExpires(t *testing.T) {
+	r, server := newTestRegistry(t)
+	r.Add(Entry{ConnID: "c1", UserID: "alice"})
+	if ttl := server.TTL(userKeyPrefix + "alice"); ttl != time.Minute {
+		t.Fatalf("index ttl: got %s, want %s", ttl, time.Minute)
+	}
+	// 续期时索引与连接键一同续期
+	server.FastForward(30 * time.Second)
+	r.refresh()
+	server.FastForward(45 * time.Second)
+	if got := connIDs(t, r, Query{UserID: "alice"}); len(got) != 1 {
+		t.Errorf("alice after refresh: got %v, want [c1]", got)
+	}
+	// 所在节点不再续期时索引随连接键过期
+	server.FastForward(2 * time.Minute)
+	if server.Exists(userKeyPrefix + "alice") {
+		t.Error("index still exists after expiry")
+	}
+}
@@ -0,0 +1,169 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"go-cmd-transfer/core/client"
+	"go-cmd-transfer/core/hub"
+	"go-cmd-transfer/core/metrics"
+	"go-cmd-transfer/core/socket"
+	"go-cmd-transfer/global"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	logger "github.com/sirupsen/logrus"
+)
+
+//startServer 在本机随机端口启动转发服务，测试结束时关闭
+func startServer(t *testing.T, opts ...Option) *Server {
+	t.Helper()
+	log := logger.New()
+	log.SetOutput(ioutil.Discard)
+	s := New(append([]Option{WithLogger(log)}, opts...)...)
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		s.Shutdown(ctx)
+	})
+	return s
+}
+
+//dialSocket 以指定身份连接socket服务，测试结束时关闭
+func dialSocket(t *testing.T, s *Server, userID string) *client.Client {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, err := socket.Dial(ctx, s.SocketAddr().String(), nil, client.WithIdentity(userID, userID+"-source"))
+	if err != nil {
+		t.Fatalf("%s: Dial: %v", userID, err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+//receive 等待下一条转发的业务数据，超时结束测试
+func receive(t *testing.T, c *client.Client) global.BusinessData {
+	t.Helper()
+	timer := time.NewTimer(5 * time.Second)
+	defer timer.Stop()
+	for {
+		select {
+		case msg := <-c.Messages():
+			if msg.Data != nil {
+				return *msg.Data
+			}
+		case <-timer.C:
+			t.Fatal("no message received")
+		}
+	}
+}
+
+//scrape 抓取指标接口，返回 指标名{标签} ===> 值
+func scrape(t *testing.T, url string) map[string]float64 {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("scrape: %v", err)
+	}
+	defer resp.Body.Close()
+	samples := make(map[string]float64)
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		i := strings.LastIndexByte(line, ' ')
+		if strings.HasPrefix(line, "#") || i < 0 {
+			continue
+		}
+		if value, err := strconv.ParseFloat(line[i+1:], 64); err == nil {
+			samples[line[:i]] = value
+		}
+	}
+	return samples
+}
+
+//waitFor 等待条件成立，超时结束测试
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestMetricsScrape(t *testing.T) {
+	scraper := httptest.NewServer(metrics.Handler())
+	defer scraper.Close()
+	url := scraper.URL + metrics.Path
+	const (
+		connections = `cmd_transfer_connections{transport="socket"}`
+		messagesIn  = `cmd_transfer_messages_in_total{op_type="cmd.exec",transport="socket"}`
+		messagesOut = `cmd_transfer_messages_out_total{op_type="cmd.exec",transport="socket"}`
+		bytesIn     = `cmd_transfer_bytes_in_total{transport="socket"}`
+		bytesOut    = `cmd_transfer_bytes_out_total{transport="socket"}`
+	)
+	s := startServer(t, WithSocketAddr("127.0.0.1:0"))
+	before := scrape(t, url)
+
+	// 连接后在线连接数增加
+	alice, bob := dialSocket(t, s, "alice"), dialSocket(t, s, "bob")
+	waitFor(t, "connections gauge", func() bool {
+		return scrape(t, url)[connections] == before[connections]+2
+	})
+
+	// 发送后收发消息数与字节数增加
+	if err := alice.Send(global.BusinessData{OpType: hub.OpExec, Mode: hub.ModeUser, Targets: []string{"bob"}, Data: "ls"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if got := receive(t, bob); got.Data != "ls" {
+		t.Fatalf("bob: got %+v", got)
+	}
+	after := scrape(t, url)
+	if after[messagesIn] != before[messagesIn]+1 || after[messagesOut] != before[messagesOut]+1 {
+		t.Errorf("messages in %v -> %v, out %v -> %v, want +1 each", before[messagesIn], after[messagesIn], before[messagesOut], after[messagesOut])
+	}
+	if after[bytesIn] <= before[bytesIn] || after[bytesOut] <= before[bytesOut] {
+		t.Errorf("bytes in %v -> %v, out %v -> %v, want both to grow", before[bytesIn], after[bytesIn], before[bytesOut], after[bytesOut])
+	}
+
+	// 断开后在线连接数减少
+	bob.Close()
+	waitFor(t, "connections gauge after drop", func() bool {
+		return scrape(t, url)[connections] == before[connections]+1
+	})
+}
+
+func TestMetricsRegisterer(t *testing.T) {
+	// 两个服务使用各自的注册表，不会重复注册
+	for _, name := range []string{"first", "second"} {
+		registry := prometheus.NewRegistry()
+		s := startServer(t, WithMetricsAddr("127.0.0.1:0"), WithMetricsRegisterer(registry))
+		if status, body := get(t, "http://"+s.MetricsAddr().String()+metrics.Path, ""); status != http.StatusOK || !strings.Contains(body, "cmd_transfer_connections") {
+			t.Errorf("%s: got status %d, want the metrics of its registry", name, status)
+		}
+		// 同一注册表重复注册时忽略
+		if err := metrics.Register(registry); err != nil {
+			t.Errorf("%s: Register again: %v", name, err)
+		}
+	}
+
+	// 与注册表中已有的指标冲突时启动失败
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{Name: "cmd_transfer_connections", Help: "conflict"}))
+	s := New(WithMetricsRegisterer(registry))
+	defer s.Shutdown(context.Background())
+	if err := s.Start(context.Background()); err == nil {
+		t.Error("Start with a conflicting registry: expected error")
+	}
+}
@@ -0,0 +1,220 @@
+/*
+ * @Descripttion: 转发服务的配置项
+ * @Author: chenjun
+ * @Date: 2026-10-19 13:40:12
+ */
+
+package server
+
+import (
+	"crypto/tls"
+	"go-cmd-transfer/core/auth"
+	"go-cmd-transfer/core/certificate"
+	"go-cmd-transfer/core/hub"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	logger "github.com/sirupsen/logrus"
+)
+
+//options 转发服务的配置
+type options struct {
+	// socket监听地址
+	socketAddr string
+	// 已有的socket监听器，优先于监听地址
+	socketListener net.Listener
+	// socket的TLS配置
+	socketTLS *tls.Config
+	// socket的客户端证书认证
+	clientAuth *certificate.ClientAuth
+	// websocket监听地址
+	websocketAddr string
+	// 已有的websocket监听器，优先于监听地址
+	websocketListener net.Listener
+	// websocket的TLS配置
+	websocketTLS *tls.Config
+	// websocket的消息长度上限
+	websocketMaxMessageSize int64
+	// 注册 /ws 的路由
+	mux *http.ServeMux
+	// 管理接口监听地址
+	adminAddr string
+	// 已有的管理接口监听器，优先于监听地址
+	adminListener net.Listener
+	// 管理令牌
+	adminToken string
+	// 监控指标接口监听地址
+	metricsAddr string
+	// 已有的监控指标接口监听器，优先于监听地址
+	metricsListener net.Listener
+	// 监控指标的注册表
+	metricsRegisterer prometheus.Registerer
+	// 日志
+	log logger.FieldLogger
+	// 连接中心
+	hub *hub.Hub
+	// 认证器
+	authenticator auth.Authenticator
+	// socket连接的登录期限
+	loginTimeout time.Duration
+	// websocket允许的来源
+	allowedOrigins []string
+	// 授权策略
+	policy hub.Policy
+	// 操作类型处理函数，按注册顺序保存
+	handlers []handler
+}
+
+//handler 操作类型与处理函数
+type handler struct {
+	opType  string
+	handler hub.Handler
+}
+
+//Option 转发服务的配置项
+type Option func(*options)
+
+//WithSocketAddr socket监听地址，例如 :8866、127.0.0.1:0，未配置地址与监听器时不开启socket服务
+func WithSocketAddr(addr string) Option {
+	return func(o *options) {
+		o.socketAddr = addr
+	}
+}
+
+//WithSocketListener 在已有的监听器上提供socket服务，关闭服务时关闭该监听器
+func WithSocketListener(listener net.Listener) Option {
+	return func(o *options) {
+		o.socketListener = listener
+	}
+}
+
+//WithSocketTLS socket的TLS配置与客户端证书认证，tlsConfig 为空时不加密，clientAuth 为空时不按证书得到身份
+func WithSocketTLS(tlsConfig *tls.Config, clientAuth *certificate.ClientAuth) Option {
+	return func(o *options) {
+		o.socketTLS = tlsConfig
+		o.clientAuth = clientAuth
+	}
+}
+
+//WithWebsocketAddr websocket监听地址，未配置地址与监听器时不开启websocket服务
+func WithWebsocketAddr(addr string) Option {
+	return func(o *options) {
+		o.websocketAddr = addr
+	}
+}
+
+//WithWebsocketListener 在已有的监听器上提供websocket服务，关闭服务时关闭该监听器
+func WithWebsocketListener(listener net.Listener) Option {
+	return func(o *options) {
+		o.websocketListener = listener
+	}
+}
+
+//WithWebsocketTLS websocket的TLS配置，为空时不加密，否则提供wss（仅HTTP/1.1）
+func WithWebsocketTLS(tlsConfig *tls.Config) Option {
+	return func(o *options) {
+		o.websocketTLS = tlsConfig
+	}
+}
+
+//WithWebsocketMaxMessageSize websocket的消息长度上限（字节），超出时关闭连接，为0时默认10240
+func WithWebsocketMaxMessageSize(size int64) Option {
+	return func(o *options) {
+		o.websocketMaxMessageSize = size
+	}
+}
+
+//WithServeMux 在已有的路由上注册 /ws；同时配置了websocket地址或监听器时以该路由提供服务，否则由调用方提供服务
+func WithServeMux(mux *http.ServeMux) Option {
+	return func(o *options) {
+		o.mux = mux
+	}
+}
+
+//WithAdminAddr 管理接口监听地址与管理令牌，未配置地址与监听器时不开启管理接口，令牌为空时启动失败
+func WithAdminAddr(addr string, token string) Option {
+	return func(o *options) {
+		o.adminAddr = addr
+		o.adminToken = token
+	}
+}
+
+//WithAdminListener 在已有的监听器上提供管理接口，关闭服务时关闭该监听器
+func WithAdminListener(listener net.Listener, token string) Option {
+	return func(o *options) {
+		o.adminListener = listener
+		o.adminToken = token
+	}
+}
+
+//WithMetricsAddr 监控指标接口监听地址，未配置地址与监听器时不开启监控指标接口
+func WithMetricsAddr(addr string) Option {
+	return func(o *options) {
+		o.metricsAddr = addr
+	}
+}
+
+//WithMetricsListener 在已有的监听器上提供监控指标接口，关闭服务时关闭该监听器
+func WithMetricsListener(listener net.Listener) Option {
+	return func(o *options) {
+		o.metricsListener = listener
+	}
+}
+
+//WithMetricsRegisterer 监控指标的注册表，默认使用 prometheus 的默认注册表；注册表支持采集时监控指标接口从该注册表采集
+func WithMetricsRegisterer(registerer prometheus.Registerer) Option {
+	return func(o *options) {
+		o.metricsRegisterer = registerer
+	}
+}
+
+//WithLogger 连接中心与连接使用的日志，默认使用 logrus 的标准日志
+func WithLogger(log logger.FieldLogger) Option {
+	return func(o *options) {
+		o.log = log
+	}
+}
+
+//WithHub 使用已有的连接中心，未配置时创建新的连接中心；关闭服务时同时关闭连接中心
+func WithHub(h *hub.Hub) Option {
+	return func(o *options) {
+		o.hub = h
+	}
+}
+
+//WithAuthenticator 认证器，为空时不认证
+func WithAuthenticator(authenticator auth.Authenticator) Option {
+	return func(o *options) {
+		o.authenticator = authenticator
+	}
+}
+
+//WithLoginTimeout 启用认证时socket连接的登录期限，为0时默认10秒
+func WithLoginTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.loginTimeout = timeout
+	}
+}
+
+//WithAllowedOrigins websocket允许的来源，为空时不限制
+func WithAllowedOrigins(origins ...string) Option {
+	return func(o *options) {
+		o.allowedOrigins = origins
+	}
+}
+
+//WithPolicy 授权策略，运行中可通过 Hub().UsePolicy 替换
+func WithPolicy(policy hub.Policy) Option {
+	return func(o *options) {
+		o.policy = policy
+	}
+}
+
+//WithHandler 注册操作类型的处理函数，可覆盖内置的处理函数
+func WithHandler(opType string, h hub.Handler) Option {
+	return func(o *options) {
+		o.handlers = append(o.handlers, handler{opType, h})
+	}
+}
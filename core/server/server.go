@@ -0,0 +1,290 @@
+/*
+ * @Descripttion: 可嵌入的转发服务，同一进程可以运行多个实例
+ * @Author: chenjun
+ * @Date: 2026-10-19 13:21:05
+ */
+
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"go-cmd-transfer/core/admin"
+	"go-cmd-transfer/core/hub"
+	"go-cmd-transfer/core/metrics"
+	"go-cmd-transfer/core/socket"
+	"go-cmd-transfer/core/websocket"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// 只取消 Start 的 ctx 而未调用 Shutdown 时，HTTP服务等待处理中的请求的时长
+const httpShutdownTimeout = 5 * time.Second
+
+var (
+	//ErrStarted 服务已启动
+	ErrStarted = errors.New("server already started")
+	//ErrAdminToken 开启管理接口时未配置管理令牌
+	ErrAdminToken = errors.New("server: admin token required")
+)
+
+//Server 转发服务，包括socket服务与websocket服务，共用一个连接中心
+type Server struct {
+	// 配置
+	opts options
+	// 连接中心
+	hub *hub.Hub
+	// 启动与关闭锁
+	mutex sync.Mutex
+	// 是否已启动
+	started bool
+	// 停止监听
+	stop context.CancelFunc
+	// Shutdown 的期限，关闭HTTP服务时使用
+	shutdownCtx context.Context
+	// 监听协程
+	serving sync.WaitGroup
+	// socket监听器
+	socketListener net.Listener
+	// websocket监听器
+	websocketListener net.Listener
+	// 管理接口监听器
+	adminListener net.Listener
+	// 监控指标接口监听器
+	metricsListener net.Listener
+}
+
+/*
+New 按配置项创建转发服务
+ * @param opts 配置项
+ * @return: 未启动的转发服务
+*/
+func New(opts ...Option) *Server {
+	s := &Server{}
+	for _, opt := range opts {
+		opt(&s.opts)
+	}
+	s.hub = s.opts.hub
+	if s.hub == nil {
+		s.hub = hub.New()
+	}
+	if s.opts.log != nil {
+		s.hub.SetLogger(s.opts.log)
+	}
+	if s.opts.policy != nil {
+		s.hub.UsePolicy(s.opts.policy)
+	}
+	for _, h := range s.opts.handlers {
+		s.hub.Handle(h.opType, h.handler)
+	}
+	return s
+}
+
+//Hub 转发服务的连接中心
+func (s *Server) Hub() *hub.Hub {
+	return s.hub
+}
+
+//SocketAddr socket监听地址，未开启socket服务时为空
+func (s *Server) SocketAddr() net.Addr {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.socketListener == nil {
+		return nil
+	}
+	return s.socketListener.Addr()
+}
+
+//WebsocketAddr websocket监听地址，未开启websocket服务时为空
+func (s *Server) WebsocketAddr() net.Addr {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.websocketListener == nil {
+		return nil
+	}
+	return s.websocketListener.Addr()
+}
+
+//AdminAddr 管理接口监听地址，未开启管理接口时为空
+func (s *Server) AdminAddr() net.Addr {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.adminListener == nil {
+		return nil
+	}
+	return s.adminListener.Addr()
+}
+
+//MetricsAddr 监控指标接口监听地址，未开启监控指标接口时为空
+func (s *Server) MetricsAddr() net.Addr {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.metricsListener == nil {
+		return nil
+	}
+	return s.metricsListener.Addr()
+}
+
+/*
+Start 开始监听并在后台提供服务，不阻塞
+ * @param ctx 取消时停止监听，已建立的连接由 Shutdown 关闭
+ * @return: 已启动、开启管理接口但未配置令牌、注册监控指标或监听失败时返回错误，监听失败时已开始的监听会被关闭
+*/
+func (s *Server) Start(ctx context.Context) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.started {
+		return ErrStarted
+	}
+	if (s.opts.adminListener != nil || s.opts.adminAddr != "") && s.opts.adminToken == "" {
+		return ErrAdminToken
+	}
+	if err := metrics.Register(s.opts.metricsRegisterer); err != nil {
+		return err
+	}
+	log := s.hub.Logger()
+	var listeners []net.Listener
+	for _, l := range []struct {
+		listener  net.Listener
+		addr      string
+		tlsConfig *tls.Config
+	}{
+		{s.opts.socketListener, s.opts.socketAddr, s.opts.socketTLS},
+		{s.opts.websocketListener, s.opts.websocketAddr, s.opts.websocketTLS},
+		{s.opts.adminListener, s.opts.adminAddr, nil},
+		{s.opts.metricsListener, s.opts.metricsAddr, nil},
+	} {
+		listener, err := listen(l.listener, l.addr, l.tlsConfig)
+		if err != nil {
+			for _, started := range listeners {
+				if started != nil {
+					started.Close()
+				}
+			}
+			return err
+		}
+		listeners = append(listeners, listener)
+	}
+	socketListener, websocketListener := listeners[0], listeners[1]
+	s.started = true
+	s.socketListener, s.websocketListener, s.adminListener, s.metricsListener = socketListener, websocketListener, listeners[2], listeners[3]
+	serveCtx, stop := context.WithCancel(ctx)
+	s.stop = stop
+
+	if socketListener != nil {
+		log.Info("正在开启 Socket Server ...")
+		s.serving.Add(1)
+		go func() {
+			defer s.serving.Done()
+			socket.Serve(serveCtx, socketListener, s.hub, s.opts.authenticator, s.opts.loginTimeout, s.opts.clientAuth)
+		}()
+	}
+
+	mux := s.opts.mux
+	if mux == nil && websocketListener != nil {
+		mux = http.NewServeMux()
+	}
+	if mux != nil {
+		websocket.Handle(mux, s.hub, s.opts.authenticator, s.opts.allowedOrigins, s.opts.websocketMaxMessageSize)
+	}
+	if websocketListener != nil {
+		log.Info("开启 WebSocket Server ...")
+		s.serveHTTP(serveCtx, websocketListener, &http.Server{
+			Handler: mux,
+			// websocket升级需要HTTP/1.1，不协商HTTP/2
+			TLSNextProto: make(map[string]func(*http.Server, *tls.Conn, http.Handler)),
+		}, "WebSocket Server")
+	}
+	if s.adminListener != nil {
+		s.serveHTTP(serveCtx, s.adminListener, &http.Server{Handler: admin.New(s.hub, s.opts.adminToken).Handler()}, "Admin Server")
+	}
+	if s.metricsListener != nil {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle(metrics.Path, metrics.HandlerFor(s.opts.metricsRegisterer))
+		s.serveHTTP(serveCtx, s.metricsListener, &http.Server{Handler: metricsMux}, "Metrics Server")
+	}
+	return nil
+}
+
+//serveHTTP 在后台提供HTTP服务，ctx 取消时停止监听，已升级的websocket连接不受影响
+func (s *Server) serveHTTP(ctx context.Context, listener net.Listener, server *http.Server, name string) {
+	log := s.hub.Logger()
+	s.serving.Add(1)
+	go func() {
+		defer s.serving.Done()
+		log.Infof("开启 %s成功，监听地址：%s", name, listener.Addr())
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Errorf("监听并启动%s失败：%s", name, err.Error())
+		}
+	}()
+	s.serving.Add(1)
+	go func() {
+		defer s.serving.Done()
+		<-ctx.Done()
+		shutdownCtx, cancel := s.shutdownContext()
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Warnf("%s 等待处理中的请求超时，直接关闭：%s", name, err.Error())
+			server.Close()
+		}
+		log.Infof("%s 已停止监听", name)
+	}()
+}
+
+//shutdownContext 关闭HTTP服务的期限，调用 Shutdown 时使用其 ctx，否则最多等待 httpShutdownTimeout
+func (s *Server) shutdownContext() (context.Context, context.CancelFunc) {
+	s.mutex.Lock()
+	ctx := s.shutdownCtx
+	s.mutex.Unlock()
+	if ctx == nil {
+		return context.WithTimeout(context.Background(), httpShutdownTimeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+/*
+Shutdown 优雅关闭：停止监听，向所有连接发送关闭通知并写出写队列，最后关闭连接中心
+ * @param ctx 期限到达时直接关闭剩余的连接
+ * @return: 期限到达时返回 ctx 的错误
+*/
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mutex.Lock()
+	stop := s.stop
+	s.shutdownCtx = ctx
+	s.mutex.Unlock()
+	if stop != nil {
+		stop()
+	}
+	// 等待监听协程与HTTP服务退出，之后不再有新连接
+	done := make(chan struct{})
+	go func() {
+		s.serving.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+	return s.hub.Shutdown(ctx)
+}
+
+//listen 使用已有的监听器或按地址监听，启用TLS时包装为TLS监听器；都未配置时返回空
+func listen(listener net.Listener, addr string, tlsConfig *tls.Config) (net.Listener, error) {
+	if listener == nil && addr == "" {
+		return nil, nil
+	}
+	if listener == nil {
+		var err error
+		if listener, err = net.Listen("tcp", addr); err != nil {
+			return nil, err
+		}
+	}
+	// 启用TLS时握手在连接首次读写时进行
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+	return listener, nil
+}
@@ -0,0 +1,201 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-cmd-transfer/config"
+	"go-cmd-transfer/core/auth"
+	"go-cmd-transfer/core/client"
+	"go-cmd-transfer/core/hub"
+	"go-cmd-transfer/core/metrics"
+	"go-cmd-transfer/core/websocket"
+	"go-cmd-transfer/global"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+//dialWebsocket 以指定身份连接websocket服务，测试结束时关闭
+func dialWebsocket(t *testing.T, s *Server, userID string) *client.Client {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, err := websocket.Dial(ctx, "ws://"+s.WebsocketAddr().String()+"/ws", nil, client.WithIdentity(userID, userID+"-source"))
+	if err != nil {
+		t.Fatalf("%s: Dial: %v", userID, err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+//get 请求HTTP接口，返回状态码与响应体
+func get(t *testing.T, url string, token string) (int, string) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func TestSocketToWebsocket(t *testing.T) {
+	s := startServer(t, WithSocketAddr("127.0.0.1:0"), WithWebsocketAddr("127.0.0.1:0"))
+	device, console := dialSocket(t, s, "device"), dialWebsocket(t, s, "console")
+	waitFor(t, "both connections registered", func() bool {
+		return s.Hub().Count(hub.ProtocolSocket) == 1 && s.Hub().Count(hub.ProtocolWebsocket) == 1
+	})
+
+	// socket连接发送给websocket连接
+	if err := device.Send(global.BusinessData{OpType: hub.OpExec, Mode: hub.ModeUser, Targets: []string{"console"}, Protocol: hub.ProtocolWebsocket, Data: "from-socket"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	got := receive(t, console)
+	if got.Data != "from-socket" || got.UserID != "device" || got.SourceID != "device-source" {
+		t.Fatalf("console: got %+v", got)
+	}
+
+	// websocket连接的请求由socket连接响应
+	go func() {
+		for msg := range device.Messages() {
+			if msg.Data != nil {
+				device.Reply(*msg.Data, "pong")
+				return
+			}
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	reply, err := console.Request(ctx, global.BusinessData{OpType: hub.OpExec, Mode: hub.ModeUser, Targets: []string{"device"}, Data: "ping"})
+	if err != nil {
+		t.Fatalf("Request: %v", err)
+	}
+	if reply.Data != "pong" || reply.UserID != "device" {
+		t.Errorf("console: got reply %+v", reply)
+	}
+}
+
+func TestWebsocketLargeMessage(t *testing.T) {
+	s := startServer(t, WithSocketAddr("127.0.0.1:0"), WithWebsocketAddr("127.0.0.1:0"))
+	device, console := dialSocket(t, s, "device"), dialWebsocket(t, s, "console")
+	waitFor(t, "both connections registered", func() bool {
+		return s.Hub().Count(hub.ProtocolSocket) == 1 && s.Hub().Count(hub.ProtocolWebsocket) == 1
+	})
+
+	// 超过原先512字节限制的消息照常转发
+	data := strings.Repeat("x", 4096)
+	if err := console.Send(global.BusinessData{OpType: hub.OpExec, Mode: hub.ModeUser, Targets: []string{"device"}, Data: data}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if got := receive(t, device); got.Data != data {
+		t.Fatalf("device: got %d bytes, want %d", len(fmt.Sprint(got.Data)), len(data))
+	}
+	if !console.Connected() {
+		t.Error("console: disconnected after sending a large message")
+	}
+}
+
+func TestWebsocketRejectsIdentityWithoutUserID(t *testing.T) {
+	authenticator := auth.NewStaticTokens([]config.Token{{Token: "anonymous-token", SourceID: "kiosk"}})
+	s := startServer(t, WithWebsocketAddr("127.0.0.1:0"), WithAuthenticator(authenticator))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, err := websocket.Dial(ctx, "ws://"+s.WebsocketAddr().String()+"/ws", nil, client.WithToken("anonymous-token"), client.WithIdentity("console", ""))
+	if err == nil {
+		c.Close()
+		t.Fatal("Dial: expected the handshake to be rejected")
+	}
+	if !strings.Contains(err.Error(), "401") {
+		t.Errorf("Dial: got error %v, want 401", err)
+	}
+}
+
+func TestAdminAndMetricsListeners(t *testing.T) {
+	s := startServer(t,
+		WithSocketAddr("127.0.0.1:0"),
+		WithAdminAddr("127.0.0.1:0", "secret"),
+		WithMetricsAddr("127.0.0.1:0"),
+	)
+	dialSocket(t, s, "device")
+	waitFor(t, "connection registered", func() bool { return s.Hub().Count(hub.ProtocolSocket) == 1 })
+	adminURL, metricsURL := "http://"+s.AdminAddr().String(), "http://"+s.MetricsAddr().String()
+
+	if status, _ := get(t, adminURL+"/connections", ""); status != http.StatusUnauthorized {
+		t.Errorf("admin without token: got status %d, want %d", status, http.StatusUnauthorized)
+	}
+	if status, body := get(t, adminURL+"/connections", "secret"); status != http.StatusOK || !strings.Contains(body, `"userId":"device"`) {
+		t.Errorf("admin connections: got %d %s", status, body)
+	}
+	if status, body := get(t, metricsURL+metrics.Path, ""); status != http.StatusOK || !strings.Contains(body, "cmd_transfer_connections") {
+		t.Errorf("metrics: got status %d", status)
+	}
+
+	// 关闭服务时一并停止监听
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	for _, addr := range []net.Addr{s.AdminAddr(), s.MetricsAddr(), s.SocketAddr()} {
+		if conn, err := net.DialTimeout("tcp", addr.String(), time.Second); err == nil {
+			conn.Close()
+			t.Errorf("%s: still accepting connections after shutdown", addr)
+		}
+	}
+}
+
+func TestAdminRequiresToken(t *testing.T) {
+	s := New(WithAdminAddr("127.0.0.1:0", ""))
+	defer s.Shutdown(context.Background())
+	if err := s.Start(context.Background()); !errors.Is(err, ErrAdminToken) {
+		t.Fatalf("Start: got error %v, want %v", err, ErrAdminToken)
+	}
+}
+
+func TestShutdownBoundsHTTPServers(t *testing.T) {
+	entered := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slow", func(resp http.ResponseWriter, req *http.Request) {
+		close(entered)
+		<-req.Context().Done()
+	})
+	s := New(WithWebsocketAddr("127.0.0.1:0"), WithServeMux(mux))
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	failed := make(chan error, 1)
+	go func() {
+		resp, err := http.Get("http://" + s.WebsocketAddr().String() + "/slow")
+		if err == nil {
+			resp.Body.Close()
+		}
+		failed <- err
+	}()
+	<-entered
+
+	// 期限到达时直接关闭处理中的请求
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	s.Shutdown(ctx)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Shutdown took %s, want about 100ms", elapsed)
+	}
+	select {
+	case err := <-failed:
+		if err == nil {
+			t.Error("slow request: expected the connection to be closed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("slow request still running after shutdown")
+	}
+}
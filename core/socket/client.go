@@ -1,5 +1,5 @@
 /*
- * @Descripttion: socket客户端
+ * @Descripttion: socket客户端，使用v2报文，与服务端共用解码器
  * @Author: chenjun
  * @Date: 2020-08-06 17:24:34
  */
@@ -7,77 +7,140 @@
 package socket
 
 import (
-	"bufio"
+	"context"
+	"crypto/tls"
+	"go-cmd-transfer/core/client"
 	"net"
-	"os"
-
-	logger "github.com/sirupsen/logrus"
+	"sync"
+	"time"
 )
 
-//clientConnHandler 处理用户连接
-func clientConnHandler(conn net.Conn, message string) {
-	//1.conn是否有效
-	if conn == nil {
-		logger.Error("无效的 socket 连接")
-		return
-	}
+// 客户端写入期限
+const clientWriteWait = 10 * time.Second
+
+/*
+Dial 连接socket服务端，断开后自动重连
+ * @param ctx 首次连接的期限
+ * @param addr 服务端地址，例如 127.0.0.1:8866
+ * @param tlsConfig TLS配置，为空时不加密
+ * @param opts 客户端配置项
+ * @return: 首次连接或登录失败时返回错误
+*/
+func Dial(ctx context.Context, addr string, tlsConfig *tls.Config, opts ...client.Option) (*client.Client, error) {
+	return client.Dial(ctx, NewClientTransport(addr, tlsConfig), opts...)
+}
+
+//clientTransport socket客户端传输层
+type clientTransport struct {
+	// 服务端地址
+	addr string
+	// TLS配置
+	tlsConfig *tls.Config
+}
 
-	//切片缓冲 缓存 conn 中的数据
-	buf := make([]byte, 4096)
-	var breakfor int
+//NewClientTransport 创建socket客户端传输层，tlsConfig 为空时不加密
+func NewClientTransport(addr string, tlsConfig *tls.Config) client.Transport {
+	return &clientTransport{addr: addr, tlsConfig: tlsConfig}
+}
 
-	//服务器重连后，自动重新发送上次消息
-	if message != "" {
-		logger.Info("客户端自动重新建立socket连接")
-		messageHandle(conn, message, buf)
+//Dial 建立连接，启用TLS时在 ctx 期限内完成握手；令牌由登录报文携带，握手时不使用
+func (t *clientTransport) Dial(ctx context.Context, token string) (client.Conn, error) {
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", t.addr)
+	if err != nil {
+		return nil, err
+	}
+	if t.tlsConfig != nil {
+		tlsConn := tls.Client(conn, t.tlsConfig)
+		if deadline, ok := ctx.Deadline(); ok {
+			tlsConn.SetDeadline(deadline)
+		}
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		tlsConn.SetDeadline(time.Time{})
+		conn = tlsConn
 	}
+	return &clientConn{
+		conn:    conn,
+		decoder: NewDecoder(maxMessageSize),
+		buf:     make([]byte, readBufferSize),
+	}, nil
+}
 
-	//返回一个拥有 默认size 的reader，接收客户端输入
-	reader := bufio.NewReader(os.Stdin)
+//clientConn socket客户端连接
+type clientConn struct {
+	// 网络连接
+	conn net.Conn
+	// 流式解码器，只在读协程中使用
+	decoder *Decoder
+	// 读取缓冲
+	buf []byte
+	// 写入锁，读协程回复心跳时与业务写入并发
+	writeMutex sync.Mutex
+}
 
+//Read 读取一条业务报文，回复服务端的心跳，收到关闭通知时返回 client.ErrGoingAway
+func (c *clientConn) Read(timeout time.Duration) ([]byte, error) {
 	for {
-		logger.Info("请输入客户端请求数据...")
-
-		//客户端输入
-		input, _ := reader.ReadString('\n')
-		//发送消息
-		breakfor = messageHandle(conn, input, buf)
-		if breakfor == 1 {
-			message = input
-			conn.Close() //关闭连接
-			break        //打断循环
+		frame, err := c.decoder.Next()
+		if err != nil {
+			return nil, err
+		}
+		if frame != nil {
+			switch frame.Type {
+			case TypeData:
+				return frame.Payload, nil
+			case TypePing:
+				return nil, c.writeFrame(&Frame{Version: Version2, Type: TypePong, Payload: frame.Payload})
+			case TypeControl:
+				if string(frame.Payload) == ControlClose {
+					return nil, client.ErrGoingAway
+				}
+			}
+			// 心跳响应等报文只用于延长读取期限
+			return nil, nil
+		}
+		deadline := time.Time{}
+		if timeout > 0 {
+			deadline = time.Now().Add(timeout)
+		}
+		c.conn.SetReadDeadline(deadline)
+		cnt, err := c.conn.Read(c.buf)
+		if cnt > 0 {
+			c.decoder.Feed(c.buf[:cnt])
+		}
+		if err != nil {
+			return nil, err
 		}
 	}
 }
 
-//消息处理
-func messageHandle(conn net.Conn, message string, buf []byte) int {
-	//客户端请求数据写入 conn，并传输
-	cnt, err := conn.Write(append(append([]byte("cmdmgt"), IntToBytes(len(message))...), message...))
-	if cnt == 0 || err != nil {
-		logger.Error("客户端请求数据写入socket连接通道中错误", err.Error())
-		return 1 //退出当前循环
-	}
-	//服务器端返回的数据写入空buf  接收服务器回复的数据
-	cnt, err = conn.Read(buf)
-	if cnt == 0 || err != nil {
-		logger.Error("客户端接收服务器回复的socket数据失败", err.Error())
-		return 1 //退出当前循环
-	}
+//Write 以v2业务数据报文写入
+func (c *clientConn) Write(data []byte) error {
+	return c.writeFrame(NewDataFrame(Version2, data))
+}
+
+//Ping 发送心跳请求
+func (c *clientConn) Ping() error {
+	return c.writeFrame(&Frame{Version: Version2, Type: TypePing})
+}
 
-	//回显服务器端回传的信息
-	logger.Info("服务器端回复socket数据", string(buf[0:cnt]))
-	return 0
+//Close 关闭连接
+func (c *clientConn) Close() error {
+	return c.conn.Close()
 }
 
-//ClientConnect 客户端连接
-func ClientConnect(message string, addrPort string) {
-	uri := "0.0.0.0:" + addrPort
-	conn, err := net.Dial("tcp", uri)
+//writeFrame 封包并写入连接
+func (c *clientConn) writeFrame(frame *Frame) error {
+	data, err := EncodeFrame(frame)
 	if err != nil {
-		logger.Error("客户端建立socket连接失败", err.Error())
-		return
+		return err
 	}
-	//启用协程
-	go clientConnHandler(conn, message)
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(clientWriteWait))
+	_, err = c.conn.Write(data)
+	return err
 }
@@ -8,10 +8,15 @@ package socket
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"errors"
+	"go-cmd-transfer/core/hub"
+	"go-cmd-transfer/core/metrics"
+	"go-cmd-transfer/utils"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	logger "github.com/sirupsen/logrus"
@@ -36,16 +41,26 @@ const (
 	headerInfoLength = len(headerInfo)
 	// 保存数据长度
 	saveDataLength = 4
+	// 单次读取的缓冲长度
+	readBufferSize = 4096
+	// 协议错误响应编码
+	protocolErrorCode = "4000"
+	// 服务正在关闭的响应编码
+	unavailableCode = "5030"
 )
 
 //SConnection 连接信息
 type SConnection struct {
+	// 读取的字节数，原子操作的64位字段放在结构体开头以保证对齐
+	bytesIn uint64
+	// 写入的字节数
+	bytesOut uint64
 	// 存放socket连接
 	socketConn net.Conn
 	// 用于存放数据 读队列
 	inChan chan []byte
 	// 用于读取数据 写队列
-	outChan chan []byte
+	outChan chan *Frame
 	// 用于关闭连接
 	closeChan chan byte
 	// 对closeChan关闭上锁 避免重复关闭管道,加锁处理  互斥锁
@@ -56,97 +71,316 @@ type SConnection struct {
 	sid string
 	// 网络地址
 	addr string
+	// 绑定的用户账号
+	userID string
+	// 绑定的接入端标识
+	sourceID string
+	// 所属连接中心
+	hub *hub.Hub
+	// 日志，取自连接中心
+	log logger.FieldLogger
+	// 连接时间
+	connectedAt time.Time
+	// 报文版本，由客户端首个报文协商，之前按v1响应
+	version byte
 }
 
-//InitConnection 初始化长连接
-func InitConnection(sConn net.Conn, connID string, connAddr string) (conn *SConnection, err error) {
-	conn = &SConnection{
-		socketConn: sConn,
-		inChan:     make(chan []byte, 4096),
-		outChan:    make(chan []byte, 4096),
-		closeChan:  make(chan byte, 1),
-		isClosed:   false,
-		sid:        connID,
-		addr:       connAddr,
+//InitConnection 初始化长连接并注册到连接中心
+func InitConnection(h *hub.Hub, sConn net.Conn, connID string, connAddr string) (conn *SConnection, err error) {
+	conn = newConnection(h, sConn, connID, connAddr)
+	// 先注册到连接中心再启动读写协程，保证连接关闭时一定能注销
+	h.Register(conn)
+	conn.start()
+	return
+}
+
+//InitPendingConnection 初始化等待登录的长连接，登录成功后调用 Register 注册到连接中心，之前不接收投递的消息，连接中心关闭时直接关闭
+func InitPendingConnection(h *hub.Hub, sConn net.Conn, connID string, connAddr string) (conn *SConnection, err error) {
+	conn = newConnection(h, sConn, connID, connAddr)
+	h.AddPending(conn)
+	conn.start()
+	return
+}
+
+//Register 注册到连接中心，连接已关闭时立即注销
+func (conn *SConnection) Register() {
+	conn.hub.Register(conn)
+	conn.mutex.Lock()
+	closed := conn.isClosed
+	conn.mutex.Unlock()
+	if closed {
+		conn.hub.Unregister(conn)
+	}
+}
+
+//newConnection 创建连接
+func newConnection(h *hub.Hub, sConn net.Conn, connID string, connAddr string) *SConnection {
+	return &SConnection{
+		socketConn:  sConn,
+		inChan:      make(chan []byte, 4096),
+		outChan:     make(chan *Frame, 4096),
+		closeChan:   make(chan byte, 1),
+		isClosed:    false,
+		sid:         connID,
+		addr:        connAddr,
+		hub:         h,
+		log:         h.Logger(),
+		version:     Version1,
+		connectedAt: time.Now(),
 	}
+}
 
+//start 启动读写协程
+func (conn *SConnection) start() {
 	// 读协程
 	go conn.readLoop()
 	// 写协程
 	go conn.writeLoop()
-	return
 }
 
 //ReadMessage 读取消息队列中的消息
 func (conn *SConnection) ReadMessage() (data []byte, err error) {
-	logger.Infof("socket读取消息，连接标识：%s，连接地址：%s", conn.sid, conn.addr)
+	conn.log.Infof("socket读取消息，连接标识：%s，连接地址：%s", conn.sid, conn.addr)
 	//select是Go中的一个控制结构，类似于用于通信的switch语句。
 	//每个case必须是一个通信操作，要么是发送要么是接收。
 	//select随机执行一个可运行的case。如果没有case可运行，它将阻塞，直到有case可运行。一个默认的子句应该总是可运行的。
 	select {
 	// 从Channel中接收数据，并将数据赋值给msg
 	case data = <-conn.inChan:
-		logger.Infof("socket读取消息时，连接标识：%s，连接地址：%s，数据信息为：%s", conn.sid, conn.addr, string(data))
+		conn.log.Infof("socket读取消息时，连接标识：%s，连接地址：%s，数据长度：%d", conn.sid, conn.addr, len(data))
 	case <-conn.closeChan:
 		err = errors.New("connection is closed")
-		logger.Errorf("socket读取消息时，连接标识：%s，连接地址：%s，连接被关闭，错误信息：%s", conn.sid, conn.addr, err.Error())
+		conn.log.Errorf("socket读取消息时，连接标识：%s，连接地址：%s，连接被关闭，错误信息：%s", conn.sid, conn.addr, err.Error())
 	}
 	//如果return后面没有指定返回值，就用赋给“返回值变量”的值
 	return
 }
 
-//WriteMessage 发送消息到队列中
+//WriteMessage 发送业务数据到队列中
 func (conn *SConnection) WriteMessage(data []byte) (err error) {
-	logger.Infof("socket发送消息，连接标识：%s，连接地址：%s", conn.sid, conn.addr)
+	return conn.WriteFrame(&Frame{Type: TypeData, Payload: data})
+}
+
+//WriteFrame 发送报文到队列中，报文版本为空时使用协商的版本
+func (conn *SConnection) WriteFrame(frame *Frame) (err error) {
+	conn.log.Infof("socket发送消息，连接标识：%s，连接地址：%s", conn.sid, conn.addr)
+	conn.observeOut()
 	select {
 	// 发送值data到Channel中
-	case conn.outChan <- data:
-		logger.Infof("socket发送消息时，连接标识：%s，连接地址：%s，数据信息为：%s", conn.sid, conn.addr, string(data))
+	case conn.outChan <- frame:
+		conn.log.Infof("socket发送消息时，连接标识：%s，连接地址：%s，消息类型：%d，数据信息为：%s", conn.sid, conn.addr, frame.Type, string(frame.Payload))
 	case <-conn.closeChan:
 		err = errors.New("connection is closed")
-		logger.Errorf("socket发送消息时，连接标识：%s，连接地址：%s，连接被关闭，错误信息：%s", conn.sid, conn.addr, err.Error())
+		conn.log.Errorf("socket发送消息时，连接标识：%s，连接地址：%s，连接被关闭，错误信息：%s", conn.sid, conn.addr, err.Error())
 	}
 	//当return后面为空是，函数声明时的 (err error) 会把 err 作为返回值，当 return 不为空时，会把 return 后面的值作为返回值
 	return
 }
 
+//ID 连接标识
+func (conn *SConnection) ID() string {
+	return conn.sid
+}
+
+//Protocol 连接所属协议
+func (conn *SConnection) Protocol() string {
+	return hub.ProtocolSocket
+}
+
+//Addr 网络地址
+func (conn *SConnection) Addr() string {
+	return conn.addr
+}
+
+//ConnectedAt 连接时间
+func (conn *SConnection) ConnectedAt() time.Time {
+	return conn.connectedAt
+}
+
+//Stats 读取与写入的字节数，按线路上的数据计算
+func (conn *SConnection) Stats() (bytesIn uint64, bytesOut uint64) {
+	return atomic.LoadUint64(&conn.bytesIn), atomic.LoadUint64(&conn.bytesOut)
+}
+
+//countIn 记录读取的字节数
+func (conn *SConnection) countIn(cnt int) {
+	atomic.AddUint64(&conn.bytesIn, uint64(cnt))
+	metrics.BytesIn.WithLabelValues(hub.ProtocolSocket).Add(float64(cnt))
+}
+
+//countOut 记录写入的字节数
+func (conn *SConnection) countOut(cnt int) {
+	atomic.AddUint64(&conn.bytesOut, uint64(cnt))
+	metrics.BytesOut.WithLabelValues(hub.ProtocolSocket).Add(float64(cnt))
+}
+
+//observeOut 记录入队时写队列的长度
+func (conn *SConnection) observeOut() {
+	metrics.QueueDepth.WithLabelValues(hub.ProtocolSocket, metrics.QueueOut).Observe(float64(len(conn.outChan)))
+}
+
+//Send 发送数据到写队列，实现 hub.Conn，写队列已满时不阻塞直接返回错误
+func (conn *SConnection) Send(data []byte) (err error) {
+	return conn.trySend(&Frame{Type: TypeData, Payload: data})
+}
+
+//trySend 不阻塞地发送报文到写队列
+func (conn *SConnection) trySend(frame *Frame) (err error) {
+	conn.observeOut()
+	select {
+	case conn.outChan <- frame:
+	case <-conn.closeChan:
+		err = errors.New("connection is closed")
+	default:
+		err = errors.New("send queue is full")
+	}
+	return
+}
+
+//Version 协商的报文版本
+func (conn *SConnection) Version() byte {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+	return conn.version
+}
+
+//negotiate 按客户端首个报文的版本协商，v1客户端保持v1响应
+func (conn *SConnection) negotiate(frame *Frame, first bool) {
+	if !first {
+		return
+	}
+	conn.mutex.Lock()
+	conn.version = frame.Version
+	conn.mutex.Unlock()
+	conn.log.Infof("socket报文版本协商，连接标识：%s，连接地址：%s，报文版本：%d", conn.sid, conn.addr, frame.Version)
+}
+
+/*
+Drain 发送关闭通知，写出写队列中的消息后关闭连接
+ * v2连接的关闭通知为数据是 close 的控制报文，v1报文无法表达控制消息，以失败消息通知
+ * @param ctx 期限到达时直接关闭连接
+*/
+func (conn *SConnection) Drain(ctx context.Context) {
+	frame := &Frame{Type: TypeControl, Payload: []byte(ControlClose), closing: true}
+	if conn.Version() != Version2 {
+		frame = &Frame{Type: TypeData, Payload: []byte(utils.FailCodeMessage(unavailableCode, "server shutting down")), closing: true}
+	}
+	// 关闭通知排在写队列末尾，写协程写出后关闭连接
+	select {
+	case conn.outChan <- frame:
+		select {
+		case <-conn.closeChan:
+		case <-ctx.Done():
+			conn.log.Warnf("socket写出写队列超时，连接标识：%s，连接地址：%s，未写出的消息数：%d", conn.sid, conn.addr, len(conn.outChan))
+		}
+	case <-conn.closeChan:
+	case <-ctx.Done():
+	}
+	conn.Close()
+}
+
+//Bind 绑定连接身份，只绑定一次，绑定后该连接只能以此身份收发消息
+func (conn *SConnection) Bind(userID string, sourceID string) {
+	conn.mutex.Lock()
+	if conn.userID == "" && conn.sourceID == "" {
+		conn.userID = userID
+		conn.sourceID = sourceID
+		conn.log.Infof("socket连接绑定身份，连接标识：%s，连接地址：%s，用户账号：%s，接入端标识：%s", conn.sid, conn.addr, userID, sourceID)
+	}
+	conn.mutex.Unlock()
+}
+
+//Identity 获取连接绑定的身份
+func (conn *SConnection) Identity() (userID string, sourceID string) {
+	conn.mutex.Lock()
+	userID, sourceID = conn.userID, conn.sourceID
+	conn.mutex.Unlock()
+	return
+}
+
 //Close 关闭连接
 func (conn *SConnection) Close() {
-	logger.Infof("socket关闭连接，连接标识：%s，连接地址：%s", conn.sid, conn.addr)
+	conn.log.Infof("socket关闭连接，连接标识：%s，连接地址：%s", conn.sid, conn.addr)
 	// 线程安全的Close，可以并发多次调用也叫做可重入的Close
 	conn.socketConn.Close()
 	// 利用标记，让closeChan只关闭一次
 	conn.mutex.Lock()
-	logger.Infof("socket关闭连接，连接标识：%s，连接地址：%s，当前连接是否关闭状态为：%t", conn.sid, conn.addr, conn.isClosed)
+	conn.log.Infof("socket关闭连接，连接标识：%s，连接地址：%s，当前连接是否关闭状态为：%t", conn.sid, conn.addr, conn.isClosed)
 	if conn.isClosed == false {
 		// 关闭chan,但是chan只能关闭一次
 		close(conn.closeChan)
-		// 删除这个连接的变量
-		delete(SocketConnAll, conn.sid)
 		conn.isClosed = true
 	}
 	//释放锁
 	conn.mutex.Unlock()
+	// 从连接中心注销这个连接
+	conn.hub.Unregister(conn)
 }
 
 //读取消息队列中的消息 内部实现
 func (conn *SConnection) readLoop() {
-	//消息格式为  头部信息+数据长度（4）个字节+数据
-	conn.socketConn.SetReadDeadline(time.Now().Add(pongWait))
+	// 流式解码器，缓存跨多次读取的报文
+	decoder := NewDecoder(maxMessageSize)
 	// 数据缓冲
-	databuf := make([]byte, maxMessageSize)
+	databuf := make([]byte, readBufferSize)
+	// 是否为首个报文
+	first := true
 	//循环读取网络数据流
 	for {
+		// 收到任何数据都会延长读取期限，客户端空闲时应发送心跳
+		conn.socketConn.SetReadDeadline(time.Now().Add(pongWait))
 		//网络数据流读入 buffer
 		cnt, err := conn.socketConn.Read(databuf)
-		logger.Infof("socket消息读取，连接标识：%s，连接地址：%s，一条消息的长度为：%d", conn.sid, conn.addr, cnt)
+		conn.countIn(cnt)
+		conn.log.Infof("socket消息读取，连接标识：%s，连接地址：%s，读取的数据长度为：%d", conn.sid, conn.addr, cnt)
 		//数据读尽、读取错误 socket连接错误
 		if err != nil {
-			logger.Errorf("socket消息读取出现错误，连接标识：%s，连接地址：%s，错误信息为：%s", conn.sid, conn.addr, err.Error())
+			conn.log.Errorf("socket消息读取出现错误，连接标识：%s，连接地址：%s，错误信息为：%s", conn.sid, conn.addr, err.Error())
 			goto ERR
 		}
 		//解包
-		unpackLoop(databuf[0:cnt], conn)
+		decoder.Feed(databuf[0:cnt])
+		for {
+			frame, err := decoder.Next()
+			if err != nil {
+				metrics.DecodeErrors.WithLabelValues(hub.ProtocolSocket).Inc()
+				conn.log.Errorf("socket消息解包出现协议错误，连接标识：%s，连接地址：%s，错误信息为：%s", conn.sid, conn.addr, err.Error())
+				// 直接写入连接，不经过写队列，随后关闭连接
+				if data, err := EncodeFrame(NewDataFrame(conn.Version(), []byte(utils.FailCodeMessage(protocolErrorCode, err.Error())))); err == nil {
+					cnt, _ := conn.socketConn.Write(data)
+					conn.countOut(cnt)
+				}
+				goto ERR
+			}
+			// 剩余数据不足一个报文，等待下次读取
+			if frame == nil {
+				break
+			}
+			conn.negotiate(frame, first)
+			first = false
+			conn.log.Infof("socket消息解包读取时，连接标识：%s，连接地址：%s，报文版本：%d，消息类型：%d，数据长度：%d", conn.sid, conn.addr, frame.Version, frame.Type, len(frame.Payload))
+			switch frame.Type {
+			case TypeData:
+				// 放入请求队列,消息入栈 容易阻塞到这里，等待inChan有空闲的位置
+				metrics.QueueDepth.WithLabelValues(hub.ProtocolSocket, metrics.QueueIn).Observe(float64(len(conn.inChan)))
+				select {
+				case conn.inChan <- frame.Payload:
+				case <-conn.closeChan:
+					// closeChan关闭的时候执行
+					goto ERR
+				}
+			case TypePing:
+				// 原样回复心跳数据
+				conn.trySend(&Frame{Version: Version2, Type: TypePong, Payload: frame.Payload})
+			case TypePong:
+				// 心跳响应，读取期限已延长
+			case TypeAck:
+				// 确认报文的数据为消息标识
+				conn.hub.Ack(conn, string(frame.Payload))
+			default:
+				conn.log.Warnf("socket消息暂不处理该消息类型，连接标识：%s，连接地址：%s，消息类型：%d", conn.sid, conn.addr, frame.Type)
+			}
+		}
 	}
 ERR:
 	conn.Close()
@@ -158,29 +392,31 @@ func (conn *SConnection) writeLoop() {
 	defer func() {
 		ticker.Stop()
 	}()
-	conn.socketConn.SetWriteDeadline(time.Now().Add(writeWait))
 	for {
 		select {
 		// 取一个应答
-		case data := <-conn.outChan:
-			//封包
-			data = packetLoop(data)
-			_, err := conn.socketConn.Write(data)
-			if err != nil {
-				logger.Errorf("socket消息写入出现错误，连接标识：%s，连接地址：%s，错误信息为：%s", conn.sid, conn.addr, err.Error())
+		case frame := <-conn.outChan:
+			if err := conn.writeFrame(frame); err != nil {
+				metrics.WriteErrors.WithLabelValues(hub.ProtocolSocket).Inc()
+				conn.log.Errorf("socket消息写入出现错误，连接标识：%s，连接地址：%s，错误信息为：%s", conn.sid, conn.addr, err.Error())
 				// 切断服务
 				goto ERR
 			}
-			//logger.Infof("socket 写入的消息为：%s", string(data[0:cnt]))
+			// 关闭通知已写出，之前入队的消息都已写出
+			if frame.closing {
+				goto ERR
+			}
 		case <-conn.closeChan:
 			// 获取到关闭通知
 			goto ERR
 		case <-ticker.C:
-			// 出现超时情况
-			conn.socketConn.SetWriteDeadline(time.Now().Add(writeWait))
-			logger.Errorf("socket消息写入出现超时情况，连接标识：%s，连接地址：%s", conn.sid, conn.addr)
-			if _, err := conn.socketConn.Write([]byte("time out leave out")); err != nil {
-				logger.Errorf("socket消息写入出现超时情况，连接标识：%s，连接地址：%s，错误信息为：%s", conn.sid, conn.addr, err.Error())
+			// v1报文无法表达心跳，只有协商为v2的连接才发送
+			if conn.Version() != Version2 {
+				continue
+			}
+			if err := conn.writeFrame(&Frame{Version: Version2, Type: TypePing}); err != nil {
+				metrics.WriteErrors.WithLabelValues(hub.ProtocolSocket).Inc()
+				conn.log.Errorf("socket心跳写入出现错误，连接标识：%s，连接地址：%s，错误信息为：%s", conn.sid, conn.addr, err.Error())
 				goto ERR
 			}
 		}
@@ -189,76 +425,19 @@ ERR:
 	conn.Close()
 }
 
-//封包
-func packetLoop(message []byte) []byte {
-	return append(append([]byte(headerInfo), IntToBytes(len(message))...), message...)
-}
-
-//解包
-func unpackLoop(buffer []byte, conn *SConnection) {
-	length := len(buffer)
-	// 检查超长消息
-	if length > maxMessageSize {
-		logger.Errorf("socket消息读取出现错误，连接标识：%s，连接地址：%s，消息长度太长：%d", conn.sid, conn.addr, length)
-		return
+//writeFrame 封包并写入连接
+func (conn *SConnection) writeFrame(frame *Frame) error {
+	if frame.Version == 0 {
+		frame.Version = conn.Version()
 	}
-	//如果消息长度不够直接返回
-	if length < headerInfoLength+saveDataLength {
-		// 放入请求队列,消息入栈 容易阻塞到这里，等待inChan有空闲的位置
-		select {
-		case conn.inChan <- buffer:
-		case <-conn.closeChan:
-			// closeChan关闭的时候执行
-			conn.Close()
-		}
-		return
-	}
-
-	var i int
-	//消息分割循环
-	var index int
-	for i = 0; i < length; i = i + 1 {
-		if length < i+headerInfoLength+saveDataLength {
-			break
-		}
-		// 消息头
-		if string(buffer[i:i+headerInfoLength]) == headerInfo {
-			index++
-			//头部信息+数据长度
-			dataIndex := i + headerInfoLength + saveDataLength
-			logger.Infof("socket消息解包读取时，连接标识：%s，连接地址：%s，一条消息的第%d个包的数据位置：%d", conn.sid, conn.addr, index, dataIndex)
-			//消息长度
-			messageLength := BytesToInt(buffer[i+headerInfoLength : dataIndex])
-			logger.Infof("socket消息解包读取时，连接标识：%s，连接地址：%s，一条消息的第%d个包的数据长度：%d", conn.sid, conn.addr, index, messageLength)
-			//提取数据
-			if length < dataIndex+messageLength {
-				logger.Warnf("socket消息解包读取时，连接标识：%s，连接地址：%s，一条消息的第%d个包的数据截止位置超长", conn.sid, conn.addr, index)
-				index = 0
-				break
-			}
-			data := buffer[dataIndex : dataIndex+messageLength]
-			logger.Infof("socket消息解包读取时，连接标识：%s，连接地址：%s，一条消息的第%d个包的数据长度：%d，数据信息为：%s", conn.sid, conn.addr, index, messageLength, string(data))
-			// 放入请求队列,消息入栈 容易阻塞到这里，等待inChan有空闲的位置
-			select {
-			case conn.inChan <- data:
-			case <-conn.closeChan:
-				// closeChan关闭的时候执行
-				conn.Close()
-			}
-			//读取下一个消息
-			i += headerInfoLength + saveDataLength + messageLength - 1
-		}
-	}
-	//一个包都没有解析到
-	if index == 0 {
-		logger.Warnf("socket消息解包读取时，连接标识：%s，连接地址：%s，一条消息的一个包的数据都未能解析", conn.sid, conn.addr)
-		select {
-		case conn.inChan <- buffer:
-		case <-conn.closeChan:
-			// closeChan关闭的时候执行
-			conn.Close()
-		}
+	data, err := EncodeFrame(frame)
+	if err != nil {
+		return err
 	}
+	conn.socketConn.SetWriteDeadline(time.Now().Add(writeWait))
+	cnt, err := conn.socketConn.Write(data)
+	conn.countOut(cnt)
+	return err
 }
 
 //IntToBytes 整型转换成字节
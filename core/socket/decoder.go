@@ -0,0 +1,126 @@
+/*
+ * @Descripttion: socket报文流式解码
+ * @Author: chenjun
+ * @Date: 2026-10-18 11:20:36
+ */
+
+package socket
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+var (
+	//ErrBadHeader 报文头部不是固定头部
+	ErrBadHeader = errors.New("cmdmgt protocol error: bad frame header")
+	//ErrFrameTooLarge 报文声明的数据长度超出限制
+	ErrFrameTooLarge = errors.New("cmdmgt protocol error: frame too large")
+)
+
+//Decoder 有状态的流式解码器，缓存不完整的报文，与连接无关可单独使用
+type Decoder struct {
+	// 数据长度上限
+	maxSize int
+	// 已读取未解码的数据
+	buf []byte
+	// 未解码数据在 buf 中的起始位置
+	start int
+}
+
+//NewDecoder 创建解码器，maxSize 为单个报文数据长度上限
+func NewDecoder(maxSize int) *Decoder {
+	return &Decoder{maxSize: maxSize}
+}
+
+//Feed 追加从网络读取到的数据，数据会被复制，调用方可以复用 p
+func (d *Decoder) Feed(p []byte) {
+	// 丢弃已解码的数据，复用缓冲空间
+	if d.start > 0 {
+		n := copy(d.buf, d.buf[d.start:])
+		d.buf = d.buf[:n]
+		d.start = 0
+	}
+	d.buf = append(d.buf, p...)
+}
+
+//Buffered 已缓存未解码的字节数
+func (d *Decoder) Buffered() int {
+	return len(d.buf) - d.start
+}
+
+/*
+Next 解码下一个完整报文，v1与v2报文可以混合出现
+ * @return: 报文；数据不足一个报文时返回 nil, nil；头部错误、长度超限等协议错误时返回错误，之后解码器不可再用
+*/
+func (d *Decoder) Next() (*Frame, error) {
+	pending := d.buf[d.start:]
+	// 头部不完整时先校验已到达的部分，尽早拒绝错误的数据
+	headerLength := len(pending)
+	if headerLength > headerInfoLength {
+		headerLength = headerInfoLength
+	}
+	if string(pending[:headerLength]) != headerInfo[:headerLength] {
+		return nil, ErrBadHeader
+	}
+	if len(pending) <= headerInfoLength {
+		return nil, nil
+	}
+	frame := &Frame{Version: Version1, Type: TypeData}
+	dataIndex := headerInfoLength + saveDataLength
+	// v1的数据长度首字节恒为0，否则为v2的版本字节
+	switch pending[headerInfoLength] {
+	case 0:
+	case Version2:
+		dataIndex += v2MetaLength
+		if len(pending) < dataIndex {
+			return nil, nil
+		}
+		frame.Version = Version2
+		frame.Flags = pending[headerInfoLength+1]
+		frame.Type = pending[headerInfoLength+2]
+		if frame.Flags&^knownFlags != 0 || frame.Flags&FlagEncrypted != 0 {
+			return nil, fmt.Errorf("%w: 0x%02x", ErrBadFlags, frame.Flags)
+		}
+		if !validType(frame.Type) {
+			return nil, fmt.Errorf("%w: 0x%02x", ErrBadType, frame.Type)
+		}
+	default:
+		return nil, fmt.Errorf("%w: 0x%02x", ErrBadVersion, pending[headerInfoLength])
+	}
+	if len(pending) < dataIndex {
+		return nil, nil
+	}
+	// 按声明的数据长度校验，而不是按单次读取的长度
+	messageLength := BytesToInt(pending[dataIndex-saveDataLength : dataIndex])
+	if messageLength < 0 || messageLength > d.maxSize {
+		return nil, fmt.Errorf("%w: %d bytes", ErrFrameTooLarge, messageLength)
+	}
+	frameLength := dataIndex + messageLength
+	if frame.Flags&FlagChecksum != 0 {
+		frameLength += checksumLength
+	}
+	if len(pending) < frameLength {
+		return nil, nil
+	}
+	payload := pending[dataIndex : dataIndex+messageLength]
+	if frame.Flags&FlagChecksum != 0 {
+		if binary.BigEndian.Uint32(pending[dataIndex+messageLength:frameLength]) != crc32.ChecksumIEEE(payload) {
+			return nil, ErrChecksum
+		}
+	}
+	if frame.Flags&FlagCompressed != 0 {
+		data, err := decompress(payload, d.maxSize)
+		if err != nil {
+			return nil, err
+		}
+		frame.Payload = data
+	} else {
+		frame.Payload = make([]byte, messageLength)
+		copy(frame.Payload, payload)
+	}
+	d.start += frameLength
+	return frame, nil
+}
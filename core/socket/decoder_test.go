@@ -0,0 +1,201 @@
+package socket
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"testing"
+)
+
+//mustEncode 编码报文，失败时结束测试
+func mustEncode(t *testing.T, frame *Frame) []byte {
+	t.Helper()
+	data, err := EncodeFrame(frame)
+	if err != nil {
+		t.Fatalf("EncodeFrame: %v", err)
+	}
+	return data
+}
+
+//decodeAll 按 chunk 大小分批写入解码器，返回解码出的所有报文与第一个错误
+func decodeAll(d *Decoder, data []byte, chunk int) ([]*Frame, error) {
+	var frames []*Frame
+	for len(data) > 0 {
+		n := chunk
+		if n <= 0 || n > len(data) {
+			n = len(data)
+		}
+		d.Feed(data[:n])
+		data = data[n:]
+		for {
+			frame, err := d.Next()
+			if err != nil {
+				return frames, err
+			}
+			if frame == nil {
+				break
+			}
+			frames = append(frames, frame)
+		}
+	}
+	return frames, nil
+}
+
+func TestDecoderFrames(t *testing.T) {
+	payload := []byte(`{"opType":"cmd.exec","targets":["u1"],"data":"ls"}`)
+	tests := []struct {
+		name  string
+		frame *Frame
+	}{
+		{"v1 data", NewDataFrame(Version1, payload)},
+		{"v1 empty", NewDataFrame(Version1, nil)},
+		{"v2 data", NewDataFrame(Version2, payload)},
+		{"v2 ping", &Frame{Version: Version2, Type: TypePing}},
+		{"v2 checksum", &Frame{Version: Version2, Type: TypeData, Flags: FlagChecksum, Payload: payload}},
+		{"v2 compressed", &Frame{Version: Version2, Type: TypeData, Flags: FlagCompressed, Payload: payload}},
+		{"v2 compressed checksum", &Frame{Version: Version2, Type: TypeData, Flags: FlagCompressed | FlagChecksum, Payload: payload}},
+		{"v2 control", &Frame{Version: Version2, Type: TypeControl, Payload: []byte(ControlClose)}},
+	}
+	for _, tt := range tests {
+		data := mustEncode(t, tt.frame)
+		// 逐字节、按小块与整体写入，结果应一致
+		for _, chunk := range []int{1, 3, 7, len(data)} {
+			frames, err := decodeAll(NewDecoder(maxMessageSize), data, chunk)
+			if err != nil {
+				t.Fatalf("%s chunk %d: unexpected error %v", tt.name, chunk, err)
+			}
+			if len(frames) != 1 {
+				t.Fatalf("%s chunk %d: got %d frames, want 1", tt.name, chunk, len(frames))
+			}
+			got := frames[0]
+			if got.Version != tt.frame.Version || got.Type != tt.frame.Type || got.Flags != tt.frame.Flags {
+				t.Errorf("%s chunk %d: got version %d type %d flags %d", tt.name, chunk, got.Version, got.Type, got.Flags)
+			}
+			if !bytes.Equal(got.Payload, tt.frame.Payload) {
+				t.Errorf("%s chunk %d: payload %q, want %q", tt.name, chunk, got.Payload, tt.frame.Payload)
+			}
+		}
+	}
+}
+
+func TestDecoderMixedStream(t *testing.T) {
+	var stream []byte
+	want := []string{"one", "two", "three", "four"}
+	for i, payload := range want {
+		version := Version1
+		if i%2 == 1 {
+			version = Version2
+		}
+		stream = append(stream, mustEncode(t, NewDataFrame(version, []byte(payload)))...)
+	}
+	d := NewDecoder(maxMessageSize)
+	frames, err := decodeAll(d, stream, 5)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(frames) != len(want) {
+		t.Fatalf("got %d frames, want %d", len(frames), len(want))
+	}
+	for i, frame := range frames {
+		if string(frame.Payload) != want[i] {
+			t.Errorf("frame %d: payload %q, want %q", i, frame.Payload, want[i])
+		}
+	}
+	if d.Buffered() != 0 {
+		t.Errorf("buffered %d bytes after full stream", d.Buffered())
+	}
+}
+
+func TestDecoderErrors(t *testing.T) {
+	const maxSize = 64
+	valid := mustEncode(t, &Frame{Version: Version2, Type: TypeData, Flags: FlagChecksum, Payload: []byte("payload")})
+	badChecksum := append([]byte(nil), valid...)
+	badChecksum[len(badChecksum)-1] ^= 0xff
+	// 声明的长度超出上限，数据未到达时即拒绝
+	oversizedV1 := append([]byte(headerInfo), IntToBytes(maxSize+1)...)
+	oversizedV2 := append([]byte(headerInfo), Version2, 0, TypeData)
+	oversizedV2 = append(oversizedV2, IntToBytes(maxSize+1)...)
+	// 解压后超出上限的压缩炸弹
+	var bomb bytes.Buffer
+	writer := zlib.NewWriter(&bomb)
+	writer.Write(make([]byte, 1<<20))
+	writer.Close()
+	compressedBomb := append([]byte(headerInfo), Version2, FlagCompressed, TypeData)
+	compressedBomb = append(compressedBomb, IntToBytes(bomb.Len())...)
+	compressedBomb = append(compressedBomb, bomb.Bytes()...)
+	notZlib := append([]byte(headerInfo), Version2, FlagCompressed, TypeData)
+	notZlib = append(notZlib, IntToBytes(4)...)
+	notZlib = append(notZlib, "nope"...)
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"bad magic", []byte("GET / HTTP/1.1\r\n"), ErrBadHeader},
+		{"bad magic prefix", []byte("cmx"), ErrBadHeader},
+		{"bad version", append([]byte(headerInfo), 0x07, 0, 0, 0), ErrBadVersion},
+		{"bad type", append([]byte(headerInfo), Version2, 0, 0x09, 0, 0, 0, 0), ErrBadType},
+		{"encrypted flag", append([]byte(headerInfo), Version2, FlagEncrypted, TypeData, 0, 0, 0, 0), ErrBadFlags},
+		{"unknown flag", append([]byte(headerInfo), Version2, 0x80, TypeData, 0, 0, 0, 0), ErrBadFlags},
+		{"oversized v1", oversizedV1, ErrFrameTooLarge},
+		{"oversized v2", oversizedV2, ErrFrameTooLarge},
+		{"bad checksum", badChecksum, ErrChecksum},
+		{"decompress bomb", compressedBomb, ErrFrameTooLarge},
+	}
+	for _, tt := range tests {
+		for _, chunk := range []int{1, len(tt.data)} {
+			_, err := decodeAll(NewDecoder(maxSize), tt.data, chunk)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("%s chunk %d: got error %v, want %v", tt.name, chunk, err, tt.want)
+			}
+		}
+	}
+	if _, err := decodeAll(NewDecoder(maxSize), notZlib, 0); err == nil {
+		t.Error("not zlib: expected error")
+	}
+}
+
+func TestDecoderIncomplete(t *testing.T) {
+	data := mustEncode(t, &Frame{Version: Version2, Type: TypeData, Flags: FlagChecksum, Payload: []byte("partial")})
+	d := NewDecoder(maxMessageSize)
+	for i := 0; i < len(data)-1; i++ {
+		d.Feed(data[i : i+1])
+		frame, err := d.Next()
+		if err != nil || frame != nil {
+			t.Fatalf("byte %d: got frame %v error %v, want nil, nil", i, frame, err)
+		}
+	}
+	if d.Buffered() != len(data)-1 {
+		t.Errorf("buffered %d, want %d", d.Buffered(), len(data)-1)
+	}
+	d.Feed(data[len(data)-1:])
+	frame, err := d.Next()
+	if err != nil || frame == nil || string(frame.Payload) != "partial" {
+		t.Fatalf("got frame %v error %v", frame, err)
+	}
+}
+
+func TestEncodeFrameErrors(t *testing.T) {
+	if _, err := EncodeFrame(&Frame{Version: Version1, Type: TypePing}); !errors.Is(err, ErrBadType) {
+		t.Errorf("v1 ping: got error %v, want %v", err, ErrBadType)
+	}
+	if _, err := EncodeFrame(&Frame{Version: Version2, Type: TypeData, Flags: FlagEncrypted}); !errors.Is(err, ErrBadFlags) {
+		t.Errorf("encrypted: got error %v, want %v", err, ErrBadFlags)
+	}
+}
+
+//TestDecoderMutations 变异合法报文的每个字节，整体与逐字节解码的结果应一致，完整的模糊测试见 fuzz.go
+func TestDecoderMutations(t *testing.T) {
+	seed := mustEncode(t, &Frame{Version: Version2, Type: TypeData, Flags: FlagChecksum | FlagCompressed, Payload: []byte("seed payload")})
+	for i := range seed {
+		for _, b := range []byte{0x00, 0x01, 0x7f, 0xff} {
+			data := append([]byte(nil), seed...)
+			data[i] = b
+			whole, wholeErr := decodeAll(NewDecoder(maxMessageSize), data, 0)
+			split, splitErr := decodeAll(NewDecoder(maxMessageSize), data, 1)
+			if (wholeErr == nil) != (splitErr == nil) || len(whole) != len(split) {
+				t.Fatalf("byte %d = 0x%02x: whole %d frames %v, split %d frames %v", i, b, len(whole), wholeErr, len(split), splitErr)
+			}
+		}
+	}
+}
@@ -0,0 +1,158 @@
+/*
+ * @Descripttion: socket报文格式
+ * @Author: chenjun
+ * @Date: 2026-10-18 13:02:15
+ */
+
+package socket
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+)
+
+/*
+报文格式
+ * v1：头部信息(6) + 数据长度(4) + 数据
+ * v2：头部信息(6) + 版本(1) + 标志位(1) + 消息类型(1) + 数据长度(4) + 数据 + [CRC32校验(4)]
+ * 数据长度为大端序，v1的数据长度首字节恒为0，以此与v2的版本字节区分
+ * CRC32校验为IEEE多项式，按线路上的数据计算，仅在标志位包含 FlagChecksum 时存在
+*/
+const (
+	//Version1 只有头部信息、数据长度与数据的报文
+	Version1 byte = 0x01
+	//Version2 带版本、标志位、消息类型与可选校验的报文
+	Version2 byte = 0x02
+
+	//FlagCompressed 数据经过zlib压缩
+	FlagCompressed byte = 0x01
+	//FlagEncrypted 数据经过加密，当前未支持
+	FlagEncrypted byte = 0x02
+	//FlagChecksum 数据后附带CRC32校验
+	FlagChecksum byte = 0x04
+
+	//TypeData 业务数据
+	TypeData byte = 0x01
+	//TypeAck 消息确认
+	TypeAck byte = 0x02
+	//TypePing 心跳请求
+	TypePing byte = 0x03
+	//TypePong 心跳响应
+	TypePong byte = 0x04
+	//TypeControl 控制消息
+	TypeControl byte = 0x05
+
+	//ControlClose 控制消息的数据，服务端写出队列中的消息后关闭连接
+	ControlClose = "close"
+
+	// v2 头部信息之后的版本、标志位、消息类型长度
+	v2MetaLength = 3
+	// 校验长度
+	checksumLength = 4
+	// 已知的标志位
+	knownFlags = FlagCompressed | FlagEncrypted | FlagChecksum
+)
+
+var (
+	//ErrBadVersion 不支持的报文版本
+	ErrBadVersion = errors.New("cmdmgt protocol error: unsupported frame version")
+	//ErrBadType 不支持的消息类型
+	ErrBadType = errors.New("cmdmgt protocol error: unsupported message type")
+	//ErrBadFlags 不支持的标志位
+	ErrBadFlags = errors.New("cmdmgt protocol error: unsupported frame flags")
+	//ErrChecksum 校验不一致
+	ErrChecksum = errors.New("cmdmgt protocol error: checksum mismatch")
+)
+
+//Frame 一个报文
+type Frame struct {
+	// 报文版本 Version1/Version2
+	Version byte
+	// 标志位，解码后数据已解压，标志位保持线路上的原值
+	Flags byte
+	// 消息类型
+	Type byte
+	// 数据
+	Payload []byte
+	// 写入后关闭连接
+	closing bool
+}
+
+//NewDataFrame 创建业务数据报文
+func NewDataFrame(version byte, payload []byte) *Frame {
+	return &Frame{Version: version, Type: TypeData, Payload: payload}
+}
+
+//validType 判断是否为已知消息类型
+func validType(messageType byte) bool {
+	return messageType >= TypeData && messageType <= TypeControl
+}
+
+/*
+EncodeFrame 按报文版本编码
+ * @param frame 报文，v1只能编码业务数据
+ * @return: 线路上的数据
+*/
+func EncodeFrame(frame *Frame) ([]byte, error) {
+	if frame.Version == Version1 || frame.Version == 0 {
+		if frame.Type != TypeData || frame.Flags != 0 {
+			return nil, fmt.Errorf("%w: v1 frame carries data only", ErrBadType)
+		}
+		return append(append([]byte(headerInfo), IntToBytes(len(frame.Payload))...), frame.Payload...), nil
+	}
+	if frame.Version != Version2 {
+		return nil, ErrBadVersion
+	}
+	if !validType(frame.Type) {
+		return nil, ErrBadType
+	}
+	if frame.Flags&^knownFlags != 0 || frame.Flags&FlagEncrypted != 0 {
+		return nil, ErrBadFlags
+	}
+	payload := frame.Payload
+	if frame.Flags&FlagCompressed != 0 {
+		var compressed bytes.Buffer
+		writer := zlib.NewWriter(&compressed)
+		if _, err := writer.Write(payload); err != nil {
+			return nil, err
+		}
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+		payload = compressed.Bytes()
+	}
+	data := make([]byte, 0, headerInfoLength+v2MetaLength+saveDataLength+len(payload)+checksumLength)
+	data = append(data, headerInfo...)
+	data = append(data, Version2, frame.Flags, frame.Type)
+	data = append(data, IntToBytes(len(payload))...)
+	data = append(data, payload...)
+	if frame.Flags&FlagChecksum != 0 {
+		checksum := make([]byte, checksumLength)
+		binary.BigEndian.PutUint32(checksum, crc32.ChecksumIEEE(payload))
+		data = append(data, checksum...)
+	}
+	return data, nil
+}
+
+//decompress 解压数据，解压后的长度同样受 maxSize 限制
+func decompress(payload []byte, maxSize int) ([]byte, error) {
+	reader, err := zlib.NewReader(bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("cmdmgt protocol error: %w", err)
+	}
+	defer reader.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(reader, int64(maxSize)+1))
+	if err != nil {
+		return nil, fmt.Errorf("cmdmgt protocol error: %w", err)
+	}
+	if len(data) > maxSize {
+		return nil, fmt.Errorf("%w: decompressed over %d bytes", ErrFrameTooLarge, maxSize)
+	}
+	return data, nil
+}
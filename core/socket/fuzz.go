@@ -0,0 +1,74 @@
+// +build gofuzz
+
+/*
+ * @Descripttion: 解码器的模糊测试入口，使用 go-fuzz 运行：
+ * go-fuzz-build ./core/socket && go-fuzz -bin socket-fuzz.zip -workdir fuzz
+ * @Author: chenjun
+ * @Date: 2026-10-20 10:12:08
+ */
+
+package socket
+
+import "bytes"
+
+// 模糊测试的数据长度上限，较小的上限更容易覆盖超长分支
+const fuzzMaxSize = 4096
+
+/*
+Fuzz 按不同的分块方式解码同一段数据，结果必须一致；解码出的报文重新编码后必须解码为相同的报文
+ * @param data 模糊测试生成的数据
+ * @return: 解码出报文时返回1，提高该输入的优先级
+*/
+func Fuzz(data []byte) int {
+	whole, wholeErr := fuzzDecode(data, len(data))
+	split, splitErr := fuzzDecode(data, 1)
+	if (wholeErr == nil) != (splitErr == nil) || len(whole) != len(split) {
+		panic("decoder result depends on how the stream is split")
+	}
+	for i, frame := range whole {
+		if frame.Type != split[i].Type || !bytes.Equal(frame.Payload, split[i].Payload) {
+			panic("decoder result depends on how the stream is split")
+		}
+		if len(frame.Payload) > fuzzMaxSize {
+			panic("decoded payload exceeds max size")
+		}
+		// 压缩后的长度可能超出上限，只校验未压缩的重新编码
+		encoded, err := EncodeFrame(&Frame{Version: frame.Version, Type: frame.Type, Flags: frame.Flags &^ FlagCompressed, Payload: frame.Payload})
+		if err != nil {
+			panic(err)
+		}
+		again, err := fuzzDecode(encoded, len(encoded))
+		if err != nil || len(again) != 1 || !bytes.Equal(again[0].Payload, frame.Payload) {
+			panic("re-encoded frame does not decode to the same payload")
+		}
+	}
+	if len(whole) > 0 {
+		return 1
+	}
+	return 0
+}
+
+//fuzzDecode 按 chunk 大小分批写入解码器，返回解码出的报文与第一个错误
+func fuzzDecode(data []byte, chunk int) ([]*Frame, error) {
+	d := NewDecoder(fuzzMaxSize)
+	var frames []*Frame
+	for len(data) > 0 {
+		n := chunk
+		if n <= 0 || n > len(data) {
+			n = len(data)
+		}
+		d.Feed(data[:n])
+		data = data[n:]
+		for {
+			frame, err := d.Next()
+			if err != nil {
+				return frames, err
+			}
+			if frame == nil {
+				break
+			}
+			frames = append(frames, frame)
+		}
+	}
+	return frames, nil
+}
@@ -0,0 +1,107 @@
+/*
+ * @Descripttion: socket连接登录，启用认证时首个报文必须为登录报文
+ * @Author: chenjun
+ * @Date: 2026-10-18 21:37:26
+ */
+
+package socket
+
+import (
+	"errors"
+	"go-cmd-transfer/core/auth"
+	"go-cmd-transfer/core/hub"
+	"go-cmd-transfer/global"
+	"go-cmd-transfer/utils"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+//实例化工具类
+var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+const (
+	// 认证失败的响应编码
+	unauthorizedCode = "4010"
+	// 默认登录期限
+	defaultLoginTimeout = 10 * time.Second
+	// 最多登录次数，包括未登录时发送的其他报文
+	maxLoginAttempts = 3
+)
+
+//errLoginRequired 未登录时发送了其他报文
+var errLoginRequired = errors.New("unauthenticated: login required")
+
+//loginData 登录报文的数据，令牌与账号密码二选一
+type loginData struct {
+	Token    string `json:"token"`
+	UserID   string `json:"userId"`
+	Password string `json:"password"`
+}
+
+/*
+login 等待连接在期限内发送登录报文，登录成功后注册到连接中心并绑定身份
+ * @param h 连接中心
+ * @param conn 等待登录的连接
+ * @param authenticator 认证器
+ * @param timeout 登录期限，小于等于0时使用默认值
+ * @return: 登录失败、超时或连接关闭时返回 false，调用方关闭连接
+*/
+func login(h *hub.Hub, conn *SConnection, authenticator auth.Authenticator, timeout time.Duration) bool {
+	if timeout <= 0 {
+		timeout = defaultLoginTimeout
+	}
+	// 超过期限未登录时关闭连接，读取报文随之返回错误
+	timer := time.AfterFunc(timeout, func() {
+		conn.log.Warnf("socket连接未在%s内登录，关闭连接，连接标识：%s，连接地址：%s", timeout, conn.sid, conn.addr)
+		conn.Close()
+	})
+	defer timer.Stop()
+	for attempts := 1; attempts <= maxLoginAttempts; attempts++ {
+		data, err := conn.ReadMessage()
+		if err != nil {
+			return false
+		}
+		identity, err := authenticate(authenticator, data)
+		if err != nil {
+			conn.log.Warnf("socket登录失败，连接标识：%s，连接地址：%s，第%d次，错误信息：%s", conn.sid, conn.addr, attempts, err.Error())
+			conn.Send([]byte(utils.FailCodeMessage(unauthorizedCode, err.Error())))
+			continue
+		}
+		conn.Register()
+		h.Bind(conn, identity.UserID, identity.SourceID)
+		// 由连接中心的登录处理函数返回连接信息，令牌与密码不再往下传递
+		h.Receive(conn, withoutCredentials(data))
+		return true
+	}
+	return false
+}
+
+//authenticate 校验登录报文，报文中的用户账号不作为身份，只用于账号密码认证；认证得到的身份没有用户账号时登录失败
+func authenticate(authenticator auth.Authenticator, data []byte) (auth.Identity, error) {
+	request := struct {
+		OpType string    `json:"opType"`
+		Data   loginData `json:"data"`
+	}{}
+	if err := json.Unmarshal(data, &request); err != nil || request.OpType != hub.OpLogin {
+		return auth.Identity{}, errLoginRequired
+	}
+	credentials := request.Data
+	if credentials.Token != "" {
+		return auth.RequireUser(authenticator.Authenticate(credentials.Token))
+	}
+	passwordAuthenticator, ok := authenticator.(auth.PasswordAuthenticator)
+	if !ok {
+		return auth.Identity{}, auth.ErrMissingToken
+	}
+	return auth.RequireUser(passwordAuthenticator.AuthenticatePassword(credentials.UserID, credentials.Password))
+}
+
+//withoutCredentials 去掉登录报文中的令牌与密码，只保留业务数据的其他字段
+func withoutCredentials(data []byte) []byte {
+	busData := global.BusinessData{OpType: hub.OpLogin}
+	json.Unmarshal(data, &busData)
+	busData.Data = nil
+	stripped, _ := json.Marshal(busData)
+	return stripped
+}
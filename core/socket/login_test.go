@@ -0,0 +1,191 @@
+package socket
+
+import (
+	"bytes"
+	"context"
+	"go-cmd-transfer/config"
+	"go-cmd-transfer/core/auth"
+	"go-cmd-transfer/core/hub"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	logger "github.com/sirupsen/logrus"
+)
+
+//syncBuffer 可并发写入的日志输出
+type syncBuffer struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.String()
+}
+
+//loginPeer 通过内存管道连接启用认证的服务端的客户端
+type loginPeer struct {
+	conn net.Conn
+	// 收到的业务数据，连接关闭时关闭
+	frames chan string
+}
+
+//newLoginPeer 创建连接中心并接入一个等待登录的连接，返回客户端与连接中心的日志
+func newLoginPeer(t *testing.T, loginTimeout time.Duration) (*loginPeer, *hub.Hub, *syncBuffer) {
+	t.Helper()
+	output := &syncBuffer{}
+	log := logger.New()
+	log.SetOutput(output)
+	h := hub.New()
+	h.SetLogger(log)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		h.Shutdown(ctx)
+	})
+	authenticator := auth.NewStaticTokens([]config.Token{
+		{Token: "secret-token", UserID: "alice"},
+		{Token: "anonymous-token", SourceID: "kiosk"},
+	})
+	client, server := net.Pipe()
+	t.Cleanup(func() { client.Close() })
+	serverConnHandler(h, server, authenticator, loginTimeout, nil)
+	peer := &loginPeer{conn: client, frames: make(chan string, 16)}
+	go func() {
+		defer close(peer.frames)
+		decoder := NewDecoder(maxMessageSize)
+		buf := make([]byte, 4096)
+		for {
+			cnt, err := client.Read(buf)
+			if err != nil {
+				return
+			}
+			decoder.Feed(buf[:cnt])
+			for {
+				frame, err := decoder.Next()
+				if err != nil || frame == nil {
+					break
+				}
+				if frame.Type == TypeData {
+					peer.frames <- string(frame.Payload)
+				}
+			}
+		}
+	}()
+	return peer, h, output
+}
+
+//send 发送一条v1业务数据
+func (p *loginPeer) send(t *testing.T, payload string) {
+	t.Helper()
+	data, err := EncodeFrame(NewDataFrame(Version1, []byte(payload)))
+	if err != nil {
+		t.Fatalf("EncodeFrame: %v", err)
+	}
+	if _, err := p.conn.Write(data); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+}
+
+//next 等待下一条业务数据，连接已关闭时返回 false
+func (p *loginPeer) next(t *testing.T) (string, bool) {
+	t.Helper()
+	select {
+	case frame, ok := <-p.frames:
+		return frame, ok
+	case <-time.After(2 * time.Second):
+		t.Fatal("no frame received")
+		return "", false
+	}
+}
+
+//expectClosed 等待服务端关闭连接
+func (p *loginPeer) expectClosed(t *testing.T) {
+	t.Helper()
+	for {
+		frame, ok := p.next(t)
+		if !ok {
+			return
+		}
+		if !strings.Contains(frame, `"code":"4010"`) {
+			t.Fatalf("got %s, want the connection to be closed", frame)
+		}
+	}
+}
+
+func TestLoginSucceeds(t *testing.T) {
+	peer, h, output := newLoginPeer(t, time.Second)
+	peer.send(t, `{"opType":"login","data":{"token":"secret-token","userId":"mallory","password":"hunter2"}}`)
+	frame, _ := peer.next(t)
+	if !strings.Contains(frame, `"message":"login"`) || !strings.Contains(frame, `"userId":"alice"`) {
+		t.Fatalf("got %s, want the login result for alice", frame)
+	}
+	if h.Count(hub.ProtocolSocket) != 1 {
+		t.Errorf("got %d registered connections, want 1", h.Count(hub.ProtocolSocket))
+	}
+	// 令牌与密码不出现在日志中
+	for _, secret := range []string{"secret-token", "hunter2"} {
+		if strings.Contains(output.String(), secret) {
+			t.Errorf("log contains %q", secret)
+		}
+	}
+}
+
+func TestLoginRejectsBadCredentials(t *testing.T) {
+	peer, h, _ := newLoginPeer(t, time.Second)
+	peer.send(t, `{"opType":"login","data":{"token":"wrong"}}`)
+	if frame, _ := peer.next(t); !strings.Contains(frame, `"code":"4010"`) {
+		t.Fatalf("got %s, want code 4010", frame)
+	}
+	// 未登录前不注册，可以重试
+	if h.Count(hub.ProtocolSocket) != 0 {
+		t.Errorf("got %d registered connections before login, want 0", h.Count(hub.ProtocolSocket))
+	}
+	peer.send(t, `{"opType":"login","data":{"token":"secret-token"}}`)
+	if frame, _ := peer.next(t); !strings.Contains(frame, `"userId":"alice"`) {
+		t.Fatalf("got %s, want the login result for alice", frame)
+	}
+}
+
+func TestLoginAttemptsExhausted(t *testing.T) {
+	peer, _, _ := newLoginPeer(t, time.Second)
+	for i := 1; i < maxLoginAttempts; i++ {
+		peer.send(t, `{"opType":"cmd.exec","userId":"alice","data":"ls"}`)
+		if frame, _ := peer.next(t); !strings.Contains(frame, `"code":"4010"`) {
+			t.Fatalf("attempt %d: got %s, want code 4010", i, frame)
+		}
+	}
+	// 最后一次失败后关闭连接，失败消息可能来不及写出
+	peer.send(t, `{"opType":"login","data":{"token":"wrong"}}`)
+	peer.expectClosed(t)
+}
+
+func TestLoginTimeout(t *testing.T) {
+	peer, _, _ := newLoginPeer(t, 50*time.Millisecond)
+	start := time.Now()
+	peer.expectClosed(t)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("closed after %s, want about 50ms", elapsed)
+	}
+}
+
+func TestLoginRejectsIdentityWithoutUserID(t *testing.T) {
+	peer, h, _ := newLoginPeer(t, time.Second)
+	peer.send(t, `{"opType":"login","data":{"token":"anonymous-token"}}`)
+	if frame, _ := peer.next(t); !strings.Contains(frame, `"code":"4010"`) || !strings.Contains(frame, auth.ErrMissingUserID.Error()) {
+		t.Fatalf("got %s, want code 4010", frame)
+	}
+	if h.Count(hub.ProtocolSocket) != 0 {
+		t.Errorf("got %d registered connections, want 0", h.Count(hub.ProtocolSocket))
+	}
+}
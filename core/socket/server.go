@@ -7,31 +7,34 @@
 package socket
 
 import (
-	"go-cmd-transfer/global"
+	"context"
+	"crypto/tls"
+	"go-cmd-transfer/core/auth"
+	"go-cmd-transfer/core/certificate"
+	"go-cmd-transfer/core/hub"
 	"go-cmd-transfer/utils"
 	"net"
-
-	jsoniter "github.com/json-iterator/go"
-	logger "github.com/sirupsen/logrus"
+	"time"
 )
 
-//SocketConnAll 保存在线用户 cliAddr ===> Connection
-var SocketConnAll map[string]*SConnection
-
-//实例化工具类
-var json = jsoniter.ConfigCompatibleWithStandardLibrary
+// TLS握手期限
+const handshakeTimeout = 10 * time.Second
 
-//connHandler 处理用户连接
-func serverConnHandler(conn net.Conn) {
+//serverConnHandler 处理用户连接，客户端证书中有身份时以证书为准；否则启用认证时连接登录后才注册到连接中心，未启用认证时直接注册并按报文中的身份绑定；启用客户端证书认证、证书中没有身份且未启用认证时拒绝连接
+func serverConnHandler(h *hub.Hub, conn net.Conn, authenticator auth.Authenticator, loginTimeout time.Duration, clientAuth *certificate.ClientAuth) {
+	log := h.Logger()
 	//conn是否有效
 	if conn == nil {
-		logger.Error("无效的 socket 连接")
+		log.Error("无效的 socket 连接")
 		return
 	}
 
 	var (
 		socketConn *SConnection
 		data       []byte
+		state      tls.ConnectionState
+		identity   auth.Identity
+		certified  bool
 		err        error
 	)
 
@@ -39,84 +42,82 @@ func serverConnHandler(conn net.Conn) {
 	connID := utils.Get49UUID()
 	// 获取客户端的网络地址
 	cliAddr := conn.RemoteAddr().String()
-	socketConn, err = InitConnection(conn, connID, cliAddr)
-	if err != nil {
-		logger.Error("初始化socket失败", err.Error())
-		// 关闭当前连接
-		socketConn.Close()
-		return
+	// 启用客户端证书认证时先完成握手，按证书得到身份
+	if tlsConn, ok := conn.(*tls.Conn); ok && clientAuth != nil {
+		tlsConn.SetDeadline(time.Now().Add(handshakeTimeout))
+		if err = tlsConn.Handshake(); err != nil {
+			log.Warnf("socket TLS握手失败，连接地址：%s，错误信息：%s", cliAddr, err.Error())
+			conn.Close()
+			return
+		}
+		tlsConn.SetDeadline(time.Time{})
+		state = tlsConn.ConnectionState()
+		identity, certified = clientAuth.Identity(state)
+		// 启用客户端证书认证时，连接的身份只能来自证书或登录，不接受报文中的身份
+		if !certified && authenticator == nil {
+			log.Warnf("socket连接未提供包含身份的客户端证书且未启用认证，拒绝连接，连接地址：%s", cliAddr)
+			conn.Close()
+			return
+		}
+	}
+	// 初始化不会失败
+	if authenticator != nil && !certified {
+		socketConn, _ = InitPendingConnection(h, conn, connID, cliAddr)
+	} else {
+		socketConn, _ = InitConnection(h, conn, connID, cliAddr)
 	}
-	// 存储连接信息，连接数保持一定数量，超过的部分不提供服务
-	if socketConn != nil {
-		SocketConnAll[connID] = socketConn
+	// 吊销列表重新加载后证书已吊销时关闭连接
+	if clientAuth != nil {
+		untrack := clientAuth.Track(state, cliAddr, socketConn.Close)
+		go func() {
+			<-socketConn.closeChan
+			untrack()
+		}()
+	}
+	// 证书中的身份优先于报文中的身份，客户端无法冒用
+	if certified {
+		log.Infof("socket客户端证书认证通过，连接地址：%s，用户账号：%s，接入端标识：%s", cliAddr, identity.UserID, identity.SourceID)
+		h.Bind(socketConn, identity.UserID, identity.SourceID)
 	}
-	logger.Infof("socket当前在线连接数:%d", len(SocketConnAll))
 
 	go func() {
+		if authenticator != nil && !certified && !login(h, socketConn, authenticator, loginTimeout) {
+			socketConn.Close()
+			return
+		}
 		for {
 			if data, err = socketConn.ReadMessage(); err != nil {
-				logger.Error("读取socket消息失败", err.Error())
+				log.Error("读取socket消息失败", err.Error())
 				// 关闭当前连接
 				socketConn.Close()
 				return
 			}
-			if json.Valid(data) == false {
-				logger.Warn("读取socket消息时，该消息不是一个json字符串，不做处理")
-			} else {
-				busData := global.BusinessData{}
-				if err := json.Unmarshal(data, &busData); err != nil {
-					logger.Error("读取socket消息时，该消息是一个json字符串，进行解析格式化，解析错误", err.Error())
-					continue
-				}
-				if busData.Protocol == "socket" {
-					global.SocketBusDataAllInfo[busData.UserID] = busData
-				} else if busData.Protocol == "websocket" {
-					global.WebSocketBusDataAllInfo[busData.UserID] = busData
-				}
-			}
-		}
-	}()
-
-	//启动协程循环写入
-	go func() {
-		for {
-			if len(global.SocketBusDataAllInfo) > 0 {
-				tempData, err := json.Marshal(global.SocketBusDataAllInfo)
-				if err != nil {
-					logger.Error("发送socket消息时，将待转发的消息转换为json字符串错误", err.Error())
-					continue
-				}
-				//发送给所有在线的客户端
-				for _, client := range SocketConnAll {
-					if err = client.WriteMessage(tempData); err != nil {
-						logger.Error("发送socket消息失败", err.Error())
-						// 关闭当前连接
-						socketConn.Close()
-						return
-					}
-				}
-				global.SocketBusDataAllInfo = make(map[string]global.BusinessData)
-			}
-
+			// 解析并投递到 socket 或 websocket 连接
+			h.Receive(socketConn, data)
 		}
 	}()
 }
 
-//ServerSocket 开启服务
-func ServerSocket(addrPort string) {
-	SocketConnAll = make(map[string]*SConnection)
-	logger.Info("正在开启 Socket Server ...")
-	// 监听127.0.0.1:端口
-	uri := "0.0.0.0:" + addrPort
-	listener, err := net.Listen("tcp", uri)
-	if err != nil {
-		logger.Warn("启动Socket服务出错", err.Error())
-		return
-	}
-
-	logger.Info("开启 Socket Server成功")
+/*
+Serve 在监听器上接受socket连接，阻塞直到 ctx 取消或监听器出错
+ * @param ctx 取消时关闭监听器，已建立的连接由连接中心关闭
+ * @param listener 监听器，启用TLS时应为 tls.NewListener 包装后的监听器
+ * @param h 连接中心
+ * @param authenticator 认证器，为空时不认证
+ * @param loginTimeout 启用认证时连接的登录期限
+ * @param clientAuth 客户端证书认证，为空时不按证书得到身份
+ * @return: ctx 取消时返回 nil，否则返回监听器的错误
+*/
+func Serve(ctx context.Context, listener net.Listener, h *hub.Hub, authenticator auth.Authenticator, loginTimeout time.Duration, clientAuth *certificate.ClientAuth) error {
+	log := h.Logger()
+	log.Infof("开启 Socket Server成功，监听地址：%s", listener.Addr())
 
 	defer listener.Close()
+	// 取消时关闭监听，阻塞的 Accept 随即返回错误
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
 
 	// 主协程，循环阻塞等待用户连接  ,接收多个用户的请求
 	for {
@@ -124,14 +125,21 @@ func ServerSocket(addrPort string) {
 		conn, err := listener.Accept()
 
 		if err != nil {
-			logger.Warn("连接Socket出错", err.Error())
-			// 关闭当前用户链接
-			//conn.Close()
-			continue
+			if ctx.Err() != nil {
+				log.Info("Socket Server 已停止监听")
+				return nil
+			}
+			// 临时错误（例如文件描述符耗尽）时继续接受，其他错误说明监听器已不可用
+			if netErr, ok := err.(net.Error); ok && netErr.Temporary() {
+				log.Warn("连接Socket出错", err.Error())
+				continue
+			}
+			log.Error("Socket监听出错", err.Error())
+			return err
 		}
 
 		//处理用户连接 并发模式 新建一个协程,接收来自客户端的连接请求，一个连接 建立一个 conn，服务器资源有可能耗尽 BIO模式
-		go serverConnHandler(conn)
+		go serverConnHandler(h, conn, authenticator, loginTimeout, clientAuth)
 	}
 
 }
@@ -0,0 +1,142 @@
+/*
+ * @Descripttion: websocket客户端，适用于只开放HTTP端口的网络环境
+ * @Author: chenjun
+ * @Date: 2026-10-19 16:05:52
+ */
+
+package websocket
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"go-cmd-transfer/core/client"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// 客户端写入期限
+const clientWriteWait = 10 * time.Second
+
+/*
+Dial 连接websocket服务端，断开后自动重连
+ * @param ctx 首次连接的期限
+ * @param url 服务端地址，例如 ws://127.0.0.1:7777/ws、wss://example.com/ws
+ * @param tlsConfig wss的TLS配置，为空时使用默认配置
+ * @param opts 客户端配置项，client.WithToken 的令牌在握手时以 Authorization: Bearer 请求头携带
+ * @return: 首次连接或登录失败时返回错误，认证失败时错误中包含响应状态
+*/
+func Dial(ctx context.Context, url string, tlsConfig *tls.Config, opts ...client.Option) (*client.Client, error) {
+	return client.Dial(ctx, NewClientTransport(url, tlsConfig), opts...)
+}
+
+//clientTransport websocket客户端传输层
+type clientTransport struct {
+	// 服务端地址
+	url string
+	// 拨号器
+	dialer *websocket.Dialer
+}
+
+//NewClientTransport 创建websocket客户端传输层
+func NewClientTransport(url string, tlsConfig *tls.Config) client.Transport {
+	return &clientTransport{
+		url: url,
+		dialer: &websocket.Dialer{
+			Proxy:            http.ProxyFromEnvironment,
+			HandshakeTimeout: 45 * time.Second,
+			TLSClientConfig:  tlsConfig,
+		},
+	}
+}
+
+//Dial 完成websocket握手，令牌不为空时以 Authorization: Bearer 请求头携带
+func (t *clientTransport) Dial(ctx context.Context, token string) (client.Conn, error) {
+	header := http.Header{}
+	if token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+	wsConn, resp, err := t.dialer.DialContext(ctx, t.url, header)
+	if err != nil {
+		if resp != nil {
+			return nil, fmt.Errorf("%w: %s", err, resp.Status)
+		}
+		return nil, err
+	}
+	conn := &clientConn{wsConn: wsConn, authenticated: token != ""}
+	// 收到心跳请求与心跳响应时延长读取期限
+	wsConn.SetPingHandler(func(data string) error {
+		conn.extend()
+		err := wsConn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(clientWriteWait))
+		if err == websocket.ErrCloseSent {
+			return nil
+		}
+		return err
+	})
+	wsConn.SetPongHandler(func(string) error {
+		conn.extend()
+		return nil
+	})
+	return conn, nil
+}
+
+//clientConn websocket客户端连接
+type clientConn struct {
+	// websocket连接
+	wsConn *websocket.Conn
+	// 读取期限的延长时长，只在读协程中使用
+	timeout time.Duration
+	// 写入锁，websocket连接只允许一个协程写入数据消息
+	writeMutex sync.Mutex
+	// 握手时是否已携带令牌
+	authenticated bool
+}
+
+//Authenticated 握手时已携带令牌，登录报文不再重复携带
+func (c *clientConn) Authenticated() bool {
+	return c.authenticated
+}
+
+//Read 读取一条文本或二进制消息，收到关闭帧 1001 时返回 client.ErrGoingAway
+func (c *clientConn) Read(timeout time.Duration) ([]byte, error) {
+	c.timeout = timeout
+	c.extend()
+	_, data, err := c.wsConn.ReadMessage()
+	if websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		return nil, client.ErrGoingAway
+	}
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+//Write 以文本消息写入
+func (c *clientConn) Write(data []byte) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	c.wsConn.SetWriteDeadline(time.Now().Add(clientWriteWait))
+	return c.wsConn.WriteMessage(websocket.TextMessage, data)
+}
+
+//Ping 发送心跳请求，控制消息可以与数据消息并发写入
+func (c *clientConn) Ping() error {
+	return c.wsConn.WriteControl(websocket.PingMessage, nil, time.Now().Add(clientWriteWait))
+}
+
+//Close 关闭连接
+func (c *clientConn) Close() error {
+	return c.wsConn.Close()
+}
+
+//extend 延长读取期限，为0时不限
+func (c *clientConn) extend() {
+	deadline := time.Time{}
+	if c.timeout > 0 {
+		deadline = time.Now().Add(c.timeout)
+	}
+	c.wsConn.SetReadDeadline(deadline)
+}
@@ -7,8 +7,12 @@
 package websocket
 
 import (
+	"context"
 	"errors"
+	"go-cmd-transfer/core/hub"
+	"go-cmd-transfer/core/metrics"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -25,8 +29,8 @@ const (
 	// Send pings to peer with this period. Must be less than pongWait.
 	pingPeriod = (pongWait * 9) / 10
 
-	// Maximum message size allowed from peer.
-	maxMessageSize = 512
+	//DefaultMaxMessageSize 默认的消息长度上限，与socket的报文长度上限一致
+	DefaultMaxMessageSize = 10240
 )
 
 //Message 读写消息
@@ -38,6 +42,10 @@ type Message struct {
 
 //WsConnection 连接信息
 type WsConnection struct {
+	// 读取的字节数，原子操作的64位字段放在结构体开头以保证对齐
+	bytesIn uint64
+	// 写入的字节数
+	bytesOut uint64
 	// 存放websocket连接
 	wsConn *websocket.Conn
 	// 用于存放数据 读队列
@@ -54,22 +62,41 @@ type WsConnection struct {
 	wsID string
 	// 网络地址
 	addr string
+	// 绑定的用户账号
+	userID string
+	// 绑定的接入端标识
+	sourceID string
+	// 所属连接中心
+	hub *hub.Hub
+	// 日志，取自连接中心
+	log logger.FieldLogger
+	// 连接时间
+	connectedAt time.Time
+	// 消息长度上限
+	maxMessageSize int64
 }
 
-//InitConnection 初始化长连接
-func InitConnection(wsConn *websocket.Conn, connID string, connAddr string) (conn *WsConnection, err error) {
+//InitConnection 初始化长连接，消息长度上限小于等于0时使用默认值
+func InitConnection(h *hub.Hub, wsConn *websocket.Conn, connID string, connAddr string, maxMessageSize int64) (conn *WsConnection, err error) {
+	if maxMessageSize <= 0 {
+		maxMessageSize = DefaultMaxMessageSize
+	}
 	conn = &WsConnection{
-		wsConn:    wsConn,
-		inChan:    make(chan *Message, 4096),
-		outChan:   make(chan *Message, 4096),
-		closeChan: make(chan byte, 1),
-		isClosed:  false,
-		wsID:      connID,
-		addr:      connAddr,
+		wsConn:         wsConn,
+		maxMessageSize: maxMessageSize,
+		inChan:         make(chan *Message, 4096),
+		outChan:        make(chan *Message, 4096),
+		closeChan:      make(chan byte, 1),
+		isClosed:       false,
+		wsID:           connID,
+		addr:           connAddr,
+		hub:            h,
+		log:            h.Logger(),
+		connectedAt:    time.Now(),
 	}
+	// 先注册到连接中心再启动读写协程，保证连接关闭时一定能注销
+	h.Register(conn)
 
-	// 处理器,发送定时信息，避免意外关闭
-	go conn.processLoop()
 	// 读协程
 	go conn.readLoop()
 	// 写协程
@@ -79,17 +106,17 @@ func InitConnection(wsConn *websocket.Conn, connID string, connAddr string) (con
 
 //ReadMessage 读取消息队列中的消息
 func (conn *WsConnection) ReadMessage() (msg *Message, err error) {
-	logger.Infof("websocket读取消息，连接标识：%s，连接地址：%s", conn.wsID, conn.addr)
+	conn.log.Infof("websocket读取消息，连接标识：%s，连接地址：%s", conn.wsID, conn.addr)
 	//select是Go中的一个控制结构，类似于用于通信的switch语句。
 	//每个case必须是一个通信操作，要么是发送要么是接收。
 	//select随机执行一个可运行的case。如果没有case可运行，它将阻塞，直到有case可运行。一个默认的子句应该总是可运行的。
 	select {
 	// 从Channel中接收数据，并将数据赋值给msg
 	case msg = <-conn.inChan:
-		logger.Infof("websocket读取消息时，连接标识：%s，连接地址：%s，数据信息(消息类型为：%d,消息数据为：%s)", conn.wsID, conn.addr, msg.messageType, string(msg.data))
+		conn.log.Infof("websocket读取消息时，连接标识：%s，连接地址：%s，消息类型：%d，数据长度：%d", conn.wsID, conn.addr, msg.messageType, len(msg.data))
 	case <-conn.closeChan:
 		err = errors.New("connection is closed")
-		logger.Errorf("websocket读取消息时，连接标识：%s，连接地址：%s，连接被关闭，错误信息：%s", conn.wsID, conn.addr, err.Error())
+		conn.log.Errorf("websocket读取消息时，连接标识：%s，连接地址：%s，连接被关闭，错误信息：%s", conn.wsID, conn.addr, err.Error())
 	}
 	//如果return后面没有指定返回值，就用赋给“返回值变量”的值
 	return
@@ -97,76 +124,151 @@ func (conn *WsConnection) ReadMessage() (msg *Message, err error) {
 
 //WriteMessage 发送消息到队列中
 func (conn *WsConnection) WriteMessage(messageType int, data []byte) (err error) {
-	logger.Infof("websocket发送消息，连接标识：%s，连接地址：%s", conn.wsID, conn.addr)
+	conn.log.Infof("websocket发送消息，连接标识：%s，连接地址：%s", conn.wsID, conn.addr)
 	msg := &Message{messageType, data}
+	conn.observeOut()
 	select {
 	// 发送值data到Channel中
 	case conn.outChan <- msg:
-		logger.Infof("websocket发送消息时，连接标识：%s，连接地址：%s，数据信息(消息类型为：%d,消息数据为：%s)", conn.wsID, conn.addr, msg.messageType, string(msg.data))
+		conn.log.Infof("websocket发送消息时，连接标识：%s，连接地址：%s，数据信息(消息类型为：%d,消息数据为：%s)", conn.wsID, conn.addr, msg.messageType, string(msg.data))
 	case <-conn.closeChan:
 		err = errors.New("connection is closed")
-		logger.Errorf("websocket发送消息时，连接标识：%s，连接地址：%s，连接被关闭，错误信息：%s", conn.wsID, conn.addr, err.Error())
+		conn.log.Errorf("websocket发送消息时，连接标识：%s，连接地址：%s，连接被关闭，错误信息：%s", conn.wsID, conn.addr, err.Error())
 	}
 	//当return后面为空是，函数声明时的 (err error) 会把 err 作为返回值，当 return 不为空时，会把 return 后面的值作为返回值
 	return
 }
 
+//ID 连接标识
+func (conn *WsConnection) ID() string {
+	return conn.wsID
+}
+
+//Protocol 连接所属协议
+func (conn *WsConnection) Protocol() string {
+	return hub.ProtocolWebsocket
+}
+
+//Addr 网络地址
+func (conn *WsConnection) Addr() string {
+	return conn.addr
+}
+
+//ConnectedAt 连接时间
+func (conn *WsConnection) ConnectedAt() time.Time {
+	return conn.connectedAt
+}
+
+//Stats 读取与写入的字节数，按消息数据计算，不含websocket帧头
+func (conn *WsConnection) Stats() (bytesIn uint64, bytesOut uint64) {
+	return atomic.LoadUint64(&conn.bytesIn), atomic.LoadUint64(&conn.bytesOut)
+}
+
+//countIn 记录读取的字节数
+func (conn *WsConnection) countIn(cnt int) {
+	atomic.AddUint64(&conn.bytesIn, uint64(cnt))
+	metrics.BytesIn.WithLabelValues(hub.ProtocolWebsocket).Add(float64(cnt))
+}
+
+//countOut 记录写入的字节数
+func (conn *WsConnection) countOut(cnt int) {
+	atomic.AddUint64(&conn.bytesOut, uint64(cnt))
+	metrics.BytesOut.WithLabelValues(hub.ProtocolWebsocket).Add(float64(cnt))
+}
+
+//observeOut 记录入队时写队列的长度
+func (conn *WsConnection) observeOut() {
+	metrics.QueueDepth.WithLabelValues(hub.ProtocolWebsocket, metrics.QueueOut).Observe(float64(len(conn.outChan)))
+}
+
+//Send 以文本消息发送数据到写队列，实现 hub.Conn，写队列已满时不阻塞直接返回错误
+func (conn *WsConnection) Send(data []byte) (err error) {
+	conn.observeOut()
+	select {
+	case conn.outChan <- &Message{websocket.TextMessage, data}:
+	case <-conn.closeChan:
+		err = errors.New("connection is closed")
+	default:
+		err = errors.New("send queue is full")
+	}
+	return
+}
+
+//Drain 发送关闭帧（1001 Going Away），写出写队列中的消息后关闭连接，ctx 期限到达时直接关闭
+func (conn *WsConnection) Drain(ctx context.Context) {
+	msg := &Message{websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")}
+	// 关闭帧排在写队列末尾，写协程写出后关闭连接
+	select {
+	case conn.outChan <- msg:
+		select {
+		case <-conn.closeChan:
+		case <-ctx.Done():
+			conn.log.Warnf("websocket写出写队列超时，连接标识：%s，连接地址：%s，未写出的消息数：%d", conn.wsID, conn.addr, len(conn.outChan))
+		}
+	case <-conn.closeChan:
+	case <-ctx.Done():
+	}
+	conn.Close()
+}
+
+//Bind 绑定连接身份，只绑定一次，绑定后该连接只能以此身份收发消息
+func (conn *WsConnection) Bind(userID string, sourceID string) {
+	conn.mutex.Lock()
+	if conn.userID == "" && conn.sourceID == "" {
+		conn.userID = userID
+		conn.sourceID = sourceID
+		conn.log.Infof("websocket连接绑定身份，连接标识：%s，连接地址：%s，用户账号：%s，接入端标识：%s", conn.wsID, conn.addr, userID, sourceID)
+	}
+	conn.mutex.Unlock()
+}
+
+//Identity 获取连接绑定的身份
+func (conn *WsConnection) Identity() (userID string, sourceID string) {
+	conn.mutex.Lock()
+	userID, sourceID = conn.userID, conn.sourceID
+	conn.mutex.Unlock()
+	return
+}
+
 //Close 关闭连接
 func (conn *WsConnection) Close() {
-	logger.Infof("websocket关闭连接，连接标识：%s，连接地址：%s", conn.wsID, conn.addr)
+	conn.log.Infof("websocket关闭连接，连接标识：%s，连接地址：%s", conn.wsID, conn.addr)
 	// 线程安全的Close，可以并发多次调用也叫做可重入的Close
 	conn.wsConn.Close()
 	// 利用标记，让closeChan只关闭一次
 	conn.mutex.Lock()
-	logger.Infof("websocket关闭连接，连接标识：%s，连接地址：%s，当前连接是否关闭状态为：%t", conn.wsID, conn.addr, conn.isClosed)
+	conn.log.Infof("websocket关闭连接，连接标识：%s，连接地址：%s，当前连接是否关闭状态为：%t", conn.wsID, conn.addr, conn.isClosed)
 	if conn.isClosed == false {
 		// 关闭chan,但是chan只能关闭一次
 		close(conn.closeChan)
-		// 删除这个连接的变量
-		delete(WebsocketConnAll, conn.wsID)
 		conn.isClosed = true
 	}
 	//释放锁
 	conn.mutex.Unlock()
-}
-
-// 处理器,发送定时信息，避免意外关闭  内部实现
-func (conn *WsConnection) processLoop() {
-	// 获取到消息队列中的消息，处理完成后，发送消息给客户端
-	for {
-		msg, err := conn.ReadMessage()
-		if err != nil {
-			logger.Error("websocket获取消息出现错误", err.Error())
-			break
-		}
-		logger.Info("websocket接收到消息", string(msg.data))
-		// 修改以下内容把客户端传递的消息传递给处理程序
-		err = conn.WriteMessage(msg.messageType, msg.data)
-		if err != nil {
-			logger.Error("websocket发送消息给客户端出现错误", err.Error())
-			break
-		}
-	}
+	// 从连接中心注销这个连接
+	conn.hub.Unregister(conn)
 }
 
 //读取消息队列中的消息 内部实现
 func (conn *WsConnection) readLoop() {
 	// 设置消息的最大长度
-	conn.wsConn.SetReadLimit(maxMessageSize)
+	conn.wsConn.SetReadLimit(conn.maxMessageSize)
 	conn.wsConn.SetReadDeadline(time.Now().Add(pongWait))
 	for {
 		// 读一个message
 		msgType, data, err := conn.wsConn.ReadMessage()
 		if err != nil {
 			websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure)
-			logger.Errorf("websocket消息读取出现错误，连接标识：%s，连接地址：%s，错误信息为：%s", conn.wsID, conn.addr, err.Error())
+			conn.log.Errorf("websocket消息读取出现错误，连接标识：%s，连接地址：%s，错误信息为：%s", conn.wsID, conn.addr, err.Error())
 			goto ERR
 		}
+		conn.countIn(len(data))
 		req := &Message{
 			msgType,
 			data,
 		}
 		// 放入请求队列,消息入栈 容易阻塞到这里，等待inChan有空闲的位置
+		metrics.QueueDepth.WithLabelValues(hub.ProtocolWebsocket, metrics.QueueIn).Observe(float64(len(conn.inChan)))
 		select {
 		case conn.inChan <- req:
 		case <-conn.closeChan:
@@ -191,19 +293,26 @@ func (conn *WsConnection) writeLoop() {
 		case msg := <-conn.outChan:
 			err := conn.wsConn.WriteMessage(msg.messageType, msg.data)
 			if err != nil {
-				logger.Errorf("websocket消息写入出现错误，连接标识：%s，连接地址：%s，错误信息为：%s", conn.wsID, conn.addr, err.Error())
+				metrics.WriteErrors.WithLabelValues(hub.ProtocolWebsocket).Inc()
+				conn.log.Errorf("websocket消息写入出现错误，连接标识：%s，连接地址：%s，错误信息为：%s", conn.wsID, conn.addr, err.Error())
 				// 切断服务
 				goto ERR
 			}
+			conn.countOut(len(msg.data))
+			// 关闭帧已写出，之前入队的消息都已写出
+			if msg.messageType == websocket.CloseMessage {
+				goto ERR
+			}
 		case <-conn.closeChan:
 			// 获取到关闭通知
 			goto ERR
 		case <-ticker.C:
 			// 出现超时情况
 			conn.wsConn.SetWriteDeadline(time.Now().Add(writeWait))
-			logger.Errorf("websocket消息写入出现超时情况，连接标识：%s，连接地址：%s", conn.wsID, conn.addr)
+			conn.log.Errorf("websocket消息写入出现超时情况，连接标识：%s，连接地址：%s", conn.wsID, conn.addr)
 			if err := conn.wsConn.WriteMessage(websocket.PingMessage, nil); err != nil {
-				logger.Errorf("websocket消息写入出现超时情况，连接标识：%s，连接地址：%s，错误信息为：%s", conn.wsID, conn.addr, err.Error())
+				metrics.WriteErrors.WithLabelValues(hub.ProtocolWebsocket).Inc()
+				conn.log.Errorf("websocket消息写入出现超时情况，连接标识：%s，连接地址：%s，错误信息为：%s", conn.wsID, conn.addr, err.Error())
 				goto ERR
 			}
 		}
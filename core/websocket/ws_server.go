@@ -7,160 +7,114 @@
 package websocket
 
 import (
-	"encoding/json"
 	"net/http"
-	"time"
 
-	"go-cmd-transfer/global"
+	"go-cmd-transfer/core/auth"
+	"go-cmd-transfer/core/hub"
 	"go-cmd-transfer/utils"
 
 	"github.com/gorilla/websocket"
 	logger "github.com/sirupsen/logrus"
 )
 
-//WebsocketConnAll ws的所有连接 用于广播
-var WebsocketConnAll map[string]*WsConnection
+const (
+	// 认证失败的响应编码
+	unauthorizedCode = "4010"
+)
 
-var (
-	upgrader = websocket.Upgrader{
+//newUpgrader 创建协议升级器，allowedOrigins 为空时允许跨域
+func newUpgrader(log logger.FieldLogger, allowedOrigins []string) *websocket.Upgrader {
+	return &websocket.Upgrader{
 		// 读取存储空间大小
 		ReadBufferSize: 4096,
 		// 写入存储空间大小
 		WriteBufferSize: 1024,
-		// 允许跨域
+		// 按来源限制跨域，非浏览器客户端不带来源时允许
 		CheckOrigin: func(r *http.Request) bool {
-			/*if r.Method != "GET" {
-				logger.Warn("request method is not GET")
-				return false
+			origin := r.Header.Get("Origin")
+			if len(allowedOrigins) == 0 || origin == "" {
+				return true
+			}
+			for _, allowed := range allowedOrigins {
+				if allowed == "*" || allowed == origin {
+					return true
+				}
 			}
-			if r.URL.Path != "/ws" {
-				logger.Warn("websocket connect path error")
-				return false
-			}*/
-			return true
+			log.Warnf("websocket来源不允许：%s", origin)
+			return false
 		},
 	}
-)
+}
 
-func wsHandler(resp http.ResponseWriter, req *http.Request) {
+func wsHandler(h *hub.Hub, upgrader *websocket.Upgrader, authenticator auth.Authenticator, maxMessageSize int64, resp http.ResponseWriter, req *http.Request) {
 	var (
-		wsConn *websocket.Conn
-		conn   *WsConnection
-		msg    *Message
-		err    error
+		wsConn   *websocket.Conn
+		conn     *WsConnection
+		msg      *Message
+		identity auth.Identity
+		err      error
 	)
+	log := h.Logger()
+	// 启用认证时在协议升级前校验令牌，认证失败返回401
+	if authenticator != nil {
+		if identity, err = auth.RequireUser(authenticator.Authenticate(auth.TokenFrom(req))); err != nil {
+			log.Warnf("websocket认证失败，连接地址：%s，错误信息：%s", req.RemoteAddr, err.Error())
+			resp.Header().Set("Content-Type", "application/json; charset=utf-8")
+			resp.WriteHeader(http.StatusUnauthorized)
+			resp.Write([]byte(utils.FailCodeMessage(unauthorizedCode, err.Error())))
+			return
+		}
+	}
 	// 完成ws协议的握手操作 完成http应答,在httpheader中放下如下参数 Upgrade:websocket 客户端告知升级连接为websocket
 	wsConn, err = upgrader.Upgrade(resp, req, nil)
 	if err != nil {
-		logger.Error("升级为websocket失败", err.Error())
+		log.Error("升级为websocket失败", err.Error())
 		// 获取连接失败直接返回
 		return
 	}
 	connAddr := wsConn.RemoteAddr().String()
-	logger.Infof("websocket客户端连接地址:%s", connAddr)
+	log.Infof("websocket客户端连接地址:%s", connAddr)
 	connID := utils.Get49UUID()
-	conn, err = InitConnection(wsConn, connID, connAddr)
+	conn, err = InitConnection(h, wsConn, connID, connAddr, maxMessageSize)
 	if err != nil {
-		logger.Error("初始化websocket失败", err.Error())
+		log.Error("初始化websocket失败", err.Error())
 		// 关闭当前连接
 		conn.Close()
 		return
 	}
-	// TODO 如果要控制连接数可以计算，wsConnAll长度
-	// 存储连接信息，连接数保持一定数量，超过的部分不提供服务
-	if conn != nil {
-		WebsocketConnAll[connID] = conn
+	// 认证得到的身份优先于报文中的身份，客户端无法冒用其他用户账号
+	if authenticator != nil {
+		h.Bind(conn, identity.UserID, identity.SourceID)
 	}
-	logger.Infof("websocket当前在线连接数:%d", len(WebsocketConnAll))
-
-	// 启动线程，不断发消息
-	go func() {
-		var (
-			err error
-		)
-		for {
-			// 每隔一秒发送一次心跳  使用应用层心跳机制， 即客户端定时发送ping， 服务端响应pong。
-			if err = conn.WriteMessage(websocket.PongMessage, []byte("heartbeat")); err != nil {
-				return
-			}
-			time.Sleep(1 * time.Second)
-		}
-	}()
+	// TODO 如果要控制连接数可以计算，h.Count(hub.ProtocolWebsocket)
 
+	// 心跳由写协程按 pingPeriod 发送 ping，不再为每个连接单独启动定时协程
 	go func() {
 		for {
 			if msg, err = conn.ReadMessage(); err != nil {
-				logger.Error("读取websocket消息失败", err.Error())
+				log.Error("读取websocket消息失败", err.Error())
 				// 关闭当前连接
 				conn.Close()
 				return
 			}
-			if json.Valid(msg.data) == false {
-				logger.Warn("读取websocket消息时，该消息不是一个json字符串，不做处理")
-			} else {
-				busData := global.BusinessData{}
-				if err := json.Unmarshal(msg.data, &busData); err != nil {
-					logger.Error("读取websocket消息时，该消息是一个json字符串，进行解析格式化，解析错误", err.Error())
-					continue
-				}
-				logger.Info(busData.Protocol)
-				if busData.Protocol == "socket" {
-					global.SocketBusDataAllInfo[busData.UserID] = busData
-				} else if busData.Protocol == "websocket" {
-					global.WebSocketBusDataAllInfo[busData.UserID] = busData
-				}
-			}
+			// 解析并投递到 socket 或 websocket 连接
+			h.Receive(conn, msg.data)
 		}
 	}()
-
-	//启动协程循环写入
-	go func() {
-		for {
-			if len(global.WebSocketBusDataAllInfo) > 0 {
-				tempData, err := json.Marshal(global.WebSocketBusDataAllInfo)
-				if err != nil {
-					logger.Error("发送socket消息时，将待转发的消息转换为json字符串错误", err.Error())
-					continue
-				}
-				//发送给所有在线的客户端
-				for _, client := range WebsocketConnAll {
-					if err = client.WriteMessage(msg.messageType, tempData); err != nil {
-						logger.Error("发送socket消息失败", err.Error())
-						// 关闭当前连接
-						conn.Close()
-						return
-					}
-				}
-				global.WebSocketBusDataAllInfo = make(map[string]global.BusinessData)
-			}
-
-		}
-	}()
-
-	/*for {
-		if msg, err = conn.ReadMessage(); err != nil {
-			logger.Error("读取websocket消息失败", err.Error())
-			conn.Close()
-			return
-		}
-		if err = conn.WriteMessage(msg.messageType, msg.data); err != nil {
-			logger.Error("发送websocket消息失败", err.Error())
-			conn.Close()
-			return
-		}
-	}*/
 }
 
-//StartWebsocket 启动程序
-func StartWebsocket(addrPort string) {
-	WebsocketConnAll = make(map[string]*WsConnection)
-	logger.Info("开启 WebSocket Server ...")
+/*
+Handle 在 mux 上注册 /ws，由调用方负责监听与TLS；在线连接查询在需要令牌的管理接口中提供
+ * @param mux 路由，同一个 mux 只能注册一次
+ * @param h 连接中心
+ * @param authenticator 认证器，为空时不认证
+ * @param allowedOrigins 允许的来源，为空时不限制
+ * @param maxMessageSize 消息长度上限，小于等于0时为 DefaultMaxMessageSize，超出时关闭连接
+*/
+func Handle(mux *http.ServeMux, h *hub.Hub, authenticator auth.Authenticator, allowedOrigins []string, maxMessageSize int64) {
+	upgrader := newUpgrader(h.Logger(), allowedOrigins)
 	// 当有请求访问ws时，执行此回调方法
-	http.HandleFunc("/ws", wsHandler)
-	// 监听127.0.0.1:端口
-	uri := "0.0.0.0:" + addrPort
-	err := http.ListenAndServe(uri, nil)
-	if err != nil {
-		logger.Error("监听并启动websocket失败", err.Error())
-	}
+	mux.HandleFunc("/ws", func(resp http.ResponseWriter, req *http.Request) {
+		wsHandler(h, upgrader, authenticator, maxMessageSize, resp, req)
+	})
 }
@@ -8,7 +8,9 @@ package core
 
 import (
 	"fmt"
+	"go-cmd-transfer/config"
 	"go-cmd-transfer/global"
+	"sync"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/viper"
@@ -16,6 +18,20 @@ import (
 
 const defaultConfigFile = "config.yml"
 
+var (
+	// 配置文件变化回调锁
+	listenerMutex sync.Mutex
+	// 配置文件变化回调
+	listeners []func(changed config.Server)
+)
+
+//OnConfigChange 注册配置文件变化回调，在配置重新解析后按注册顺序以新的配置调用；回调在监听协程中执行，global.CmdConfig 不随之更新
+func OnConfigChange(listener func(changed config.Server)) {
+	listenerMutex.Lock()
+	listeners = append(listeners, listener)
+	listenerMutex.Unlock()
+}
+
 //InitYml 解析配置文件
 func InitYml() {
 	v := viper.New()
@@ -30,8 +46,17 @@ func InitYml() {
 
 	v.OnConfigChange(func(e fsnotify.Event) {
 		fmt.Println("config file changed:", e.Name)
-		if err := v.Unmarshal(&global.CmdConfig); err != nil {
+		// 解析到新的配置，避免列表缩短时保留原有的元素
+		changedConfig := config.Server{}
+		if err := v.Unmarshal(&changedConfig); err != nil {
 			fmt.Println(err)
+			return
+		}
+		listenerMutex.Lock()
+		changed := append([]func(config.Server){}, listeners...)
+		listenerMutex.Unlock()
+		for _, listener := range changed {
+			listener(changedConfig)
 		}
 	})
 	if err := v.Unmarshal(&global.CmdConfig); err != nil {
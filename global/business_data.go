@@ -6,17 +6,17 @@
 
 package global
 
-//SocketBusDataAllInfo  socket业务数据集合
-var SocketBusDataAllInfo = make(map[string]BusinessData)
-
-//WebSocketBusDataAllInfo  websocket业务数据集合
-var WebSocketBusDataAllInfo = make(map[string]BusinessData)
-
 //BusinessData 业务数据报文
 type BusinessData struct {
-	Protocol string      `json:"protocol"` // 协议 socket/websocket
-	SourceID string      `json:"sourceId"` // 接入端标识
-	UserID   string      `json:"userId"`   // 用户账号
-	OpType   string      `json:"opType"`   // 操作类型
-	Data     interface{} `json:"data"`     // 数据
+	MsgID         string      `json:"msgId"`                   // 消息标识 由服务端分配
+	Protocol      string      `json:"protocol"`                // 协议 socket/websocket 决定投递的目标传输层，为空时投递到所有传输层
+	SourceID      string      `json:"sourceId"`                // 接入端标识
+	UserID        string      `json:"userId"`                  // 用户账号
+	OpType        string      `json:"opType"`                  // 操作类型
+	Mode          string      `json:"mode"`                    // 投递模式 broadcast/user/source/conn/topic/reply
+	Targets       []string    `json:"targets"`                 // 投递目标 用户账号、接入端标识、连接标识或主题列表
+	RequireAck    bool        `json:"requireAck,omitempty"`    // 是否需要接收方确认，未确认时重发
+	CorrelationID string      `json:"correlationId,omitempty"` // 关联标识 请求设置后，响应以 reply 模式带回同一标识
+	Timeout       int         `json:"timeout,omitempty"`       // 请求等待响应的时长(毫秒)，为0时使用默认值
+	Data          interface{} `json:"data"`                    // 数据
 }
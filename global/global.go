@@ -13,7 +13,7 @@ import (
 )
 
 var (
-	//CmdConfig 全局服务配置
+	//CmdConfig 启动时解析的服务配置，配置文件变化时不更新，变化后的配置由 core.OnConfigChange 回调传入
 	CmdConfig config.Server
 	//CmdVp 配置文件
 	CmdVp *viper.Viper
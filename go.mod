@@ -3,11 +3,15 @@ module go-cmd-transfer
 go 1.14
 
 require (
+	github.com/alicebob/miniredis/v2 v2.14.1
 	github.com/fsnotify/fsnotify v1.4.9
+	github.com/go-redis/redis/v7 v7.4.0
 	github.com/gorilla/websocket v1.4.2
 	github.com/json-iterator/go v1.1.10
+	github.com/prometheus/client_golang v1.7.1
 	github.com/satori/go.uuid v1.2.0
 	github.com/sirupsen/logrus v1.6.0
 	github.com/spf13/viper v1.7.1
-	golang.org/x/net v0.0.0-20190620200207-3b0461eec859
+	go.etcd.io/bbolt v1.3.5
+	golang.org/x/net v0.0.0-20190923162816-aa69164e4478
 )
@@ -7,11 +7,31 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"go-cmd-transfer/config"
 	"go-cmd-transfer/core"
-	"go-cmd-transfer/core/socket"
-	"go-cmd-transfer/core/websocket"
+	"go-cmd-transfer/core/acl"
+	"go-cmd-transfer/core/auth"
+	"go-cmd-transfer/core/certificate"
+	"go-cmd-transfer/core/cluster"
+	"go-cmd-transfer/core/hub"
+	"go-cmd-transfer/core/offline"
+	"go-cmd-transfer/core/presence"
+	"go-cmd-transfer/core/server"
 	"go-cmd-transfer/global"
+	"go-cmd-transfer/utils"
+	"io"
+	"net"
+	"os"
+	"os/signal"
 	"strconv"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	logger "github.com/sirupsen/logrus"
 )
 
 func main() {
@@ -24,11 +44,169 @@ func main() {
 	//logger.WithFields(logger.Fields{"animal": "walrus"}).Info("A walrus appears")
 
 	info := global.CmdConfig.System
-	//socket.ClientConnect("test", strconv.Itoa(info.SocketPort))
-	//开启协程运行socket服务
-	go func() {
-		socket.ServerSocket(strconv.Itoa(info.SocketPort))
-	}()
-	//开启websocket服务
-	websocket.StartWebsocket(strconv.Itoa(info.WebsocketPort))
+	//连接中心，socket与websocket服务共用
+	h := hub.New()
+	nodeID := info.NodeID
+	if nodeID == "" {
+		nodeID = utils.Get32UUID()
+	}
+	h.SetNode(nodeID)
+	h.SetAckPolicy(time.Duration(info.AckTimeout)*time.Millisecond, info.AckRetries)
+	h.SetRequestTimeout(time.Duration(info.RequestTimeout) * time.Millisecond)
+	//启用redis或离线消息存储在redis时创建redis客户端
+	var client *redis.Client
+	redisConfig, offlineConfig := global.CmdConfig.Redis, global.CmdConfig.Offline
+	if redisConfig.Enable || (offlineConfig.Enable && offlineConfig.Backend == offline.BackendRedis) {
+		client = cluster.NewRedisClient(redisConfig)
+	}
+	//启用redis时接入集群消息总线与集群在线注册表，否则只记录本节点的在线连接
+	if redisConfig.Enable {
+		backplane, err := cluster.NewRedisBackplane(client)
+		if err != nil {
+			panic(fmt.Errorf("Fatal error redis backplane: %s", err))
+		}
+		if err := h.UseBackplane(backplane); err != nil {
+			panic(fmt.Errorf("Fatal error redis backplane: %s", err))
+		}
+		h.UsePresence(presence.NewRedisRegistry(client, time.Duration(redisConfig.PresenceTTL)*time.Second))
+		logger.Infof("当前节点已接入集群，节点标识：%s", nodeID)
+	} else {
+		h.UsePresence(presence.NewMemoryRegistry())
+	}
+	//启用离线消息存储
+	if offlineConfig.Enable {
+		store, err := offline.New(offlineConfig, client)
+		if err != nil {
+			panic(fmt.Errorf("Fatal error offline store: %s", err))
+		}
+		h.UseOfflineStore(store)
+	}
+	//启用认证
+	authConfig := global.CmdConfig.Auth
+	authenticator, err := auth.New(authConfig)
+	if err != nil {
+		panic(fmt.Errorf("Fatal error auth: %s", err))
+	}
+	//启用授权，配置文件变化时重新加载；审计记录写入审计日志
+	auditLog := core.InitAuditLog(c.LogPath)
+	// 当前的授权配置，审计回调在连接中心的协程中读取，配置文件变化时整体替换
+	var aclConfig atomic.Value
+	aclConfig.Store(global.CmdConfig.ACL)
+	h.OnAudit(func(entry hub.AuditEntry) {
+		if entry.Decision == hub.DecisionDeny || aclConfig.Load().(config.ACL).AuditAllow {
+			auditLog.WithFields(logger.Fields{
+				"action":   entry.Action,
+				"userId":   entry.UserID,
+				"sourceId": entry.SourceID,
+				"roles":    entry.Roles,
+				"connId":   entry.ConnID,
+				"addr":     entry.Addr,
+				"opType":   entry.OpType,
+				"target":   entry.Target,
+				"msgId":    entry.MsgID,
+				"sender":   entry.Sender,
+			}).Info(entry.Decision)
+		}
+	})
+	usePolicy(h, global.CmdConfig.ACL)
+	core.OnConfigChange(func(changed config.Server) {
+		aclConfig.Store(changed.ACL)
+		usePolicy(h, changed.ACL)
+	})
+	//启用TLS，证书文件变化时自动重新加载，关闭服务时停止监听证书文件
+	var watchers []io.Closer
+	socketTLS, socketReloader, err := certificate.New(info.SocketTLS)
+	if err != nil {
+		panic(fmt.Errorf("Fatal error socket tls: %s", err))
+	}
+	if socketReloader != nil {
+		watchers = append(watchers, socketReloader)
+	}
+	socketClientAuth, err := certificate.NewClientAuth(info.SocketTLS, socketTLS)
+	if err != nil {
+		panic(fmt.Errorf("Fatal error socket client auth: %s", err))
+	}
+	if socketClientAuth != nil {
+		watchers = append(watchers, socketClientAuth)
+	}
+	websocketTLS, websocketReloader, err := certificate.New(info.WebsocketTLS)
+	if err != nil {
+		panic(fmt.Errorf("Fatal error websocket tls: %s", err))
+	}
+	if websocketReloader != nil {
+		watchers = append(watchers, websocketReloader)
+	}
+	//开启socket服务与websocket服务，共用连接中心；管理接口与监控指标接口由转发服务一并开启与关闭
+	opts := []server.Option{
+		server.WithHub(h),
+		server.WithSocketAddr(net.JoinHostPort(info.Host, strconv.Itoa(info.SocketPort))),
+		server.WithSocketTLS(socketTLS, socketClientAuth),
+		server.WithWebsocketAddr(net.JoinHostPort(info.Host, strconv.Itoa(info.WebsocketPort))),
+		server.WithWebsocketTLS(websocketTLS),
+		server.WithWebsocketMaxMessageSize(info.WebsocketMaxMessageSize),
+		server.WithAuthenticator(authenticator),
+		server.WithLoginTimeout(time.Duration(authConfig.LoginTimeout) * time.Second),
+		server.WithAllowedOrigins(authConfig.AllowedOrigins...),
+	}
+	if adminConfig := global.CmdConfig.Admin; adminConfig.Enable {
+		if adminConfig.Token == "" {
+			logger.Error("未配置管理令牌，不开启管理接口")
+		} else {
+			opts = append(opts, server.WithAdminAddr(net.JoinHostPort(adminConfig.Host, strconv.Itoa(adminConfig.Port)), adminConfig.Token))
+		}
+	}
+	if metricsConfig := global.CmdConfig.Metrics; metricsConfig.Enable {
+		opts = append(opts, server.WithMetricsAddr(net.JoinHostPort(metricsConfig.Host, strconv.Itoa(metricsConfig.Port))))
+	}
+	srv := server.New(opts...)
+	if err := srv.Start(context.Background()); err != nil {
+		panic(fmt.Errorf("Fatal error server: %s", err))
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	sig := <-signals
+	logger.Infof("收到信号%s，开始关闭服务", sig)
+	//redis客户端在连接中心关闭集群消息总线、在线注册表与离线消息存储之后关闭
+	closers := watchers
+	if client != nil {
+		closers = append(closers, client)
+	}
+	shutdown(srv, time.Duration(info.ShutdownTimeout)*time.Second, closers...)
+}
+
+/*
+shutdown 优雅关闭：停止监听，向所有连接发送关闭通知并在期限内写出写队列，停止监听证书文件、关闭redis客户端，最后将日志写入磁盘
+ * @param srv 转发服务
+ * @param timeout 写出写队列的期限，为0时默认30秒
+ * @param closers 证书与吊销列表的文件监听、redis客户端，在转发服务关闭后按顺序关闭
+*/
+func shutdown(srv *server.Server, timeout time.Duration, closers ...io.Closer) {
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		logger.Warnf("关闭服务时部分连接未写出写队列：%s", err.Error())
+	}
+	for _, closer := range closers {
+		closer.Close()
+	}
+	logger.Info("服务已关闭")
+	core.CloseLog()
+}
+
+//usePolicy 按配置设置授权策略，配置错误时保持原有策略
+func usePolicy(h *hub.Hub, c config.ACL) {
+	policy, err := acl.New(c)
+	if err != nil {
+		logger.Errorf("加载授权策略失败，保持原有策略，错误信息：%s", err.Error())
+		return
+	}
+	if policy == nil {
+		h.UsePolicy(nil)
+		return
+	}
+	h.UsePolicy(policy)
+	logger.Info("已加载授权策略")
 }